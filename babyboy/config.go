@@ -0,0 +1,149 @@
+package babyboy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/babyboy/babyboy/accounts"
+	"github.com/babyboy/babyboy/log"
+	"github.com/babyboy/babyboy/urfave/cli"
+	"github.com/babyboy/babyboy/utils"
+	"github.com/babyboy/common"
+	"github.com/babyboy/witness"
+	"github.com/naoina/toml"
+)
+
+var DumpConfigCommand = cli.Command{
+	Action:      utils.MigrateFlags(dumpConfig),
+	Name:        "dumpconfig",
+	Usage:       "Show configuration values",
+	ArgsUsage:   "",
+	Flags:       []cli.Flag{utils.ConfigFileFlag, utils.DataDirFlag, utils.RpcPortFlag, utils.P2pPortFlag, utils.NoDiscoverFlag},
+	Description: `The dumpconfig command shows configuration values, with defaults, config file and flags applied.`,
+}
+
+// These settings ensure that TOML keys use the same names as Go struct fields.
+var tomlSettings = toml.Config{
+	NormFieldName: func(rt reflect.Type, key string) string {
+		return key
+	},
+	FieldToKey: func(rt reflect.Type, field string) string {
+		return field
+	},
+	MissingField: func(rt reflect.Type, field string) error {
+		link := ""
+		if unicode.IsUpper(rune(rt.Name()[0])) && rt.PkgPath() != "main" {
+			link = fmt.Sprintf(", see https://godoc.org/%s#%s for available fields", rt.PkgPath(), rt.Name())
+		}
+		return fmt.Errorf("field '%s' is not defined in %s%s", field, rt.String(), link)
+	},
+}
+
+// LogConfig holds the logging settings of the node.
+type LogConfig struct {
+	// Verbosity is the log level, from 0 (silent) to 5 (detail).
+	Verbosity int
+
+	// Vmodule is the per-module verbosity pattern, e.g. "p2p=5,dag/*=4".
+	Vmodule string `toml:",omitempty"`
+
+	// File additionally writes the log to the given file in logfmt format.
+	File string `toml:",omitempty"`
+}
+
+// WitnessConfig holds the settings of a node acting as witness.
+type WitnessConfig struct {
+	// Enabled turns on authoring of witness units.
+	Enabled bool
+
+	// Address is the keystore account used to sign witness units.
+	Address string `toml:",omitempty"`
+
+	// PasswordFile is the file holding the passphrase of the witness account.
+	PasswordFile string `toml:",omitempty"`
+
+	// Interval is the number of seconds between two heartbeat units.
+	Interval int `toml:",omitempty"`
+}
+
+// makeWitnessConfig resolves the witness account and its passphrase.
+func makeWitnessConfig(cfg WitnessConfig) (witness.Config, error) {
+	if !common.IsHexAddress(cfg.Address) {
+		return witness.Config{}, fmt.Errorf("invalid witness address %q", cfg.Address)
+	}
+	password := ""
+	if cfg.PasswordFile != "" {
+		content, err := ioutil.ReadFile(cfg.PasswordFile)
+		if err != nil {
+			return witness.Config{}, fmt.Errorf("failed to read witness password file: %v", err)
+		}
+		password = strings.TrimRight(string(content), "\r\n")
+	}
+	return witness.Config{
+		Account:  accounts.Account{Address: common.HexToAddress(cfg.Address)},
+		Password: password,
+		Interval: time.Duration(cfg.Interval) * time.Second,
+	}, nil
+}
+
+func defaultLogConfig() LogConfig {
+	return LogConfig{Verbosity: int(log.LvlInfo)}
+}
+
+// loadConfig decodes the TOML file into cfg, leaving unset values as they are.
+func loadConfig(file string, cfg *BabyConfig) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = tomlSettings.NewDecoder(bufio.NewReader(f)).Decode(cfg)
+	// Add file name to errors that have a line number.
+	if _, ok := err.(*toml.LineError); ok {
+		err = errors.New(file + ", " + err.Error())
+	}
+	return err
+}
+
+// setupLogging installs the root log handler described by the log settings.
+func setupLogging(cfg LogConfig) error {
+	handler := log.StreamHandler(os.Stderr, log.TerminalFormat(false))
+	if cfg.File != "" {
+		fileHandler, err := log.FileHandler(cfg.File, log.LogfmtFormat())
+		if err != nil {
+			return err
+		}
+		handler = log.MultiHandler(handler, fileHandler)
+	}
+	glogger := log.NewGlogHandler(handler)
+	glogger.Verbosity(log.Lvl(cfg.Verbosity))
+	if err := glogger.Vmodule(cfg.Vmodule); err != nil {
+		return fmt.Errorf("invalid vmodule %q: %v", cfg.Vmodule, err)
+	}
+	log.Root().SetHandler(glogger)
+	return nil
+}
+
+// dumpConfig is the dumpconfig command.
+func dumpConfig(ctx *cli.Context) error {
+	cfg, err := makeConfig(ctx)
+	if err != nil {
+		return err
+	}
+	out, err := tomlSettings.Marshal(&cfg)
+	if err != nil {
+		return err
+	}
+	io.WriteString(os.Stdout, "# Effective node configuration, usable with --"+utils.ConfigFileFlag.Name+"\n\n")
+	os.Stdout.Write(out)
+	return nil
+}
@@ -0,0 +1,341 @@
+package console
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/babyboy/babyboy/rpc"
+)
+
+var (
+	// statementRegex matches a single console statement of the form
+	// `namespace.method(arg, ...)`, the argument list being optional.
+	statementRegex = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9]*)\.([a-zA-Z][a-zA-Z0-9]*)\s*(?:\((.*)\))?$`)
+
+	// exitRegex matches the commands that terminate an interactive session.
+	exitRegex = regexp.MustCompile(`^\s*(exit|quit)\s*(\(\s*\))?\s*;?\s*$`)
+)
+
+// HistoryFile is the file within the data directory to store input scrollback.
+const HistoryFile = "history"
+
+// DefaultPrompt is the default prompt line prefix to use for user input querying.
+const DefaultPrompt = "> "
+
+var (
+	ErrUnknownStatement = errors.New("statement must look like namespace.method(args...)")
+	ErrUnknownNamespace = errors.New("unknown rpc namespace")
+)
+
+// Config is the collection of configurations to fine tune the behavior of the
+// console.
+type Config struct {
+	DataDir  string       // Data directory to store the console history at
+	Client   *rpc.Client  // RPC client to execute node requests through
+	Prompt   string       // Input prompt prefix string (defaults to DefaultPrompt)
+	Prompter UserPrompter // Input prompter to allow interactive user feedback (defaults to TerminalPrompter)
+	Printer  io.Writer    // Output writer to serialize any display strings to (defaults to os.Stdout)
+}
+
+// Console is an interactive shell attached to a running node, dispatching the
+// entered statements as RPC calls and pretty printing the results.
+type Console struct {
+	client   *rpc.Client         // RPC client to execute node requests through
+	prompt   string              // Input prompt prefix string
+	prompter UserPrompter        // Input prompter to allow interactive user feedback
+	histPath string              // Absolute path to the console scrollback history
+	history  []string            // Scroll history maintained by the console
+	printer  io.Writer           // Output writer to serialize any display strings to
+	modules  map[string][]string // Namespaces and their methods offered by the node
+}
+
+// New initializes a console by querying the attached node for the namespaces
+// and methods it serves and loading the persisted input history.
+func New(config Config) (*Console, error) {
+	// Handle unset config values gracefully
+	if config.Prompter == nil {
+		config.Prompter = Stdin
+	}
+	if config.Prompt == "" {
+		config.Prompt = DefaultPrompt
+	}
+	if config.Printer == nil {
+		config.Printer = os.Stdout
+	}
+	// Initialize the console and return
+	console := &Console{
+		client:   config.Client,
+		prompt:   config.Prompt,
+		prompter: config.Prompter,
+		printer:  config.Printer,
+		histPath: filepath.Join(config.DataDir, HistoryFile),
+	}
+	if err := os.MkdirAll(config.DataDir, 0700); err != nil {
+		return nil, err
+	}
+	if err := console.init(); err != nil {
+		return nil, err
+	}
+	return console, nil
+}
+
+// init retrieves the available APIs from the remote node and configures the
+// history and the tab completion of the prompter.
+func (c *Console) init() error {
+	apis, err := c.client.SupportedModules()
+	if err != nil {
+		return fmt.Errorf("api modules: %v", err)
+	}
+	c.modules = make(map[string][]string, len(apis))
+	for api := range apis {
+		c.modules[api] = nil
+	}
+	// The admin namespace knows the method set of every namespace, older nodes
+	// without it still get namespace completion.
+	var methods map[string][]string
+	if err := c.client.Call(&methods, "admin_rpcMethods"); err == nil {
+		for api, list := range methods {
+			c.modules[api] = list
+		}
+	}
+	// Configure the console's input prompter for scrollback and tab completion
+	if c.prompter != nil {
+		if content, err := ioutil.ReadFile(c.histPath); err != nil {
+			c.prompter.SetHistory(nil)
+		} else {
+			c.history = strings.Split(string(content), "\n")
+			c.prompter.SetHistory(c.history)
+		}
+		c.prompter.SetWordCompleter(c.AutoCompleteInput)
+	}
+	return nil
+}
+
+// AutoCompleteInput is a pre-assembled word completer to be used by the user
+// input prompter to provide hints to the user about the namespaces and methods
+// served by the attached node.
+func (c *Console) AutoCompleteInput(line string, pos int) (string, []string, string) {
+	// No completions can be provided for empty inputs
+	if len(line) == 0 || pos == 0 {
+		return "", nil, ""
+	}
+	// Chunk data to relevant part for autocompletion
+	// E.g. in case of nested lines admin.peers(dag.u<tab>
+	start := pos - 1
+	for ; start > 0; start-- {
+		// Skip all methods and namespaces (i.e. including the dot)
+		if line[start] == '.' || (line[start] >= 'a' && line[start] <= 'z') || (line[start] >= 'A' && line[start] <= 'Z') || (line[start] >= '0' && line[start] <= '9') {
+			continue
+		}
+		start++
+		break
+	}
+	return line[:start], c.completions(line[start:pos]), line[pos:]
+}
+
+// completions returns the namespaces or namespace.method names that start with
+// the given partial statement, in lexicographic order.
+func (c *Console) completions(partial string) []string {
+	var results []string
+	if dot := strings.Index(partial, "."); dot >= 0 {
+		namespace, prefix := partial[:dot], partial[dot+1:]
+		for _, method := range c.modules[namespace] {
+			if strings.HasPrefix(method, prefix) {
+				results = append(results, namespace+"."+method+"(")
+			}
+		}
+	} else {
+		for namespace := range c.modules {
+			if strings.HasPrefix(namespace, partial) {
+				results = append(results, namespace+".")
+			}
+		}
+	}
+	sort.Strings(results)
+	return results
+}
+
+// Welcome show summary of current node instance and some metadata about the
+// console's available modules.
+func (c *Console) Welcome() {
+	message := "Welcome to the BabyBoy console!\n\n"
+
+	var info struct {
+		Name  string `json:"name"`
+		Enode string `json:"enode"`
+	}
+	if err := c.client.Call(&info, "admin_nodeInfo"); err == nil {
+		message += "instance: " + info.Name + "\n"
+		message += "enode:    " + info.Enode + "\n"
+	}
+	var datadir string
+	if err := c.client.Call(&datadir, "admin_datadir"); err == nil {
+		message += "datadir:  " + datadir + "\n"
+	}
+	namespaces := make([]string, 0, len(c.modules))
+	for namespace := range c.modules {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	message += "modules:  " + strings.Join(namespaces, " ") + "\n"
+
+	fmt.Fprintln(c.printer, message)
+}
+
+// Evaluate executes a single statement against the attached node and pretty
+// prints the result or the error it failed with.
+func (c *Console) Evaluate(statement string) error {
+	result, err := c.call(statement)
+	if err != nil {
+		fmt.Fprintf(c.printer, "Error: %v\n", err)
+		return err
+	}
+	fmt.Fprintln(c.printer, prettyPrint(result))
+	return nil
+}
+
+// call parses a console statement into an RPC method and its arguments, and
+// returns the raw JSON result of invoking it on the node.
+func (c *Console) call(statement string) (json.RawMessage, error) {
+	statement = strings.TrimSuffix(strings.TrimSpace(statement), ";")
+
+	match := statementRegex.FindStringSubmatch(statement)
+	if match == nil {
+		return nil, ErrUnknownStatement
+	}
+	namespace, method := match[1], match[2]
+	if _, ok := c.modules[namespace]; !ok {
+		return nil, ErrUnknownNamespace
+	}
+	// Arguments are parsed as a JSON array, so strings must be quoted
+	var args []interface{}
+	if params := strings.TrimSpace(match[3]); params != "" {
+		if err := json.Unmarshal([]byte("["+params+"]"), &args); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+	var result json.RawMessage
+	if err := c.client.Call(&result, namespace+"_"+method, args...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Interactive starts an interactive user session, where input is propted from
+// the configured user prompter.
+func (c *Console) Interactive() {
+	var (
+		prompt    = c.prompt          // Current prompt line (used for multi-line inputs)
+		scheduler = make(chan string) // Channel to send the next prompt on and receive the input
+	)
+	// Start a goroutine to listen for prompt requests and send back inputs
+	go func() {
+		for {
+			// Read the next user input
+			line, err := c.prompter.PromptInput(<-scheduler)
+			if err != nil {
+				// In case of an error, either clear the prompt or fail
+				if err == ErrAborted { // ctrl-C
+					scheduler <- ""
+					continue
+				}
+				close(scheduler)
+				return
+			}
+			// User input retrieved, send for interpretation and loop
+			scheduler <- line
+		}
+	}()
+	// Monitor Ctrl-C too in case the input is empty and we need to bail
+	abort := make(chan os.Signal, 1)
+	signal.Notify(abort, syscall.SIGINT, syscall.SIGTERM)
+
+	// Start sending prompts to the user and reading back inputs
+	for {
+		// Send the next prompt, triggering an input read and process the result
+		scheduler <- prompt
+		select {
+		case <-abort:
+			// User forcefully quite the console
+			fmt.Fprintln(c.printer, "caught interrupt, exiting")
+			return
+
+		case line, ok := <-scheduler:
+			// User input was returned by the prompter, handle special cases
+			if !ok || exitRegex.MatchString(line) {
+				return
+			}
+			if input := strings.TrimSpace(line); len(input) == 0 {
+				continue
+			}
+			// Keep the history even for failed statements, they are usually typos
+			if command := strings.TrimSpace(line); len(c.history) == 0 || command != c.history[len(c.history)-1] {
+				c.history = append(c.history, command)
+				if c.prompter != nil {
+					c.prompter.AppendHistory(command)
+				}
+			}
+			c.Evaluate(line)
+		}
+	}
+}
+
+// Execute runs the given statements non-interactively, one per line or
+// separated by semicolons, stopping at the first failure.
+func (c *Console) Execute(script string) error {
+	for _, statement := range splitStatements(script) {
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+		if err := c.Evaluate(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements splits a script on the semicolons and newlines outside of the
+// JSON string literals of the arguments.
+func splitStatements(script string) []string {
+	var (
+		statements []string
+		start      int
+		quoted     bool
+		escaped    bool
+	)
+	for i, r := range script {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case !quoted && (r == ';' || r == '\n'):
+			statements = append(statements, script[start:i])
+			start = i + 1
+		}
+	}
+	return append(statements, script[start:])
+}
+
+// Stop cleans up the console and terminates the runtime environment.
+func (c *Console) Stop() error {
+	if err := ioutil.WriteFile(c.histPath, []byte(strings.Join(c.history, "\n")), 0600); err != nil {
+		return err
+	}
+	if err := os.Chmod(c.histPath, 0600); err != nil { // Force 0600, even if it was different previously
+		return err
+	}
+	return nil
+}
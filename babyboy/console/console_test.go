@@ -0,0 +1,69 @@
+package console
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{name: "single statement", script: "admin.peerCount()", want: []string{"admin.peerCount()"}},
+		{name: "semicolons", script: "admin.peerCount(); dag.tips()", want: []string{"admin.peerCount()", " dag.tips()"}},
+		{name: "newlines", script: "admin.peerCount()\ndag.tips()", want: []string{"admin.peerCount()", "dag.tips()"}},
+		{name: "trailing semicolon", script: "dev.advance(5);", want: []string{"dev.advance(5)", ""}},
+		{name: "semicolon in a string", script: `admin.addPeer("a;b"); dag.tips()`, want: []string{`admin.addPeer("a;b")`, " dag.tips()"}},
+		{name: "newline in a string", script: "wallet.send(\"a\nb\")", want: []string{"wallet.send(\"a\nb\")"}},
+		{name: "escaped quote", script: `wallet.send("a\";b"); dag.tips()`, want: []string{`wallet.send("a\";b")`, " dag.tips()"}},
+		{name: "escaped backslash", script: `wallet.send("a\\"); dag.tips()`, want: []string{`wallet.send("a\\")`, " dag.tips()"}},
+		{name: "empty script", script: "", want: []string{""}},
+	}
+	for _, test := range tests {
+		if got := splitStatements(test.script); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAutoCompleteInput(t *testing.T) {
+	t.Parallel()
+
+	c := &Console{modules: map[string][]string{
+		"admin": {"peers", "peerCount", "addPeer"},
+		"dag":   {"unit", "units", "tips"},
+		"net":   nil,
+	}}
+	tests := []struct {
+		name        string
+		line        string
+		pos         int
+		head        string
+		completions []string
+		tail        string
+	}{
+		{name: "empty line", line: "", pos: 0},
+		{name: "namespace", line: "ad", pos: 2, completions: []string{"admin."}},
+		{name: "all namespaces", line: "a", pos: 1, completions: []string{"admin."}},
+		{name: "methods", line: "admin.pe", pos: 8, completions: []string{"admin.peerCount(", "admin.peers("}},
+		{name: "all methods", line: "dag.", pos: 4, completions: []string{"dag.tips(", "dag.unit(", "dag.units("}},
+		{name: "nested statement", line: "admin.addPeer(dag.u", pos: 19, head: "admin.addPeer(", completions: []string{"dag.unit(", "dag.units("}},
+		{name: "middle of the line", line: "dag.ti)", pos: 6, completions: []string{"dag.tips("}, tail: ")"},
+		{name: "namespace without methods", line: "net.p", pos: 5},
+		{name: "unknown namespace", line: "foo.b", pos: 5},
+		{name: "no match", line: "x", pos: 1},
+	}
+	for _, test := range tests {
+		head, completions, tail := c.AutoCompleteInput(test.line, test.pos)
+		if head != test.head || tail != test.tail {
+			t.Errorf("%s: got head %q and tail %q, want %q and %q", test.name, head, tail, test.head, test.tail)
+		}
+		if !reflect.DeepEqual(completions, test.completions) {
+			t.Errorf("%s: got completions %q, want %q", test.name, completions, test.completions)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// unitView is the subset of a unit's JSON form the console lays out as a card.
+type unitView struct {
+	Hash           string   `json:"hash"`
+	ParentList     []string `json:"parent_list"`
+	BestParentUnit string   `json:"best_parent_unit"`
+	LastBallUnit   string   `json:"last_ball_unit"`
+	Level          int64    `json:"level"`
+	WitnessedLevel int64    `json:"witnessed_level"`
+	MainChainIndex int64    `json:"main_chain_index"`
+	IsStable       bool     `json:"is_stable"`
+	IsOnMainChain  bool     `json:"is_on_main_chain"`
+	TimeStamp      int64    `json:"timestamp"`
+	Authors        []struct {
+		Address string `json:"address"`
+	} `json:"authors"`
+	Messages []struct {
+		Payload struct {
+			Outputs []struct {
+				Address string `json:"address"`
+				Amount  int64  `json:"amount"`
+			} `json:"outputs"`
+		} `json:"payload"`
+	} `json:"messages"`
+}
+
+// balanceView mirrors node.WalletBalance as returned over RPC.
+type balanceView struct {
+	Stable  *int64           `json:"Stable"`
+	Pending map[string]int64 `json:"Pending"`
+}
+
+// prettyPrint renders an RPC result for the terminal. Units and balances get a
+// dedicated layout, anything else is printed as indented JSON.
+func prettyPrint(result json.RawMessage) string {
+	if len(result) == 0 || string(result) == "null" {
+		return "null"
+	}
+	if out, ok := prettyUnit(result); ok {
+		return out
+	}
+	if out, ok := prettyBalance(result); ok {
+		return out
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, result, "", "  "); err != nil {
+		return string(result)
+	}
+	return indented.String()
+}
+
+func prettyUnit(result json.RawMessage) (string, bool) {
+	var unit unitView
+	if err := json.Unmarshal(result, &unit); err != nil || unit.Hash == "" || unit.ParentList == nil {
+		return "", false
+	}
+	status := "pending"
+	if unit.IsStable {
+		status = "stable"
+	}
+	if unit.IsOnMainChain {
+		status += ", on main chain"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "unit %s\n", unit.Hash)
+	fmt.Fprintf(&b, "  status:          %s\n", status)
+	fmt.Fprintf(&b, "  mci:             %d\n", unit.MainChainIndex)
+	fmt.Fprintf(&b, "  level:           %d (witnessed %d)\n", unit.Level, unit.WitnessedLevel)
+	fmt.Fprintf(&b, "  timestamp:       %d\n", unit.TimeStamp)
+	for _, author := range unit.Authors {
+		fmt.Fprintf(&b, "  author:          %s\n", author.Address)
+	}
+	fmt.Fprintf(&b, "  best parent:     %s\n", unit.BestParentUnit)
+	fmt.Fprintf(&b, "  last ball unit:  %s\n", unit.LastBallUnit)
+	for i, parent := range unit.ParentList {
+		label := ""
+		if i == 0 {
+			label = "parents:"
+		}
+		fmt.Fprintf(&b, "  %-16s %s\n", label, parent)
+	}
+	for _, message := range unit.Messages {
+		for _, output := range message.Payload.Outputs {
+			fmt.Fprintf(&b, "  -> %s %d\n", output.Address, output.Amount)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n"), true
+}
+
+func prettyBalance(result json.RawMessage) (string, bool) {
+	var balance balanceView
+	if err := json.Unmarshal(result, &balance); err != nil || balance.Stable == nil {
+		return "", false
+	}
+	var pending int64
+	units := make([]string, 0, len(balance.Pending))
+	for unit, amount := range balance.Pending {
+		pending += amount
+		units = append(units, unit)
+	}
+	sort.Strings(units)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "stable:  %d\n", *balance.Stable)
+	fmt.Fprintf(&b, "pending: %d\n", pending)
+	for _, unit := range units {
+		fmt.Fprintf(&b, "  %s %d\n", unit, balance.Pending[unit])
+	}
+	return strings.TrimRight(b.String(), "\n"), true
+}
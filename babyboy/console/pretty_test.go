@@ -0,0 +1,108 @@
+package console
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const (
+	testUnit = `{"hash":"0xaa","parent_list":["0x01","0x02"],"best_parent_unit":"0x01","last_ball_unit":"0x00",` +
+		`"level":3,"witnessed_level":1,"main_chain_index":2,"is_stable":true,"is_on_main_chain":true,"timestamp":100,` +
+		`"authors":[{"address":"0xbb"}],"messages":[{"payload":{"outputs":[{"address":"0xcc","amount":5}]}}]}`
+	testBalance = `{"Stable":10,"Pending":{"0xb":2,"0xa":3}}`
+)
+
+func TestPrettyUnit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		result string
+		want   string
+		ok     bool
+	}{
+		{
+			name:   "stable unit",
+			result: testUnit,
+			want: "unit 0xaa\n" +
+				"  status:          stable, on main chain\n" +
+				"  mci:             2\n" +
+				"  level:           3 (witnessed 1)\n" +
+				"  timestamp:       100\n" +
+				"  author:          0xbb\n" +
+				"  best parent:     0x01\n" +
+				"  last ball unit:  0x00\n" +
+				"  parents:         0x01\n" +
+				"                   0x02\n" +
+				"  -> 0xcc 5",
+			ok: true,
+		},
+		{
+			name:   "pending unit",
+			result: `{"hash":"0xaa","parent_list":["0x01"],"best_parent_unit":"0x01","last_ball_unit":"0x00","level":1}`,
+			want: "unit 0xaa\n" +
+				"  status:          pending\n" +
+				"  mci:             0\n" +
+				"  level:           1 (witnessed 0)\n" +
+				"  timestamp:       0\n" +
+				"  best parent:     0x01\n" +
+				"  last ball unit:  0x00\n" +
+				"  parents:         0x01",
+			ok: true,
+		},
+		{name: "no hash", result: `{"parent_list":["0x01"]}`},
+		{name: "no parents", result: `{"hash":"0xaa"}`},
+		{name: "balance", result: testBalance},
+		{name: "not an object", result: `[1,2]`},
+	}
+	for _, test := range tests {
+		got, ok := prettyUnit(json.RawMessage(test.result))
+		if ok != test.ok || got != test.want {
+			t.Errorf("%s: got %q (%v), want %q (%v)", test.name, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestPrettyBalance(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		result string
+		want   string
+		ok     bool
+	}{
+		{name: "pending units", result: testBalance, want: "stable:  10\npending: 5\n  0xa 3\n  0xb 2", ok: true},
+		{name: "nothing pending", result: `{"Stable":0,"Pending":null}`, want: "stable:  0\npending: 0", ok: true},
+		{name: "no stable balance", result: `{"Pending":{"0xa":3}}`},
+		{name: "unit", result: testUnit},
+		{name: "not an object", result: `7`},
+	}
+	for _, test := range tests {
+		got, ok := prettyBalance(json.RawMessage(test.result))
+		if ok != test.ok || got != test.want {
+			t.Errorf("%s: got %q (%v), want %q (%v)", test.name, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestPrettyPrint(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		result string
+		want   string
+	}{
+		{name: "empty result", result: ``, want: "null"},
+		{name: "null", result: `null`, want: "null"},
+		{name: "balance", result: testBalance, want: "stable:  10\npending: 5\n  0xa 3\n  0xb 2"},
+		{name: "other object", result: `{"a":1}`, want: "{\n  \"a\": 1\n}"},
+		{name: "number", result: `42`, want: "42"},
+	}
+	for _, test := range tests {
+		if got := prettyPrint(json.RawMessage(test.result)); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package babyboy
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/babyboy/babyboy/console"
+	"github.com/babyboy/babyboy/node"
+	"github.com/babyboy/babyboy/rpc"
+	"github.com/babyboy/babyboy/urfave/cli"
+	"github.com/babyboy/babyboy/utils"
+)
+
+var AttachCommand = cli.Command{
+	Action:    attach,
+	Name:      "attach",
+	Usage:     "Start an interactive console attached to a running node",
+	ArgsUsage: "[endpoint]",
+	Flags:     []cli.Flag{utils.DataDirFlag, utils.ExecFlag},
+	Description: `
+The console connects to a running node over IPC (default: <datadir>/babyboy.ipc)
+or over HTTP when an http:// endpoint is given. Statements are RPC calls written
+as namespace.method(args...), e.g. admin.peers() or admin.addPeer("enode://...").
+Use --exec to run statements non-interactively.`,
+}
+
+// attach will connect to a running node instance attaching a console to it.
+func attach(ctx *cli.Context) error {
+	// --datadir is a flag of the command, not a global one
+	dataDir := node.DefaultDataDir()
+	if ctx.IsSet(utils.DataDirFlag.Name) {
+		dataDir = ctx.String(utils.DataDirFlag.Name)
+	}
+	endpoint := ctx.Args().First()
+	if endpoint == "" {
+		endpoint = filepath.Join(dataDir, node.DefaultIPCPath)
+	}
+	if strings.HasPrefix(endpoint, "ipc:") {
+		endpoint = endpoint[4:]
+	}
+	client, err := rpc.Dial(endpoint)
+	if err != nil {
+		return fmt.Errorf("unable to attach to remote node: %v", err)
+	}
+	defer client.Close()
+
+	console, err := console.New(console.Config{
+		DataDir: dataDir,
+		Client:  client,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start the console: %v", err)
+	}
+	defer console.Stop()
+
+	// If only a short execution was requested, evaluate and return
+	if script := ctx.String(utils.ExecFlag.Name); script != "" {
+		return console.Execute(script)
+	}
+	// Otherwise print the welcome screen and enter interactive mode
+	console.Welcome()
+	console.Interactive()
+
+	return nil
+}
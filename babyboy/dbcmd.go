@@ -0,0 +1,222 @@
+package babyboy
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/babyboy/babyboy/urfave/cli"
+	"github.com/babyboy/babyboy/utils"
+	"github.com/babyboy/common"
+	"github.com/babyboy/leveldb"
+)
+
+var (
+	dbPrefixFlag = cli.StringFlag{
+		Name:  "prefix",
+		Usage: "Record kind (unit, ball, tip, utxo, ...) or hex key prefix to dump",
+		Value: "unit",
+	}
+	dbLimitFlag = cli.IntFlag{
+		Name:  "limit",
+		Usage: "Maximum number of records to dump (0 = all)",
+	}
+
+	dbFlags = []cli.Flag{utils.ConfigFileFlag, utils.DataDirFlag, utils.TestnetFlag, utils.GenesisFlag}
+)
+
+var DBCommand = cli.Command{
+	Name:      "db",
+	Usage:     "Inspect and repair the node database",
+	ArgsUsage: "",
+	Description: `
+The db commands open the database of a stopped node (see --datadir, --testnet and
+--genesis) to inspect it or to repair it.`,
+	Subcommands: []cli.Command{
+		{
+			Action:      utils.MigrateFlags(dbStats),
+			Name:        "stats",
+			Usage:       "Show record counts and sizes per kind and leveldb statistics",
+			Flags:       dbFlags,
+			Description: `Counts the records of every kind with their key and value sizes, followed by the leveldb level and compaction statistics.`,
+		},
+		{
+			Action:      utils.MigrateFlags(dbGet),
+			Name:        "get",
+			Usage:       "Show a unit, a ball or the unspent outputs of an address",
+			ArgsUsage:   "<unit|ball|utxo> <hash|address>",
+			Flags:       dbFlags,
+			Description: `Prints the stored JSON of a unit or ball by hash, or the stable and pending unspent outputs of an address.`,
+		},
+		{
+			Action:      utils.MigrateFlags(dbDump),
+			Name:        "dump",
+			Usage:       "Dump the records of one kind",
+			Flags:       append([]cli.Flag{dbPrefixFlag, dbLimitFlag}, dbFlags...),
+			Description: `Prints the hex key and the value of every record with the given prefix, in key order.`,
+		},
+		{
+			Action:      utils.MigrateFlags(dbCompact),
+			Name:        "compact",
+			Usage:       "Compact the whole database",
+			Flags:       dbFlags,
+			Description: `Runs a full leveldb compaction, which reclaims the space of deleted records.`,
+		},
+		{
+			Action:      utils.MigrateFlags(dbCheck),
+			Name:        "check",
+			Usage:       "Check the consistency of child indexes, tips and stable unit lists",
+			Flags:       dbFlags,
+			Description: `Verifies that the children index, the tips and the stable unit lists agree with the stored units. Exits with an error if problems are found.`,
+		},
+	},
+}
+
+// openDatabase opens the database of the node configured by the flags.
+func openDatabase(ctx *cli.Context) (*leveldb.DatabaseManager, error) {
+	cfg, err := makeConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Node.Ephemeral {
+		return nil, errors.New("ephemeral nodes have no database to inspect")
+	}
+	db := leveldb.NewDatabaseManager()
+	if err := db.InitDatabase(cfg.Node.DatabaseDir(), cfg.Node.DatabaseCache, cfg.Node.DatabaseHandles); err != nil {
+		return nil, err
+	}
+	// The commands only understand the current key schema
+	switch version := db.GetSchemaVersion(); {
+	case version > leveldb.SchemaVersion:
+		db.CloseDb()
+		return nil, leveldb.ErrSchemaTooNew
+	case version < leveldb.SchemaVersion:
+		db.CloseDb()
+		return nil, fmt.Errorf("database schema version %d is older than %d, start the node once to upgrade it", version, leveldb.SchemaVersion)
+	}
+	return db, nil
+}
+
+func dbStats(ctx *cli.Context) error {
+	db, err := openDatabase(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.CloseDb()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "kind\tcount\tkeys\tvalues\t")
+	for _, stat := range db.Stats() {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t\n", stat.Name, stat.Count, common.StorageSize(stat.KeySize), common.StorageSize(stat.ValueSize))
+	}
+	w.Flush()
+
+	fmt.Println("\nschema version:", db.GetSchemaVersion())
+	if stats, err := db.LevelDBStats(); err == nil {
+		fmt.Println()
+		fmt.Println(stats)
+	}
+	return nil
+}
+
+func dbGet(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return fmt.Errorf("usage: db get <unit|ball|utxo> <hash|address>")
+	}
+	kind, arg := ctx.Args().Get(0), ctx.Args().Get(1)
+
+	db, err := openDatabase(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.CloseDb()
+
+	switch kind {
+	case "unit":
+		unit, err := db.GetUnitByHash(common.HexToHash(arg))
+		if err != nil {
+			return err
+		}
+		return printJSON(unit)
+	case "ball":
+		ball, err := db.GetBallByHash(common.HexToHash(arg))
+		if err != nil {
+			return err
+		}
+		return printJSON(ball)
+	case "utxo":
+		if !common.IsHexAddress(arg) {
+			return fmt.Errorf("invalid address %q", arg)
+		}
+		address := common.HexToAddress(arg)
+		return printJSON(map[string]interface{}{
+			"stable":  db.GetUnspentOutput(address),
+			"pending": db.GetPendingUTXOByAuthor(address),
+		})
+	}
+	return fmt.Errorf("unknown record kind %q, want unit, ball or utxo", kind)
+}
+
+func dbDump(ctx *cli.Context) error {
+	prefix, err := leveldb.PrefixByName(ctx.String(dbPrefixFlag.Name))
+	if err != nil {
+		return err
+	}
+	db, err := openDatabase(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.CloseDb()
+
+	limit, count := ctx.Int(dbLimitFlag.Name), 0
+	return db.Dump(prefix, func(key, value []byte) bool {
+		fmt.Printf("%s: %s\n", hex.EncodeToString(key), value)
+		count++
+		return limit == 0 || count < limit
+	})
+}
+
+func dbCompact(ctx *cli.Context) error {
+	db, err := openDatabase(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.CloseDb()
+
+	fmt.Println("Compacting database...")
+	if err := db.Compact(); err != nil {
+		return err
+	}
+	fmt.Println("Compaction done")
+	return nil
+}
+
+func dbCheck(ctx *cli.Context) error {
+	db, err := openDatabase(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.CloseDb()
+
+	problems := db.Check()
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found", len(problems))
+	}
+	fmt.Println("Database is consistent")
+	return nil
+}
+
+func printJSON(v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
@@ -5,6 +5,9 @@ import (
 	"github.com/babyboy/babyboy/node"
 	"github.com/babyboy/babyboy/urfave/cli"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 type BabyEngine struct {
@@ -16,11 +19,12 @@ func NewBabyEngine() *BabyEngine {
 
 func (engine *BabyEngine) InitEngine(ctx *cli.Context) error {
 
-	// 初始化RpcServer
-	fullNode := MakeFullNode(ctx)
-	StartNode(fullNode)
-
-	return nil
+	// 初始化RpcServer, 配置无效时返回错误
+	fullNode, err := MakeFullNode(ctx)
+	if err != nil {
+		return err
+	}
+	return StartNode(fullNode)
 }
 
 // startNode boots up the system node and all registered protocols, after which
@@ -33,6 +37,16 @@ func StartNode(stack *node.Node) error {
 		log.Printf("Error starting node: %v", err)
 		return err
 	}
+	go func() {
+		sigc := make(chan os.Signal, 1)
+		signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(sigc)
+		<-sigc
+		log.Println("Got interrupt, shutting down...")
+		// Stops the witness service among the others before exiting
+		stack.Stop()
+		os.Exit(0)
+	}()
 
 	// Register wallet event handlers to open and auto-derive wallets
 	events := make(chan accounts.WalletEvent, 16)
@@ -0,0 +1,96 @@
+package babyboy
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"os"
+
+	"github.com/babyboy/babyboy/urfave/cli"
+	"github.com/babyboy/babyboy/utils"
+	"github.com/babyboy/crypto"
+	"github.com/babyboy/p2p/discover"
+)
+
+var nodeKeyOutFlag = cli.StringFlag{
+	Name:  "out",
+	Usage: "File to write the new key to (default: the node key file of the data directory)",
+}
+
+var NodeKeyCommand = cli.Command{
+	Name:      "nodekey",
+	Usage:     "Generate and show P2P node keys",
+	ArgsUsage: "",
+	Description: `
+The node key identifies the node on the P2P network: its enode ID is derived from
+it. The key is stored in the data directory and created on first start, --nodekey
+and --nodekeyhex override it.`,
+	Subcommands: []cli.Command{
+		{
+			Action:      utils.MigrateFlags(nodeKeyGenerate),
+			Name:        "generate",
+			Usage:       "Generate a new node key",
+			Flags:       []cli.Flag{nodeKeyOutFlag, utils.ConfigFileFlag, utils.DataDirFlag},
+			Description: `Writes a new key to --out, or to the data directory if it has no key yet, and prints its enode ID.`,
+		},
+		{
+			Action:      utils.MigrateFlags(nodeKeyShow),
+			Name:        "show",
+			Usage:       "Show the enode ID of the node key",
+			Flags:       []cli.Flag{utils.ConfigFileFlag, utils.DataDirFlag, utils.NodeKeyFileFlag, utils.NodeKeyHexFlag, utils.P2pPortFlag},
+			Description: `Prints the enode ID and URL of the key given by --nodekey or --nodekeyhex, or of the key of the data directory.`,
+		},
+	},
+}
+
+func nodeKeyGenerate(ctx *cli.Context) error {
+	out := ctx.String(nodeKeyOutFlag.Name)
+	if out == "" {
+		cfg, err := makeConfig(ctx)
+		if err != nil {
+			return err
+		}
+		out = cfg.Node.NodeKeyFile()
+		// Replacing the key would change the identity of the node
+		if _, err := os.Stat(out); err == nil {
+			return fmt.Errorf("node key %s already exists", out)
+		}
+		if err := os.MkdirAll(cfg.Node.DataDir, 0700); err != nil {
+			return err
+		}
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return err
+	}
+	if err := crypto.SaveECDSA(out, key); err != nil {
+		return err
+	}
+	fmt.Println("Node key written to", out)
+	printNodeKey(key, "")
+	return nil
+}
+
+func nodeKeyShow(ctx *cli.Context) error {
+	cfg, err := makeConfig(ctx)
+	if err != nil {
+		return err
+	}
+	key := cfg.Node.P2P.PrivateKey
+	if key == nil {
+		if key, err = crypto.LoadECDSA(cfg.Node.NodeKeyFile()); err != nil {
+			return fmt.Errorf("no node key: %v", err)
+		}
+	}
+	printNodeKey(key, cfg.Node.P2P.ListenAddr)
+	return nil
+}
+
+// printNodeKey prints the enode ID of a key, and its enode URL on the local
+// host if the listen address is known.
+func printNodeKey(key *ecdsa.PrivateKey, listenAddr string) {
+	id := discover.PubkeyID(&key.PublicKey)
+	fmt.Println("ID: ", id.String())
+	if listenAddr != "" {
+		fmt.Printf("URL: enode://%s@127.0.0.1%s\n", id.String(), listenAddr)
+	}
+}
@@ -1,14 +1,30 @@
 package babyboy
 
 import (
+	"crypto/ecdsa"
+	"fmt"
 	"github.com/babyboy/babyboy/utils"
 	"github.com/babyboy/babyboy/node"
 	"github.com/babyboy/babyboy/urfave/cli"
+	"github.com/babyboy/common"
+	"github.com/babyboy/core"
+	"github.com/babyboy/crypto"
+	"io/ioutil"
 	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	devAccounts = 3     // Number of pre-funded accounts of a developer network
+	devPassword = "dev" // Keystore password of the pre-funded developer accounts
 )
 
 type BabyConfig struct {
-	Node node.Config
+	Node    node.Config
+	Log     LogConfig
+	Witness WitnessConfig
 }
 
 func defaultNodeConfig() node.Config {
@@ -16,18 +32,42 @@ func defaultNodeConfig() node.Config {
 	return cfg
 }
 
-func MakeFullNode(ctx *cli.Context) *node.Node {
-	stack := makeConfigNode(ctx)
+// MakeFullNode creates the node configured by the command line, with the
+// services it runs registered. A node configured as witness fails to start
+// without a valid witness configuration.
+func MakeFullNode(ctx *cli.Context) (*node.Node, error) {
+	stack, cfg, err := makeConfigNode(ctx)
+	if err != nil {
+		return nil, err
+	}
 	utils.RegisterBabyService(stack)
 
-	return stack
+	if cfg.Witness.Enabled {
+		witnessCfg, err := makeWitnessConfig(cfg.Witness)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure the witness: %v", err)
+		}
+		utils.RegisterWitnessService(stack, witnessCfg)
+	}
+
+	return stack, nil
 }
 
-func makeConfigNode(ctx *cli.Context) *node.Node {
+// makeConfig assembles the node configuration from the defaults, the TOML file
+// given by --config and the command line flags, in that order of precedence.
+func makeConfig(ctx *cli.Context) (BabyConfig, error) {
 
 	// Load defaults.
 	cfg := BabyConfig{
 		Node: defaultNodeConfig(),
+		Log:  defaultLogConfig(),
+	}
+
+	// Load config file.
+	if ctx != nil && ctx.GlobalIsSet(utils.ConfigFileFlag.Name) {
+		if err := loadConfig(ctx.GlobalString(utils.ConfigFileFlag.Name), &cfg); err != nil {
+			return cfg, err
+		}
 	}
 
 	if ctx != nil && ctx.GlobalIsSet(utils.RpcPortFlag.Name) {
@@ -35,6 +75,12 @@ func makeConfigNode(ctx *cli.Context) *node.Node {
 		cfg.Node.RpcServer = "0.0.0.0:" + rpcPort
 	}
 
+	if ctx != nil && ctx.GlobalBool(utils.IPCDisabledFlag.Name) {
+		cfg.Node.IPCPath = ""
+	} else if ctx != nil && ctx.GlobalIsSet(utils.IPCPathFlag.Name) {
+		cfg.Node.IPCPath = ctx.GlobalString(utils.IPCPathFlag.Name)
+	}
+
 	if ctx != nil && ctx.GlobalIsSet(utils.DataDirFlag.Name) {
 		cfg.Node.DataDir = ctx.GlobalString(utils.DataDirFlag.Name)
 	}
@@ -44,15 +90,186 @@ func makeConfigNode(ctx *cli.Context) *node.Node {
 		cfg.Node.P2P.ListenAddr = addr
 	}
 
+	if err := setNodeKey(ctx, &cfg.Node); err != nil {
+		return cfg, err
+	}
+
 	if ctx != nil && ctx.GlobalIsSet(utils.NoDiscoverFlag.Name) {
 		cfg.Node.P2P.NoDiscovery = true
 	}
 
+	if ctx != nil && ctx.GlobalBool(utils.EphemeralFlag.Name) {
+		cfg.Node.Ephemeral = true
+	}
+
+	if ctx != nil && ctx.GlobalIsSet(utils.MaxParentsFlag.Name) {
+		cfg.Node.TipPolicy.MaxParents = ctx.GlobalInt(utils.MaxParentsFlag.Name)
+	}
+
+	if ctx != nil && ctx.GlobalBool(utils.LightFlag.Name) {
+		if cfg.Node.Light == nil {
+			cfg.Node.Light = &node.LightConfig{}
+		}
+		if hubs := ctx.GlobalString(utils.HubsFlag.Name); hubs != "" {
+			cfg.Node.Light.Hubs = strings.Split(hubs, ",")
+		}
+		if ctx.GlobalBool(utils.HubsDiscoverFlag.Name) {
+			cfg.Node.Light.Discover = true
+		}
+	}
+
+	if ctx != nil && ctx.GlobalIsSet(utils.RolesFlag.Name) {
+		cfg.Node.Roles = strings.Split(ctx.GlobalString(utils.RolesFlag.Name), ",")
+	}
+
+	if ctx != nil && ctx.GlobalIsSet(utils.MaxLightClientsFlag.Name) {
+		cfg.Node.MaxLightClients = ctx.GlobalInt(utils.MaxLightClientsFlag.Name)
+	}
+
+	if ctx != nil && ctx.GlobalIsSet(utils.MetricsAddrFlag.Name) {
+		cfg.Node.MetricsAddr = ctx.GlobalString(utils.MetricsAddrFlag.Name)
+	}
+
+	if ctx != nil && ctx.GlobalIsSet(utils.UnitAckPeersFlag.Name) {
+		cfg.Node.UnitAckPeers = ctx.GlobalInt(utils.UnitAckPeersFlag.Name)
+	}
+
+	if ctx != nil && ctx.GlobalBool(utils.WitnessFlag.Name) {
+		cfg.Witness.Enabled = true
+	}
+	if ctx != nil && ctx.GlobalIsSet(utils.WitnessAccountFlag.Name) {
+		cfg.Witness.Address = ctx.GlobalString(utils.WitnessAccountFlag.Name)
+	}
+	if ctx != nil && ctx.GlobalIsSet(utils.WitnessPasswordFlag.Name) {
+		cfg.Witness.PasswordFile = ctx.GlobalString(utils.WitnessPasswordFlag.Name)
+	}
+	// Witnesses advertise their role unless the roles are given explicitly
+	if cfg.Witness.Enabled && cfg.Node.Roles == nil {
+		cfg.Node.Roles = append(cfg.Node.AdvertisedRoles(), node.RoleWitness)
+	}
+
+	if err := setNetwork(ctx, &cfg.Node); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// setNetwork selects the genesis given by --testnet, --genesis or --dev and
+// moves the data directory into a per network subdirectory so that networks
+// never share a database.
+func setNetwork(ctx *cli.Context, cfg *node.Config) error {
+	if ctx == nil {
+		return nil
+	}
+	selected := 0
+	for _, flag := range []string{utils.TestnetFlag.Name, utils.GenesisFlag.Name, utils.DeveloperFlag.Name} {
+		if ctx.GlobalIsSet(flag) {
+			selected++
+		}
+	}
+	if selected > 1 {
+		return fmt.Errorf("flags --%s, --%s and --%s are mutually exclusive", utils.TestnetFlag.Name, utils.GenesisFlag.Name, utils.DeveloperFlag.Name)
+	}
+	switch {
+	case ctx.GlobalBool(utils.TestnetFlag.Name):
+		cfg.Genesis = core.DefaultTestnetGenesis()
+		cfg.DataDir = filepath.Join(cfg.DataDir, "testnet")
+	case ctx.GlobalIsSet(utils.GenesisFlag.Name):
+		genesis, err := core.LoadGenesis(ctx.GlobalString(utils.GenesisFlag.Name))
+		if err != nil {
+			return err
+		}
+		cfg.Genesis = genesis
+		cfg.DataDir = filepath.Join(cfg.DataDir, fmt.Sprintf("network-%d", genesis.NetworkID))
+	case ctx.GlobalBool(utils.DeveloperFlag.Name):
+		return setDeveloperNetwork(ctx, cfg)
+	}
+	return nil
+}
+
+// setDeveloperNetwork creates the ephemeral keys and the fresh genesis of a
+// developer network. Its genesis is new on every start, so it always gets an
+// empty temporary data directory and never joins other nodes.
+func setDeveloperNetwork(ctx *cli.Context, cfg *node.Config) error {
+	dev := &node.DevConfig{
+		Password: devPassword,
+		Period:   time.Duration(ctx.GlobalInt(utils.DeveloperPeriodFlag.Name)) * time.Second,
+	}
+	var witnesses, accounts []common.Address
+	// A developer network has as many witnesses as the default genesis
+	for i := 0; i < len(core.DefaultGenesis().Witnesses); i++ {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return err
+		}
+		dev.WitnessKeys = append(dev.WitnessKeys, key)
+		witnesses = append(witnesses, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	for i := 0; i < devAccounts; i++ {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return err
+		}
+		dev.Accounts = append(dev.Accounts, key)
+		accounts = append(accounts, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	datadir, err := ioutil.TempDir("", "babyboy-dev")
+	if err != nil {
+		return err
+	}
+	log.Println("Developer network data directory:", datadir)
+
+	cfg.Genesis = core.DeveloperGenesis(witnesses, accounts)
+	cfg.Dev = dev
+	cfg.DataDir = datadir
+	cfg.P2P.NoDiscovery = true
+	return nil
+}
+
+// setNodeKey loads the node key given by --nodekey or --nodekeyhex, the node
+// otherwise uses the key stored in its data directory.
+func setNodeKey(ctx *cli.Context, cfg *node.Config) error {
+	if ctx == nil {
+		return nil
+	}
+	var (
+		file = ctx.GlobalString(utils.NodeKeyFileFlag.Name)
+		hex  = ctx.GlobalString(utils.NodeKeyHexFlag.Name)
+		key  *ecdsa.PrivateKey
+		err  error
+	)
+	switch {
+	case file != "" && hex != "":
+		return fmt.Errorf("options %q and %q are mutually exclusive", utils.NodeKeyFileFlag.Name, utils.NodeKeyHexFlag.Name)
+	case file != "":
+		if key, err = crypto.LoadECDSA(file); err != nil {
+			return fmt.Errorf("option %q: %v", utils.NodeKeyFileFlag.Name, err)
+		}
+	case hex != "":
+		if key, err = crypto.HexToECDSA(hex); err != nil {
+			return fmt.Errorf("option %q: %v", utils.NodeKeyHexFlag.Name, err)
+		}
+	default:
+		return nil
+	}
+	cfg.P2P.PrivateKey = key
+	return nil
+}
+
+func makeConfigNode(ctx *cli.Context) (*node.Node, BabyConfig, error) {
+	cfg, err := makeConfig(ctx)
+	if err != nil {
+		return nil, cfg, fmt.Errorf("failed to load the configuration: %v", err)
+	}
+	if err := setupLogging(cfg.Log); err != nil {
+		return nil, cfg, fmt.Errorf("failed to set up logging: %v", err)
+	}
+
 	stack, err := node.New(&cfg.Node)
 	if err != nil {
-		log.Println("Failed to create the protocol stack: ", err)
-		return &node.Node{}
+		return nil, cfg, fmt.Errorf("failed to create the protocol stack: %v", err)
 	}
 
-	return stack
+	return stack, cfg, nil
 }
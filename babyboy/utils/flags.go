@@ -5,6 +5,7 @@ import (
 	"github.com/babyboy/babyboy/log"
 	"github.com/babyboy/babyboy/node"
 	"github.com/babyboy/babyboy/urfave/cli"
+	"github.com/babyboy/witness"
 	"os"
 	"path/filepath"
 )
@@ -52,13 +53,48 @@ func NewApp(gitCommit, usage string) *cli.App {
 	return app
 }
 
+// MigrateFlags sets the global flags from the flags of a command when they are
+// set, so that settings read through ctx.Global* honour the flags given after
+// the (sub)command name.
+func MigrateFlags(action func(ctx *cli.Context) error) func(*cli.Context) error {
+	return func(ctx *cli.Context) error {
+		for _, name := range ctx.FlagNames() {
+			if ctx.IsSet(name) {
+				ctx.GlobalSet(name, ctx.String(name))
+			}
+		}
+		return action(ctx)
+	}
+}
+
 var (
 	// General settings
+	ConfigFileFlag = cli.StringFlag{
+		Name:  "config",
+		Usage: "TOML configuration file",
+	}
 	DataDirFlag = DirectoryFlag{
 		Name:  "datadir",
 		Usage: "Data directory for the databases and keystore",
 		Value: DirectoryString{node.DefaultDataDir()},
 	}
+	TestnetFlag = cli.BoolFlag{
+		Name:  "testnet",
+		Usage: "Test network: pre-configured test network",
+	}
+	GenesisFlag = cli.StringFlag{
+		Name:  "genesis",
+		Usage: "Genesis JSON file of a private network (witnesses, allocations, network id)",
+	}
+	DeveloperFlag = cli.BoolFlag{
+		Name:  "dev",
+		Usage: "Ephemeral single node network with local witnesses and pre-funded accounts",
+	}
+	DeveloperPeriodFlag = cli.IntFlag{
+		Name:  "dev.period",
+		Usage: "Seconds between witness rounds in developer mode (0 = only on dev_advance)",
+		Value: 2,
+	}
 	NoDiscoverFlag = cli.BoolFlag{
 		Name:  "nodiscover",
 		Usage: "Disables the peer discovery mechanism (manual peer addition)",
@@ -71,10 +107,84 @@ var (
 		Name:  "rpcport",
 		Usage: "rpc port for http server",
 	}
+	EphemeralFlag = cli.BoolFlag{
+		Name:  "ephemeral",
+		Usage: "Keep the database in memory, nothing is written to the data directory",
+	}
+	MaxParentsFlag = cli.IntFlag{
+		Name:  "maxparents",
+		Usage: "Maximum number of parents referenced by units authored by this node",
+	}
+	LightFlag = cli.BoolFlag{
+		Name:  "light",
+		Usage: "Run as a light node that keeps no DAG and relies on trusted hubs",
+	}
+	HubsFlag = cli.StringFlag{
+		Name:  "hubs",
+		Usage: "Comma separated RPC endpoints of the hubs of a light node, in order of preference",
+	}
+	HubsDiscoverFlag = cli.BoolFlag{
+		Name:  "hubs.discover",
+		Usage: "Look up hubs serving light clients through discovery v5",
+	}
+	RolesFlag = cli.StringFlag{
+		Name:  "roles",
+		Usage: "Comma separated roles advertised through discovery v5 (full, witness, light)",
+	}
+	MaxLightClientsFlag = cli.IntFlag{
+		Name:  "lightclients",
+		Usage: "Maximum number of light clients served at a time (0 = none)",
+	}
+	MetricsAddrFlag = cli.StringFlag{
+		Name:  "metrics.addr",
+		Usage: "Serve Prometheus metrics at /metrics on this address (e.g. 127.0.0.1:6060)",
+	}
+	NodeKeyFileFlag = cli.StringFlag{
+		Name:  "nodekey",
+		Usage: "P2P node key file",
+	}
+	NodeKeyHexFlag = cli.StringFlag{
+		Name:  "nodekeyhex",
+		Usage: "P2P node key as hex (for testing)",
+	}
+	UnitAckPeersFlag = cli.IntFlag{
+		Name:  "ackpeers",
+		Usage: "Number of peers a unit authored by this node must reach before it leaves the outbound queue",
+	}
 	DbDirFlag = cli.IntFlag{
 		Name:  "dbdir",
 		Usage: "",
 	}
+
+	// RPC settings
+	IPCDisabledFlag = cli.BoolFlag{
+		Name:  "ipcdisable",
+		Usage: "Disable the IPC-RPC server",
+	}
+	IPCPathFlag = DirectoryFlag{
+		Name:  "ipcpath",
+		Usage: "Filename for IPC socket/pipe within the datadir (explicit paths escape it)",
+	}
+
+	// Witness settings
+	WitnessFlag = cli.BoolFlag{
+		Name:  "witness",
+		Usage: "Author witness units with the witness account",
+	}
+	WitnessAccountFlag = cli.StringFlag{
+		Name:  "witness.account",
+		Usage: "Keystore address of the witness account",
+	}
+	WitnessPasswordFlag = cli.StringFlag{
+		Name:  "witness.password",
+		Usage: "Password file unlocking the witness account",
+	}
+
+	// Console settings
+	ExecFlag = cli.StringFlag{
+		Name:  "exec",
+		Usage: "Execute the given statements (separated by ';' or newlines) and exit",
+	}
 )
 
 // RegisterEthService adds an BabyBoy client to the stack.
@@ -85,6 +195,17 @@ func RegisterBabyService(stack *node.Node) {
 	}
 }
 
+// RegisterWitnessService adds the witness service authoring heartbeat units to
+// the stack.
+func RegisterWitnessService(stack *node.Node, cfg witness.Config) {
+	err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		return witness.New(ctx, cfg)
+	})
+	if err != nil {
+		log.Error("Failed to register the witness service: %v", err)
+	}
+}
+
 func GetServiceContext() node.ServiceConstructor {
 	return func(ctx *node.ServiceContext) (node.Service, error) {
 		fullNode, err := frontsection.New(ctx)
@@ -0,0 +1,194 @@
+package core
+
+import (
+	"babyboy/common"
+	"babyboy/config"
+	"babyboy/core/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Network identifiers of the built in networks.
+const (
+	TestnetNetworkID   = 3
+	DeveloperNetworkID = 1337
+)
+
+const (
+	defaultWitnessAllocation   = 10000000
+	developerAccountAllocation = 1000000000
+)
+
+var (
+	ErrGenesisNoWitnesses       = errors.New("genesis has no witnesses")
+	ErrGenesisTooFewWitnesses   = errors.New("genesis has fewer witnesses than the stability majority")
+	ErrGenesisDuplicateWitness  = errors.New("genesis lists a witness twice")
+	ErrGenesisNonPositiveAmount = errors.New("genesis allocation must be positive")
+)
+
+// GenesisAlloc specifies the outputs that are part of the genesis unit.
+type GenesisAlloc map[common.Address]int
+
+// Genesis specifies the witness list, the initial allocations and the network
+// id of a network. It is read from the genesis file given by --genesis.
+type Genesis struct {
+	NetworkID uint64           `json:"networkId"`
+	Timestamp int64            `json:"timestamp"`
+	Witnesses []common.Address `json:"witnesses"`
+	Alloc     GenesisAlloc     `json:"alloc"`
+
+	// base is the hard coded mainnet genesis unit. It predates genesis files
+	// and is kept verbatim so that its hash does not change.
+	base *types.Unit
+}
+
+// DefaultGenesis returns the mainnet genesis, funding every witness with the
+// initial allocation.
+func DefaultGenesis() *Genesis {
+	unit := config.GenesisUnit()
+	alloc := make(GenesisAlloc, len(unit.WitnessList))
+	for _, witness := range unit.WitnessList {
+		alloc[witness] = defaultWitnessAllocation
+	}
+	return &Genesis{
+		NetworkID: config.NETWORK_ID,
+		Timestamp: unit.TimeStamp,
+		Witnesses: unit.WitnessList,
+		Alloc:     alloc,
+		base:      &unit,
+	}
+}
+
+// DefaultTestnetGenesis returns the testnet genesis. It shares the mainnet
+// witnesses but has its own network id and therefore its own genesis unit.
+func DefaultTestnetGenesis() *Genesis {
+	witnesses := make([]common.Address, len(config.WitnessList))
+	alloc := make(GenesisAlloc, len(config.WitnessList))
+	for i, witness := range config.WitnessList {
+		witnesses[i] = common.HexToAddress(witness)
+		alloc[witnesses[i]] = defaultWitnessAllocation
+	}
+	return &Genesis{
+		NetworkID: TestnetNetworkID,
+		Timestamp: 1535760000,
+		Witnesses: witnesses,
+		Alloc:     alloc,
+	}
+}
+
+// DeveloperGenesis returns a fresh genesis for a developer network, with the
+// given witnesses and pre-funded accounts.
+func DeveloperGenesis(witnesses []common.Address, accounts []common.Address) *Genesis {
+	alloc := make(GenesisAlloc, len(witnesses)+len(accounts))
+	for _, witness := range witnesses {
+		alloc[witness] = defaultWitnessAllocation
+	}
+	for _, account := range accounts {
+		alloc[account] = developerAccountAllocation
+	}
+	return &Genesis{
+		NetworkID: DeveloperNetworkID,
+		Timestamp: time.Now().Unix(),
+		Witnesses: witnesses,
+		Alloc:     alloc,
+	}
+}
+
+// LoadGenesis reads and validates a genesis file.
+func LoadGenesis(file string) (*Genesis, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	genesis := new(Genesis)
+	if err := json.NewDecoder(f).Decode(genesis); err != nil {
+		return nil, fmt.Errorf("invalid genesis file %s: %v", file, err)
+	}
+	if err := genesis.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid genesis file %s: %v", file, err)
+	}
+	return genesis, nil
+}
+
+// Validate checks that the witness list can reach stability and that every
+// allocation is spendable.
+func (g *Genesis) Validate() error {
+	if len(g.Witnesses) == 0 {
+		return ErrGenesisNoWitnesses
+	}
+	if len(g.Witnesses) < config.MajorityOfWitnesses {
+		return ErrGenesisTooFewWitnesses
+	}
+	seen := make(map[common.Address]bool, len(g.Witnesses))
+	for _, witness := range g.Witnesses {
+		if seen[witness] {
+			return ErrGenesisDuplicateWitness
+		}
+		seen[witness] = true
+	}
+	for _, amount := range g.Alloc {
+		if amount <= 0 {
+			return ErrGenesisNonPositiveAmount
+		}
+	}
+	return nil
+}
+
+// Outputs returns the allocations in the order they appear in the genesis
+// unit: witnesses first in witness list order, then the other addresses sorted.
+func (g *Genesis) Outputs() types.Outputs {
+	outputs := make(types.Outputs, 0, len(g.Alloc))
+	witnesses := make(map[common.Address]bool, len(g.Witnesses))
+	for _, witness := range g.Witnesses {
+		witnesses[witness] = true
+		if amount, ok := g.Alloc[witness]; ok {
+			outputs = append(outputs, types.NewOutput(witness, amount))
+		}
+	}
+	others := make([]common.Address, 0, len(g.Alloc))
+	for address := range g.Alloc {
+		if !witnesses[address] {
+			others = append(others, address)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].String() < others[j].String()
+	})
+	for _, address := range others {
+		outputs = append(outputs, types.NewOutput(address, g.Alloc[address]))
+	}
+	return outputs
+}
+
+// ToUnit assembles the genesis unit. It is stable and the first unit of the
+// main chain.
+func (g *Genesis) ToUnit() types.Unit {
+	if g.base != nil {
+		return *g.base
+	}
+	payload := types.Payload{Outputs: g.Outputs()}
+	unit := types.NewUnit(nil, g.Witnesses, common.Hash{}, common.Hash{}, 0, 0, 0)
+	unit.TimeStamp = g.Timestamp
+	unit.Messages = types.Messages{types.NewMessage(config.Const_Message_AppType_Payment, payload.GetPayloadHash(), payload)}
+	unit.IsStable = true
+	unit.IsOnMainChain = true
+	unit.Hash = unit.HashKey()
+	return unit
+}
+
+// UnspentOutputs returns the genesis allocations as spendable outputs of the
+// given genesis unit.
+func (g *Genesis) UnspentOutputs(unit types.Unit) []types.UTXO {
+	outputs := g.Outputs()
+	utxos := make([]types.UTXO, len(outputs))
+	for i, output := range outputs {
+		utxos[i] = types.UTXO{UnitHash: unit.Hash, MessageIndex: 0, OutputIndex: i, Output: output}
+	}
+	return utxos
+}
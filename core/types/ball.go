@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	"github.com/babyboy/common"
+	"github.com/babyboy/crypto/sha3"
 )
 
 type Balls []Ball
@@ -26,6 +27,11 @@ func (b Ball) HashKey() common.Hash {
 	return b.UnitHash
 }
 
+// 球的hash, 由单元hash, 父单元的球hash和是否无效计算
+func (b Ball) BallHash() common.Hash {
+	return sha3.Sum256(Ball2Byte(b))
+}
+
 func (b Ball) StringKey() string {
 	return b.HashKey().String()
 }
@@ -12,8 +12,7 @@ type P2pRequest struct {
 }
 
 type BroadUnitEntity struct {
-	HasPeers []string
-	Message  string
+	Message string
 }
 
 type LightNewUnitEntity struct {
@@ -41,7 +40,6 @@ type PeerInfoEntity struct {
 
 type NewUnitEntity struct {
 	FromPeerId string
-	HasPeerIds []string
 	NewUnit    Unit
 }
 
@@ -3,13 +3,21 @@ package types
 import "github.com/babyboy/common"
 
 type VoteResult struct {
-	StartTime       int64          `json:"time_stamp"`
-	EndTime         int64          `json:"time_stamp"`
+	StartTime       int64          `json:"start_time"`
+	EndTime         int64          `json:"end_time"`
 	VoteResult      common.Address `json:"vote_result"`
 	ReplacedWitness common.Address `json:"replaced_witness"`
 	Round           int64          `json:"round"`
+	StartMCI        int64          `json:"start_mci"`    // 本轮的第一个主链序号
+	EndMCI          int64          `json:"end_mci"`      // 本轮的最后一个主链序号
+	ActivateMCI     int64          `json:"activate_mci"` // 替换生效的主链序号
 }
 
 func NewVoteResult(startTime int64, endTime int64, voteResult common.Address, replaceWitness common.Address, round int64) VoteResult {
-	return VoteResult{startTime, endTime, voteResult, replaceWitness, round}
+	return VoteResult{StartTime: startTime, EndTime: endTime, VoteResult: voteResult, ReplacedWitness: replaceWitness, Round: round}
+}
+
+// 本轮是否产生了见证人替换
+func (result VoteResult) HasReplacement() bool {
+	return result.VoteResult != (common.Address{}) && result.ReplacedWitness != (common.Address{})
 }
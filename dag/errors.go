@@ -0,0 +1,7 @@
+package dag
+
+import "errors"
+
+var (
+	ErrNoCompatibleParent = errors.New("没有与见证人列表兼容的父单元")
+)
@@ -24,6 +24,11 @@ func NewGraphInfoGetter(db *boydb.DatabaseManager, parentList []common.Hash, wit
 	return &gig
 }
 
+// 按单元自己的父单元和见证人列表计算, 用于验证收到的单元
+func NewGraphInfoGetterForUnit(db *boydb.DatabaseManager, unit types.Unit) *GraphInfoGetter {
+	return NewGraphInfoGetter(db, unit.ParentList, unit.WitnessList)
+}
+
 func (gig GraphInfoGetter) GetLevel() int64 {
 	level := int64(0)
 
@@ -40,7 +45,7 @@ func (gig GraphInfoGetter) GetLevel() int64 {
 
 func (gig GraphInfoGetter) GetWitnessLevel() int64 {
 
-	if len(gig.bestParent) == 0 {
+	if gig.bestParent == (common.Hash{}) {
 		return -1
 	}
 	bestParent := gig.bestParent
@@ -56,9 +61,12 @@ func (gig GraphInfoGetter) GetWitnessLevel() int64 {
 	que.Push(bestParent)
 
 	for !que.Empty() {
-		unit, _ := gig.db.GetUnitByHash(que.Front().(common.Hash))
+		unit, err := gig.db.GetUnitByHash(que.Front().(common.Hash))
 		que.Pop()
-		if stableWitnessSet.Exists(unit.Authors[0].Address) {
+		if err != nil {
+			return -1
+		}
+		if len(unit.Authors) > 0 && stableWitnessSet.Exists(unit.Authors[0].Address) {
 			witnessCountSet.Insert(unit.Authors[0].Address)
 			if unit.Level < witnessLevel {
 				witnessLevel = unit.Level
@@ -67,7 +75,8 @@ func (gig GraphInfoGetter) GetWitnessLevel() int64 {
 				return witnessLevel
 			}
 		}
-		if unit.Hash.String() == config.GENISIS_UNIT_HASH {
+		// 创世单元没有父单元
+		if len(unit.ParentList) == 0 {
 			return 0
 		}
 		que.Push(unit.BestParentUnit)
@@ -75,15 +84,26 @@ func (gig GraphInfoGetter) GetWitnessLevel() int64 {
 	return -1
 }
 
-func (gig *GraphInfoGetter) GetBestParentUnit() common.Hash {
+// 计算最优父单元, 没有与见证人列表兼容的父单元时返回 ErrNoCompatibleParent
+func (gig *GraphInfoGetter) GetBestParentUnit() (common.Hash, error) {
 
 	if len(gig.parentList) == 0 {
-		return common.Hash{}
+		gig.bestParent = common.Hash{}
+		return gig.bestParent, ErrNoCompatibleParent
 	}
-	bestParentUnit, _ := gig.db.GetUnitByHash(gig.parentList[0])
 
+	// 见证人列表不兼容的父单元不能作为最优父单元
+	var bestParentUnit types.Unit
+	found := false
 	for _, parentHash := range gig.parentList {
 		tParentUnit, _ := gig.db.GetUnitByHash(parentHash)
+		if len(gig.witnessList) > 0 && len(tParentUnit.ParentList) > 0 && !WitnessListsCompatible(gig.witnessList, tParentUnit.WitnessList) {
+			continue
+		}
+		if !found {
+			bestParentUnit, found = tParentUnit, true
+			continue
+		}
 		if bestParentUnit.WitnessedLevel < tParentUnit.WitnessedLevel {
 			bestParentUnit = tParentUnit
 			continue
@@ -97,14 +117,18 @@ func (gig *GraphInfoGetter) GetBestParentUnit() common.Hash {
 			continue
 		}
 	}
+	if !found {
+		gig.bestParent = common.Hash{}
+		return gig.bestParent, ErrNoCompatibleParent
+	}
 	gig.bestParent = bestParentUnit.Hash
 
-	return gig.bestParent
+	return gig.bestParent, nil
 }
 
 func (gig GraphInfoGetter) GetLastStableBall() common.Hash {
 
-	if len(gig.bestParent) == 0 {
+	if gig.bestParent == (common.Hash{}) {
 		gig.GetBestParentUnit()
 	}
 
@@ -121,6 +145,10 @@ func (gig GraphInfoGetter) GetLastStableBall() common.Hash {
 		if unit.IsStable && unit.IsOnMainChain {
 			return unit.Hash
 		}
+		// 没有最优父单元时不能沿最优父单元找到稳定点
+		if unit.BestParentUnit == (common.Hash{}) {
+			break
+		}
 		que.Push(unit.BestParentUnit)
 	}
 	return unit.Hash
@@ -128,7 +156,7 @@ func (gig GraphInfoGetter) GetLastStableBall() common.Hash {
 
 func (gig GraphInfoGetter) GetLastStableBallMCI() int64 {
 
-	if len(gig.bestParent) == 0 {
+	if gig.bestParent == (common.Hash{}) {
 		gig.GetBestParentUnit()
 	}
 
@@ -146,6 +174,9 @@ func (gig GraphInfoGetter) GetLastStableBallMCI() int64 {
 		if unit.IsStable && unit.IsOnMainChain {
 			return unit.MainChainIndex
 		}
+		if unit.BestParentUnit == (common.Hash{}) {
+			break
+		}
 		que.Push(unit.BestParentUnit)
 	}
 	return unit.MainChainIndex
@@ -245,3 +276,27 @@ func (gig GraphInfoGetter) GetMissingStableUnitsHashOnMainChain(lastStableMCI, l
 
 	return stableBallUnitsHash
 }
+
+// 见证人证明: 从最优父单元沿最优父单元链到最后稳定球单元 (包含两端) 的所有单元,
+// 轻节点用它确认最后稳定球是由多数见证人在其后发布单元而确认的
+func (gig GraphInfoGetter) GetWitnessProof() types.Units {
+
+	if len(gig.bestParent) == 0 {
+		gig.GetBestParentUnit()
+	}
+
+	proof := types.NewUnits()
+	hash := gig.bestParent
+	for {
+		unit, err := gig.db.GetUnitByHash(hash)
+		if err != nil {
+			return proof
+		}
+		proof = append(proof, unit)
+		// 创世单元没有父单元
+		if (unit.IsStable && unit.IsOnMainChain) || len(unit.ParentList) == 0 {
+			return proof
+		}
+		hash = unit.BestParentUnit
+	}
+}
@@ -0,0 +1,73 @@
+package dag
+
+import (
+	"testing"
+
+	"babyboy-dag/boydb"
+	"github.com/babyboy/common"
+	"github.com/babyboy/core/types"
+)
+
+func TestGetBestParentUnit(t *testing.T) {
+	t.Parallel()
+
+	db := boydb.NewDatabaseManager()
+	db.InitWithDatabase(boydb.NewMemDatabase())
+
+	genesis := common.BytesToHash([]byte{0xff})
+	// Two mutations from the test witnesses, incompatible with them
+	other := []common.Address{testCandidate, common.HexToAddress("0x11"), testWitnesses[2]}
+
+	store := func(hash byte, witnessList []common.Address, level, witnessedLevel int64) common.Hash {
+		unit := types.NewEmptyUnit()
+		unit.Hash = common.BytesToHash([]byte{hash})
+		unit.ParentList = []common.Hash{genesis}
+		unit.WitnessList = witnessList
+		unit.Level = level
+		unit.WitnessedLevel = witnessedLevel
+		db.SaveUnitToDb(unit)
+		return unit.Hash
+	}
+	genesisUnit := types.NewEmptyUnit()
+	genesisUnit.Hash = genesis
+	genesisUnit.WitnessList = other
+	db.SaveUnitToDb(genesisUnit)
+
+	var (
+		low          = store(1, testWitnesses, 5, 1)
+		high         = store(2, testWitnesses, 5, 2)
+		shallow      = store(3, testWitnesses, 4, 2)
+		tie          = store(4, testWitnesses, 4, 2)
+		incompatible = store(5, other, 9, 9)
+		mutated      = store(6, []common.Address{testCandidate, testWitnesses[1], testWitnesses[2]}, 3, 3)
+	)
+
+	tests := []struct {
+		name    string
+		parents []common.Hash
+		best    common.Hash
+		err     error
+	}{
+		{name: "empty list", parents: nil, err: ErrNoCompatibleParent},
+		{name: "single parent", parents: []common.Hash{low}, best: low},
+		{name: "higher witnessed level", parents: []common.Hash{low, high}, best: high},
+		{name: "lower level", parents: []common.Hash{high, shallow}, best: shallow},
+		{name: "smaller hash", parents: []common.Hash{tie, shallow}, best: shallow},
+		{name: "duplicate parents", parents: []common.Hash{low, high, low}, best: high},
+		{name: "one mutation", parents: []common.Hash{low, mutated}, best: mutated},
+		{name: "more than one mutation", parents: []common.Hash{incompatible, low}, best: low},
+		{name: "no compatible parent", parents: []common.Hash{incompatible}, err: ErrNoCompatibleParent},
+		{name: "genesis", parents: []common.Hash{genesis}, best: genesis},
+	}
+	for _, test := range tests {
+		gig := NewGraphInfoGetter(db, test.parents, testWitnesses)
+		best, err := gig.GetBestParentUnit()
+		if err != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if best != test.best {
+			t.Errorf("%s: got best parent %s, want %s", test.name, best.String(), test.best.String())
+		}
+	}
+}
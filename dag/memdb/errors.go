@@ -0,0 +1,7 @@
+package memdb
+
+import "errors"
+
+var (
+	ErrNoCompatibleTip = errors.New("没有可以引用的父单元")
+)
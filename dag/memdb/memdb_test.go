@@ -0,0 +1,104 @@
+package memdb
+
+import (
+	"testing"
+	"time"
+
+	"babyboy-dag/boydb"
+	"github.com/babyboy/common"
+	"github.com/babyboy/core/types"
+)
+
+// testNode holds the memdbs of one node, backed by a database of its own
+type testNode struct {
+	db  *boydb.DatabaseManager
+	pdb *ParentMemDB
+	wdb *WitnessMemDB
+}
+
+func newTestNode() *testNode {
+	db := boydb.NewDatabaseManager()
+	db.InitWithDatabase(boydb.NewMemDatabase())
+	n := &testNode{db: db, pdb: NewParentMemDB(db), wdb: NewWitnessMemDB(db)}
+	n.pdb.InitParentMemDB()
+	n.wdb.InitWitnessMemDB()
+	return n
+}
+
+func (n *testNode) addTip(hash common.Hash) {
+	unit := types.NewEmptyUnit()
+	unit.Hash = hash
+	n.db.SaveUnitToDb(unit)
+	n.pdb.SaveParent(hash)
+}
+
+func TestParentMemDBPerNode(t *testing.T) {
+	t.Parallel()
+
+	a, b := newTestNode(), newTestNode()
+	a.addTip(common.HexToHash("0x01"))
+	b.addTip(common.HexToHash("0x02"))
+	b.addTip(common.HexToHash("0x03"))
+
+	if tips := a.pdb.GetParentsAsHash(); len(tips) != 1 || tips[0] != common.HexToHash("0x01") {
+		t.Fatalf("tips of node a: got %v, want [0x01]", tips)
+	}
+	if tips := b.pdb.GetParentsAsHash(); len(tips) != 2 {
+		t.Fatalf("tips of node b: got %v, want 2 tips", tips)
+	}
+}
+
+func TestSelectTipsPerNode(t *testing.T) {
+	t.Parallel()
+
+	a, b := newTestNode(), newTestNode()
+	a.addTip(common.HexToHash("0x01"))
+
+	parents, err := a.pdb.SelectTips(nil, DefaultTipPolicy)
+	if err != nil {
+		t.Fatalf("node a: %v", err)
+	}
+	if len(parents) != 1 || parents[0] != common.HexToHash("0x01") {
+		t.Fatalf("parents of node a: got %v, want [0x01]", parents)
+	}
+	if _, err := b.pdb.SelectTips(nil, DefaultTipPolicy); err != ErrNoCompatibleTip {
+		t.Fatalf("node b without tips: got error %v, want %v", err, ErrNoCompatibleTip)
+	}
+}
+
+func TestWitnessMemDBPerNode(t *testing.T) {
+	t.Parallel()
+
+	one, two, three := common.HexToAddress("0x01"), common.HexToAddress("0x02"), common.HexToAddress("0x03")
+	a, b := newTestNode(), newTestNode()
+	a.wdb.SaveWitnessList([]common.Address{one, two})
+	b.wdb.SaveWitnessList([]common.Address{one, two})
+
+	a.wdb.ReplaceWitness(two, three)
+	if !a.wdb.IsWitness(three) || a.wdb.IsWitness(two) {
+		t.Fatalf("witnesses of node a: got %v, want [0x01 0x03]", a.wdb.GetWitnessesAsHash())
+	}
+	if b.wdb.IsWitness(three) || !b.wdb.IsWitness(two) {
+		t.Fatalf("witnesses of node b: got %v, want [0x01 0x02]", b.wdb.GetWitnessesAsHash())
+	}
+}
+
+func TestVoteLockPerNode(t *testing.T) {
+	t.Parallel()
+
+	a, b := newTestNode(), newTestNode()
+	a.wdb.LockVote()
+	defer a.wdb.UnlockVote()
+
+	locked := make(chan struct{})
+	go func() {
+		b.wdb.LockVote()
+		b.wdb.UnlockVote()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("vote of node b blocked by the vote of node a")
+	}
+}
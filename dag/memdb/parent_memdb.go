@@ -1,41 +1,25 @@
 package memdb
 
 import (
-	"github.com/babyboy/leveldb"
+	"babyboy-dag/boydb"
 	"github.com/babyboy/common"
 	"github.com/babyboy/common/ds"
-	"sync"
 )
 
-var PmDb *ParentMemDB
-var oncePmDb sync.Once
-
-// 获取父节点存储实例
-func GetParentMemDBInstance() *ParentMemDB {
-	oncePmDb.Do(func() {
-		if PmDb == nil {
-			PmDb = NewParentMemDB()
-		}
-	})
-	return PmDb
-}
-
 type ParentMemDB struct {
 	db        *boydb.DatabaseManager
 	parentSet *ds.HashSet
 }
 
 //新建一个ParentMemDB
-func NewParentMemDB() *ParentMemDB {
-	db := &boydb.DatabaseManager{}
+func NewParentMemDB(db *boydb.DatabaseManager) *ParentMemDB {
 	parentSet := ds.NewHashSet()
 	return &ParentMemDB{db, parentSet}
 }
 
-//初始化ParentMemDB
-func (pdb *ParentMemDB) InitParentMemDB(db *boydb.DatabaseManager) {
-	pdb.db = db
-	pdb.parentSet.ListInsert(db.GetParentsList())
+//初始化ParentMemDB, 数据库打开后从数据库加载
+func (pdb *ParentMemDB) InitParentMemDB() {
+	pdb.parentSet.ListInsert(pdb.db.GetParentsList())
 }
 
 // ***父单元存储相关函数*** //
@@ -74,28 +58,7 @@ func (pdb *ParentMemDB) GetParentsAsString() []string {
 	return pdb.parentSet.GetAllHashAsString()
 }
 
-// 获取符合与单元见证列表冲突不超过1个的父节点列表
-func (pdb *ParentMemDB) GetUnitParentListAsHash(witnessList []common.Address) []common.Hash {
-
-	parents := pdb.parentSet.GetAllHash()
-	witnessSet := ds.NewAddressSet()
-	witnessSet.ListInsert(witnessList)
-	parentList := make([]common.Hash, 0)
-	//遍历父节点的见证人列表，检查是否不超过一个冲突
-	for _, parent := range parents {
-		tUnit, _ := pdb.db.GetUnitByHash(parent)
-		count := 0
-		for _, witness := range tUnit.WitnessList {
-			if !witnessSet.Exists(witness) {
-				count++
-				if count > 1 {
-					break
-				}
-			}
-		}
-		if count <= 1 {
-			parentList = append(parentList, parent)
-		}
-	}
-	return parentList
+// 获取符合与单元见证列表冲突不超过1个的父节点列表, 按默认策略选择
+func (pdb *ParentMemDB) GetUnitParentListAsHash(witnessList []common.Address) ([]common.Hash, error) {
+	return pdb.SelectTips(witnessList, DefaultTipPolicy)
 }
@@ -0,0 +1,155 @@
+package memdb
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/babyboy/common"
+	"github.com/babyboy/core/types"
+)
+
+// 每个单元默认最多引用的父单元个数
+const DefaultMaxParents = 16
+
+// 每个单元默认至少引用的最老的tip个数
+const DefaultOldestTips = 2
+
+// 新单元选择父单元(tip)的策略
+type TipPolicy struct {
+	// 最多引用的父单元个数, 0 表示 DefaultMaxParents
+	MaxParents int
+
+	// 与单元见证人列表允许相差的见证人个数
+	MaxWitnessMutations int
+
+	// 是否引用无效单元
+	IncludeInvalid bool
+
+	// 先于见证级别最高的tip选取的最老的tip个数, 0 表示 DefaultOldestTips,
+	// 避免级别低的tip一直不被引用
+	OldestTips int
+}
+
+// 默认的父单元选择策略
+var DefaultTipPolicy = TipPolicy{
+	MaxParents:          DefaultMaxParents,
+	MaxWitnessMutations: 1,
+	OldestTips:          DefaultOldestTips,
+}
+
+// 按策略为新单元选择父单元
+//
+//  1. 排除无效单元和见证人列表不兼容的单元
+//  2. 先取级别最低的 OldestTips 个, 其余按见证级别, 级别从高到低, 相同时按hash从小到大排序
+//  3. 依次选取, 排除与已选单元花费同一输入的单元, 最多选 MaxParents 个
+//  4. 结果按hash从小到大排序, 相同的tip集合总是得到相同的父单元列表
+//
+// 没有可以引用的tip时返回 ErrNoCompatibleTip.
+func (pdb *ParentMemDB) SelectTips(witnessList []common.Address, policy TipPolicy) ([]common.Hash, error) {
+	maxParents := policy.MaxParents
+	if maxParents <= 0 {
+		maxParents = DefaultMaxParents
+	}
+	oldest := policy.OldestTips
+	if oldest <= 0 {
+		oldest = DefaultOldestTips
+	}
+	if oldest > maxParents {
+		oldest = maxParents
+	}
+
+	candidates := make(types.Units, 0)
+	for _, tip := range pdb.GetParentsAsHash() {
+		unit, err := pdb.db.GetUnitByHash(tip)
+		if err != nil {
+			continue
+		}
+		if unit.Invalid && !policy.IncludeInvalid {
+			continue
+		}
+		// 创世单元没有父单元, 总是兼容
+		if len(unit.ParentList) > 0 && !WitnessListsCompatible(unit.WitnessList, witnessList, policy.MaxWitnessMutations) {
+			continue
+		}
+		candidates = append(candidates, unit)
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoCompatibleTip
+	}
+	// 最老的tip排在最前面
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Level != candidates[j].Level {
+			return candidates[i].Level < candidates[j].Level
+		}
+		return candidates[i].Hash.String() < candidates[j].Hash.String()
+	})
+	if oldest > len(candidates) {
+		oldest = len(candidates)
+	}
+	rest := candidates[oldest:]
+	sort.Slice(rest, func(i, j int) bool {
+		if rest[i].WitnessedLevel != rest[j].WitnessedLevel {
+			return rest[i].WitnessedLevel > rest[j].WitnessedLevel
+		}
+		if rest[i].Level != rest[j].Level {
+			return rest[i].Level > rest[j].Level
+		}
+		return rest[i].Hash.String() < rest[j].Hash.String()
+	})
+
+	spent := make(map[string]bool)
+	parents := make([]common.Hash, 0, maxParents)
+	for _, unit := range candidates {
+		if len(parents) >= maxParents {
+			break
+		}
+		inputs := spentInputs(unit)
+		conflict := false
+		for _, key := range inputs {
+			if spent[key] {
+				conflict = true
+				break
+			}
+		}
+		if conflict {
+			continue
+		}
+		for _, key := range inputs {
+			spent[key] = true
+		}
+		parents = append(parents, unit.Hash)
+	}
+	sort.Slice(parents, func(i, j int) bool {
+		return parents[i].String() < parents[j].String()
+	})
+	return parents, nil
+}
+
+// 两个见证人列表长度相同, 并且 list 中最多有 maxMutations 个见证人不在 other 中
+func WitnessListsCompatible(list, other []common.Address, maxMutations int) bool {
+	if len(list) != len(other) {
+		return false
+	}
+	otherSet := make(map[common.Address]bool, len(other))
+	for _, witness := range other {
+		otherSet[witness] = true
+	}
+	mutations := 0
+	for _, witness := range list {
+		if !otherSet[witness] {
+			mutations++
+		}
+	}
+	return mutations <= maxMutations
+}
+
+// 单元花费的所有输入
+func spentInputs(unit types.Unit) []string {
+	keys := make([]string, 0)
+	for _, message := range unit.Messages {
+		for _, input := range message.Payload.Inputs {
+			keys = append(keys, fmt.Sprintf("%s_%d_%d", input.UnitHash.String(), input.MessageIndex, input.OutputIndex))
+		}
+	}
+	return keys
+}
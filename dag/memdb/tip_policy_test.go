@@ -0,0 +1,208 @@
+package memdb
+
+import (
+	"testing"
+
+	"github.com/babyboy/common"
+	"github.com/babyboy/core/types"
+)
+
+var tipWitnesses = []common.Address{common.HexToAddress("0x01"), common.HexToAddress("0x02"), common.HexToAddress("0x03")}
+
+// testTip describes a tip of the DAG for SelectTips
+type testTip struct {
+	hash      byte
+	level     int64
+	witnessed int64
+	witnesses []common.Address // tipWitnesses if nil
+	genesis   bool             // No parents, compatible with any witness list
+	invalid   bool
+	input     byte // Unit hash of the spent output, 0 if none
+}
+
+func (n *testNode) addTips(tips []testTip) {
+	for _, tip := range tips {
+		unit := types.NewEmptyUnit()
+		unit.Hash = common.BytesToHash([]byte{tip.hash})
+		unit.Level = tip.level
+		unit.WitnessedLevel = tip.witnessed
+		unit.WitnessList = tip.witnesses
+		if unit.WitnessList == nil {
+			unit.WitnessList = tipWitnesses
+		}
+		if !tip.genesis {
+			unit.ParentList = []common.Hash{common.HexToHash("0xee")}
+		}
+		unit.Invalid = tip.invalid
+		if tip.input != 0 {
+			input := types.NewInput(common.BytesToHash([]byte{tip.input}), 0, 0, "", types.Output{})
+			unit.Messages = types.Messages{{Payload: types.Payload{Inputs: types.Inputs{input}}}}
+		}
+		n.db.SaveUnitToDb(unit)
+		n.pdb.SaveParent(unit.Hash)
+	}
+}
+
+func TestSelectTips(t *testing.T) {
+	t.Parallel()
+
+	// Two mutations from tipWitnesses
+	other := []common.Address{common.HexToAddress("0x04"), common.HexToAddress("0x05"), tipWitnesses[2]}
+	// One mutation from tipWitnesses
+	mutated := []common.Address{common.HexToAddress("0x04"), tipWitnesses[1], tipWitnesses[2]}
+
+	tests := []struct {
+		name   string
+		tips   []testTip
+		policy TipPolicy
+		want   []byte // Hashes of the selected tips, in hash order
+	}{
+		{
+			name:   "max parents",
+			tips:   []testTip{{hash: 1, level: 1}, {hash: 2, level: 2, witnessed: 4}, {hash: 3, level: 2, witnessed: 3}, {hash: 4, level: 2, witnessed: 2}, {hash: 5, level: 2, witnessed: 1}},
+			policy: TipPolicy{MaxParents: 3, OldestTips: 1, MaxWitnessMutations: 1},
+			want:   []byte{1, 2, 3},
+		},
+		{
+			name:   "oldest tips first",
+			tips:   []testTip{{hash: 1, level: 9, witnessed: 5}, {hash: 2, level: 9, witnessed: 6}, {hash: 3, level: 2}, {hash: 4, level: 1}, {hash: 5, level: 3}},
+			policy: TipPolicy{MaxParents: 3, OldestTips: 2, MaxWitnessMutations: 1},
+			want:   []byte{2, 3, 4},
+		},
+		{
+			name:   "default oldest tips",
+			tips:   []testTip{{hash: 1, level: 9, witnessed: 5}, {hash: 2, level: 9, witnessed: 6}, {hash: 3, level: 2}, {hash: 4, level: 1}, {hash: 5, level: 3}},
+			policy: TipPolicy{MaxParents: 3, MaxWitnessMutations: 1},
+			want:   []byte{2, 3, 4},
+		},
+		{
+			name:   "oldest tips capped by max parents",
+			tips:   []testTip{{hash: 1, level: 9, witnessed: 5}, {hash: 2, level: 2}, {hash: 3, level: 1}},
+			policy: TipPolicy{MaxParents: 1, OldestTips: 2, MaxWitnessMutations: 1},
+			want:   []byte{3},
+		},
+		{
+			name:   "same level oldest tips by hash",
+			tips:   []testTip{{hash: 3, level: 1}, {hash: 1, level: 1}, {hash: 2, level: 1}},
+			policy: TipPolicy{MaxParents: 2, OldestTips: 2, MaxWitnessMutations: 1},
+			want:   []byte{1, 2},
+		},
+		{
+			name:   "incompatible witness list",
+			tips:   []testTip{{hash: 1, level: 1, witnesses: other}, {hash: 2, level: 2, witnesses: mutated}, {hash: 3, level: 3}},
+			policy: DefaultTipPolicy,
+			want:   []byte{2, 3},
+		},
+		{
+			name:   "incompatible genesis",
+			tips:   []testTip{{hash: 1, genesis: true, witnesses: other}},
+			policy: DefaultTipPolicy,
+			want:   []byte{1},
+		},
+		{
+			name:   "invalid tip",
+			tips:   []testTip{{hash: 1, level: 1, invalid: true}, {hash: 2, level: 2}},
+			policy: DefaultTipPolicy,
+			want:   []byte{2},
+		},
+		{
+			name:   "invalid tip included",
+			tips:   []testTip{{hash: 1, level: 1, invalid: true}, {hash: 2, level: 2}},
+			policy: TipPolicy{IncludeInvalid: true, MaxWitnessMutations: 1},
+			want:   []byte{1, 2},
+		},
+		{
+			name:   "conflicting inputs",
+			tips:   []testTip{{hash: 1, level: 5, witnessed: 1, input: 9}, {hash: 2, level: 5, witnessed: 2, input: 9}, {hash: 3, level: 1}, {hash: 4, level: 2}},
+			policy: TipPolicy{MaxParents: 4, OldestTips: 2, MaxWitnessMutations: 1},
+			want:   []byte{2, 3, 4},
+		},
+		{
+			name:   "conflict with an oldest tip",
+			tips:   []testTip{{hash: 1, level: 1, input: 9}, {hash: 2, level: 5, witnessed: 5, input: 9}, {hash: 3, level: 5, witnessed: 4}},
+			policy: TipPolicy{MaxParents: 2, OldestTips: 1, MaxWitnessMutations: 1},
+			want:   []byte{1, 3},
+		},
+	}
+	for _, test := range tests {
+		n := newTestNode()
+		n.addTips(test.tips)
+
+		parents, err := n.pdb.SelectTips(tipWitnesses, test.policy)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		want := make([]common.Hash, len(test.want))
+		for i, hash := range test.want {
+			want[i] = common.BytesToHash([]byte{hash})
+		}
+		if !equalHashes(parents, want) {
+			t.Errorf("%s: got parents %v, want %v", test.name, parents, want)
+		}
+	}
+}
+
+func TestSelectTipsNoCompatibleTip(t *testing.T) {
+	t.Parallel()
+
+	n := newTestNode()
+	n.addTips([]testTip{{hash: 1, level: 1, invalid: true}, {hash: 2, level: 1, witnesses: tipWitnesses[:2]}})
+	if _, err := n.pdb.SelectTips(tipWitnesses, DefaultTipPolicy); err != ErrNoCompatibleTip {
+		t.Fatalf("got error %v, want %v", err, ErrNoCompatibleTip)
+	}
+}
+
+// Nodes with the same tips select the same parents, whatever order they
+// learned the tips in.
+func TestSelectTipsDeterministic(t *testing.T) {
+	t.Parallel()
+
+	tips := []testTip{
+		{hash: 1, level: 3, witnessed: 2, input: 9},
+		{hash: 2, level: 3, witnessed: 2, input: 9},
+		{hash: 3, level: 3, witnessed: 2},
+		{hash: 4, level: 1},
+		{hash: 5, level: 1},
+		{hash: 6, level: 4, witnessed: 2},
+	}
+	reversed := make([]testTip, len(tips))
+	for i, tip := range tips {
+		reversed[len(tips)-1-i] = tip
+	}
+	policy := TipPolicy{MaxParents: 4, OldestTips: 1, MaxWitnessMutations: 1}
+
+	a, b := newTestNode(), newTestNode()
+	a.addTips(tips)
+	b.addTips(reversed)
+	first, err := a.pdb.SelectTips(tipWitnesses, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		again, err := b.pdb.SelectTips(tipWitnesses, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalHashes(first, again) {
+			t.Fatalf("got parents %v, then %v", first, again)
+		}
+	}
+	for i := 1; i < len(first); i++ {
+		if first[i-1].String() >= first[i].String() {
+			t.Fatalf("parents %v not sorted by hash", first)
+		}
+	}
+}
+
+func equalHashes(a, b []common.Hash) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
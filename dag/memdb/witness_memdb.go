@@ -1,7 +1,7 @@
 package memdb
 
 import (
-	"github.com/babyboy/leveldb"
+	"babyboy-dag/boydb"
 	"github.com/babyboy/common"
 	"github.com/babyboy/common/ds"
 	"github.com/babyboy/config"
@@ -10,42 +10,48 @@ import (
 	"sync"
 )
 
-var WmDb *WitnessMemDB
-var onceWmDb sync.Once
-
-// 获取见证人存储实例
-func GetWitnessMemDBInstance() *WitnessMemDB {
-	onceWmDb.Do(func() {
-		if WmDb == nil {
-			WmDb = NewWitnessMemDB()
-		}
-	})
-	return WmDb
-}
-
 type WitnessMemDB struct {
 	db           *boydb.DatabaseManager     //数据库
 	witnessSet   *ds.AddressSet             //见证人集合
 	replaceRound int64                      //当前的替换完成的轮数
 	voteRound    int64                      //已存储的所有轮数
 	replaceMap   map[int64]types.VoteResult //替换的见证人结果的集合，只记录还未替换到的剩余几轮结果
+	voteMux      sync.Mutex                 //串行化计票, 每个节点的投票状态各自独立
 }
 
 // 新建一个WitnessMemDB
-func NewWitnessMemDB() *WitnessMemDB {
-	db := &boydb.DatabaseManager{}
+func NewWitnessMemDB(db *boydb.DatabaseManager) *WitnessMemDB {
 	witnessSet := ds.NewAddressSet()
-	return &WitnessMemDB{db, witnessSet, -1, -1, map[int64]types.VoteResult{}}
+	return &WitnessMemDB{
+		db:           db,
+		witnessSet:   witnessSet,
+		replaceRound: -1,
+		voteRound:    -1,
+		replaceMap:   map[int64]types.VoteResult{},
+	}
+}
+
+// 开始计票, 同一时间只有一个计票器处理稳定单元
+func (wdb *WitnessMemDB) LockVote() {
+	wdb.voteMux.Lock()
+}
+
+// 结束计票
+func (wdb *WitnessMemDB) UnlockVote() {
+	wdb.voteMux.Unlock()
 }
 
-// 初始化WitnessMemDB
-func (wdb *WitnessMemDB) InitWitnessMemDB(db *boydb.DatabaseManager) {
-	wdb.db = db
+// 初始化WitnessMemDB, 数据库打开后从数据库加载
+func (wdb *WitnessMemDB) InitWitnessMemDB() {
+	db := wdb.db
 	wdb.witnessSet.ListInsert(db.GetWitnessList())
 	wdb.voteRound, _ = db.GetVoteRound()
-	wdb.replaceRound = wdb.voteRound - config.Const_Stable_Rounds
-	for i := wdb.replaceRound - config.Const_Stable_Rounds; i < wdb.replaceRound; i++ {
-		wdb.replaceMap[i], _ = db.GetVoteResult(i)
+	wdb.replaceRound = replaceRoundOf(wdb.voteRound)
+	// 已计票但还未生效的结果
+	for i := wdb.replaceRound + 1; i <= wdb.voteRound; i++ {
+		if result, err := db.GetVoteResult(i); err == nil {
+			wdb.replaceMap[i] = result
+		}
 	}
 }
 
@@ -73,8 +79,16 @@ func (wdb *WitnessMemDB) DeleteWitness(witness common.Address) {
 func (wdb *WitnessMemDB) ReplaceWitness(oldWitness, newWitness common.Address) {
 	if wdb.witnessSet.Exists(oldWitness) {
 		wdb.DeleteWitness(oldWitness)
-		wdb.SaveWitness(oldWitness)
+		wdb.SaveWitness(newWitness)
+	}
+}
+
+// 是否是当前的见证人
+func (wdb *WitnessMemDB) IsWitness(address common.Address) bool {
+	if wdb.witnessSet.Empty() {
+		wdb.witnessSet.ListInsert(wdb.db.GetWitnessList())
 	}
+	return wdb.witnessSet.Exists(address)
 }
 
 // 获取见证人列表，哈希数组
@@ -93,11 +107,26 @@ func (wdb *WitnessMemDB) GetWitnessesAsString() []string {
 	return wdb.witnessSet.GetAllAddressAsString()
 }
 
+// 投票轮数对应的已生效的替换轮数, 还没有结果生效时为 -1
+func replaceRoundOf(voteRound int64) int64 {
+	if round := voteRound - config.Const_Stable_Rounds; round > -1 {
+		return round
+	}
+	return -1
+}
+
 // 存储最新的投票轮数
 func (wdb *WitnessMemDB) SaveVoteRound(round int64) {
 	wdb.voteRound = round
 	wdb.db.SaveVoteRound(round)
-	wdb.replaceRound = wdb.voteRound - config.Const_Stable_Rounds
+	wdb.replaceRound = replaceRoundOf(round)
+}
+
+// 在批次中存储最新的投票轮数, 内存中的状态立即更新
+func (wdb *WitnessMemDB) PutVoteRound(batch boydb.Putter, round int64) error {
+	wdb.voteRound = round
+	wdb.replaceRound = replaceRoundOf(round)
+	return wdb.db.PutVoteRound(batch, round)
 }
 
 // 获取最新的投票轮数
@@ -112,6 +141,12 @@ func (wdb *WitnessMemDB) SaveVoteResultByRound(round int64, result types.VoteRes
 
 }
 
+// 在批次中存储见证人替换结果, 内存中的状态立即更新
+func (wdb *WitnessMemDB) PutVoteResultByRound(batch boydb.Putter, round int64, result types.VoteResult) error {
+	wdb.replaceMap[round] = result
+	return wdb.db.PutVoteResult(batch, round, result)
+}
+
 // 获取见证人替换结果
 func (wdb *WitnessMemDB) GetVoteResultByRound(round int64) types.VoteResult {
 
@@ -124,16 +159,30 @@ func (wdb *WitnessMemDB) GetVoteResultByRound(round int64) types.VoteResult {
 	}
 }
 
-// 存储见证人替换结果
-func (wdb *WitnessMemDB) ReplaceWitnessByResult(result types.VoteResult) {
-	wdb.replaceMap[result.Round] = result
-	wdb.db.SaveVoteResult(result.Round, result)
-	if result.Round-config.Const_Stable_Rounds-wdb.voteRound == 1 {
-		wdb.ReplaceWitness(result.ReplacedWitness, result.VoteResult)
-		wdb.voteRound = result.Round - config.Const_Stable_Rounds
-	} else {
-		log.Println("replace witness err!", "  now round:", wdb.voteRound, "replace round:", result.Round)
+// 按投票结果在批次中替换见证人, 结果必须按轮次依次应用
+func (wdb *WitnessMemDB) ReplaceWitnessByResult(batch boydb.Batch, result types.VoteResult) error {
+	if result.Round-wdb.replaceRound != 1 {
+		log.Println("replace witness err!", "  now round:", wdb.replaceRound, "replace round:", result.Round)
+		return nil
 	}
+	if result.HasReplacement() && wdb.witnessSet.Exists(result.ReplacedWitness) {
+		if err := wdb.db.DeleteWitness(batch, result.ReplacedWitness); err != nil {
+			return err
+		}
+		if err := wdb.db.PutWitness(batch, result.VoteResult); err != nil {
+			return err
+		}
+		wdb.witnessSet.Remove(result.ReplacedWitness)
+		wdb.witnessSet.Insert(result.VoteResult)
+	}
+	wdb.replaceRound = result.Round
+	delete(wdb.replaceMap, result.Round)
+	return nil
+}
+
+// 获取已应用的替换结果的轮数
+func (wdb *WitnessMemDB) GetReplaceRound() int64 {
+	return wdb.replaceRound
 }
 
 // ******************* //
@@ -0,0 +1,89 @@
+package dag
+
+import (
+	"sort"
+
+	"babyboy-dag/boydb"
+	"github.com/babyboy/common"
+	"github.com/babyboy/core/types"
+	"github.com/babyboy/dag/memdb"
+)
+
+// 见证人替换的历史记录
+//
+// 投票结果按轮次保存, 已生效的替换可以按生效的主链序号倒推, 从而得到
+// 任意主链序号时的见证人列表, 用来按当时的见证人验证历史单元.
+type VoteHistory struct {
+	db  *boydb.DatabaseManager
+	wdb *memdb.WitnessMemDB
+}
+
+func NewVoteHistory(db *boydb.DatabaseManager, wdb *memdb.WitnessMemDB) *VoteHistory {
+	return &VoteHistory{db: db, wdb: wdb}
+}
+
+// 获取 [from, to] 轮的投票结果
+func (vh *VoteHistory) Rounds(from, to int64) []types.VoteResult {
+	results := make([]types.VoteResult, 0)
+	vh.db.IterateVoteResults(from, func(result types.VoteResult) bool {
+		if result.Round > to {
+			return false
+		}
+		results = append(results, result)
+		return true
+	})
+	return results
+}
+
+// 获取所有产生了替换的投票结果, 包括还未生效的
+func (vh *VoteHistory) Replacements() []types.VoteResult {
+	results := make([]types.VoteResult, 0)
+	vh.db.IterateVoteResults(0, func(result types.VoteResult) bool {
+		if result.HasReplacement() {
+			results = append(results, result)
+		}
+		return true
+	})
+	return results
+}
+
+// 获取某个见证人被替换的投票结果
+func (vh *VoteHistory) ReplacementOf(witness common.Address) (types.VoteResult, bool) {
+	var found types.VoteResult
+	ok := false
+	vh.db.IterateVoteResults(0, func(result types.VoteResult) bool {
+		if result.HasReplacement() && result.ReplacedWitness == witness {
+			found, ok = result, true
+			return false
+		}
+		return true
+	})
+	return found, ok
+}
+
+// 获取某个主链序号时生效的见证人列表
+func (vh *VoteHistory) WitnessListAt(mci int64) []common.Address {
+	// 从当前列表出发, 倒序撤销在该主链序号之后生效的替换
+	applied := vh.Rounds(0, vh.wdb.GetReplaceRound())
+
+	witnesses := make(map[common.Address]bool)
+	for _, witness := range vh.wdb.GetWitnessesAsHash() {
+		witnesses[witness] = true
+	}
+	for i := len(applied) - 1; i >= 0; i-- {
+		result := applied[i]
+		if !result.HasReplacement() || result.ActivateMCI <= mci {
+			continue
+		}
+		delete(witnesses, result.VoteResult)
+		witnesses[result.ReplacedWitness] = true
+	}
+	list := make([]common.Address, 0, len(witnesses))
+	for witness := range witnesses {
+		list = append(list, witness)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].String() < list[j].String()
+	})
+	return list
+}
@@ -0,0 +1,26 @@
+package dag
+
+import (
+	"github.com/babyboy/common"
+	"github.com/babyboy/dag/memdb"
+)
+
+// 见证人列表允许与最优父单元的列表相差的最多个数
+const MaxWitnessListMutations = 1
+
+// 两个见证人列表是否兼容: 长度相同并且最多相差 MaxWitnessListMutations 个见证人
+func WitnessListsCompatible(list, parentList []common.Address) bool {
+	return memdb.WitnessListsCompatible(list, parentList, MaxWitnessListMutations)
+}
+
+// 见证人列表中是否有重复的见证人
+func HasDuplicateWitness(list []common.Address) bool {
+	seen := make(map[common.Address]bool, len(list))
+	for _, witness := range list {
+		if seen[witness] {
+			return true
+		}
+		seen[witness] = true
+	}
+	return false
+}
@@ -22,10 +22,7 @@ type WitnessReplacer struct {
 	parentList     []common.Hash
 }
 
-func NewWitnessReplacer(timeStamp int64, round int64, voteResult common.Address, replaceWitness common.Address) *WitnessReplacer {
-	db := leveldb.GetDbInstance()
-	wdb := memdb.GetWitnessMemDBInstance()
-	pdb := memdb.GetParentMemDBInstance()
+func NewWitnessReplacer(db *leveldb.DatabaseManager, wdb *memdb.WitnessMemDB, pdb *memdb.ParentMemDB, timeStamp int64, round int64, voteResult common.Address, replaceWitness common.Address) *WitnessReplacer {
 	voteRound := wdb.GetVoteRound()
 	startTime := wdb.GetVoteResultByRound(voteRound).EndTime
 	endTime := timeStamp
@@ -0,0 +1,205 @@
+package dag
+
+import (
+	"log"
+	"sort"
+
+	"babyboy-dag/boydb"
+	"github.com/babyboy/common"
+	"github.com/babyboy/config"
+	"github.com/babyboy/core/types"
+	"github.com/babyboy/dag/memdb"
+)
+
+// 每一轮投票覆盖的主链序号个数
+const VoteRoundLength = 1000
+
+// 见证人替换的投票计票器
+//
+// 只根据稳定单元计票, 每个节点处理的稳定单元和顺序都相同, 所以结果也相同:
+//  1. 第r轮覆盖主链序号 [r*VoteRoundLength, (r+1)*VoteRoundLength)
+//  2. 非见证人在一轮中有至少 MinTradeRate 个有效稳定单元即成为候选人
+//  3. 第一个属于下一轮的稳定单元关闭本轮并计票: 活跃度最高的候选人
+//     替换活跃度最低的见证人 (相同时取地址较小者)
+//  4. 第r轮的结果在第 r+Const_Stable_Rounds 轮计票时生效, 即主链序号
+//     (r+1+Const_Stable_Rounds)*VoteRoundLength 稳定时所有节点一起切换
+type WitnessVoter struct {
+	db      *boydb.DatabaseManager
+	wdb     *memdb.WitnessMemDB
+	results map[int64]types.VoteResult // 本批次中关闭的轮次的结果
+}
+
+// 候选人信息
+type Candidate struct {
+	Address   common.Address `json:"address"`
+	Units     int64          `json:"units"`     // 本轮的有效稳定单元数
+	IsWitness bool           `json:"isWitness"` // 是否是当前的见证人
+	Eligible  bool           `json:"eligible"`  // 是否满足参选条件
+}
+
+func NewWitnessVoter(db *boydb.DatabaseManager, wdb *memdb.WitnessMemDB) *WitnessVoter {
+	return &WitnessVoter{db: db, wdb: wdb}
+}
+
+// 主链序号所在的投票轮数
+func VoteRoundOf(mci int64) int64 {
+	return mci / VoteRoundLength
+}
+
+// 处理新的稳定单元, 按主链序号和单元hash的顺序计入所在的轮次. 稳定单元和
+// 它们的球, 活跃度, 关闭的轮次的投票结果和见证人替换在同一批次中写入数据库
+func (wv *WitnessVoter) ApplyStableUnits(units types.Units) error {
+	wv.wdb.LockVote()
+	defer wv.wdb.UnlockVote()
+
+	sorted := make(types.Units, len(units))
+	copy(sorted, units)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].MainChainIndex != sorted[j].MainChainIndex {
+			return sorted[i].MainChainIndex < sorted[j].MainChainIndex
+		}
+		return sorted[i].Hash.String() < sorted[j].Hash.String()
+	})
+
+	batch := wv.db.NewBatch()
+	wv.results = make(map[int64]types.VoteResult)
+	defer func() { wv.results = nil }()
+
+	// 还未写入的活跃度, 计票时加到数据库中的活跃度上
+	pending := make(map[int64]map[common.Address]int64)
+	for _, unit := range sorted {
+		round := VoteRoundOf(unit.MainChainIndex)
+		for open := wv.wdb.GetVoteRound() + 1; open < round; open++ {
+			if err := wv.closeRound(batch, open, unit.TimeStamp, pending[open]); err != nil {
+				return err
+			}
+		}
+		if unit.Invalid || len(unit.Authors) == 0 {
+			continue
+		}
+		if pending[round] == nil {
+			pending[round] = make(map[common.Address]int64)
+		}
+		pending[round][unit.Authors[0].Address]++
+	}
+	if err := wv.db.PutStableUnitsActivity(batch, units, pending); err != nil {
+		return err
+	}
+	if err := wv.db.PutStableBalls(batch, units); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// 某一轮的投票结果, 包括本批次中还未写入的结果
+func (wv *WitnessVoter) voteResult(round int64) (types.VoteResult, bool) {
+	if result, ok := wv.results[round]; ok {
+		return result, true
+	}
+	result, err := wv.db.GetVoteResult(round)
+	return result, err == nil
+}
+
+// 关闭一轮投票: 计票, 并让 Const_Stable_Rounds 轮之前的结果生效
+func (wv *WitnessVoter) closeRound(batch boydb.Batch, round int64, endTime int64, pending map[common.Address]int64) error {
+	startTime := int64(0)
+	if previous, ok := wv.voteResult(round - 1); ok {
+		startTime = previous.EndTime
+	}
+	result := types.NewVoteResult(startTime, endTime, common.Address{}, common.Address{}, round)
+	result.StartMCI = round * VoteRoundLength
+	result.EndMCI = (round+1)*VoteRoundLength - 1
+	result.ActivateMCI = (round + 1 + config.Const_Stable_Rounds) * VoteRoundLength
+
+	if replaced, candidate, ok := wv.tally(round, pending); ok {
+		result.ReplacedWitness = replaced
+		result.VoteResult = candidate
+		log.Println("见证人替换投票: 第", round, "轮,", candidate.String(), "替换", replaced.String(), "生效于主链序号", result.ActivateMCI)
+	}
+
+	if activate := round - config.Const_Stable_Rounds; activate >= 0 {
+		if pending, ok := wv.voteResult(activate); ok {
+			if err := wv.wdb.ReplaceWitnessByResult(batch, pending); err != nil {
+				return err
+			}
+			if pending.HasReplacement() {
+				log.Println("见证人替换生效: ", pending.VoteResult.String(), "替换", pending.ReplacedWitness.String())
+			}
+		}
+	}
+	wv.results[round] = result
+	if err := wv.wdb.PutVoteResultByRound(batch, round, result); err != nil {
+		return err
+	}
+	return wv.wdb.PutVoteRound(batch, round)
+}
+
+// 计票, 返回被替换的见证人和当选的候选人
+func (wv *WitnessVoter) tally(round int64, pending map[common.Address]int64) (common.Address, common.Address, bool) {
+	// 已经当选或将被替换但还未生效的地址不参与本轮
+	busy := make(map[common.Address]bool)
+	for i := wv.wdb.GetReplaceRound() + 1; i < round; i++ {
+		if pending, ok := wv.voteResult(i); ok && pending.HasReplacement() {
+			busy[pending.VoteResult] = true
+			busy[pending.ReplacedWitness] = true
+		}
+	}
+
+	var (
+		replaced, elected  common.Address
+		minUnits, maxUnits int64
+		foundReplaced      bool
+		foundElected       bool
+	)
+	candidates := wv.candidates(round, pending)
+	for _, candidate := range candidates {
+		if busy[candidate.Address] {
+			continue
+		}
+		if candidate.IsWitness {
+			if !foundReplaced || candidate.Units < minUnits {
+				replaced, minUnits, foundReplaced = candidate.Address, candidate.Units, true
+			}
+		} else if candidate.Eligible {
+			if !foundElected || candidate.Units > maxUnits {
+				elected, maxUnits, foundElected = candidate.Address, candidate.Units, true
+			}
+		}
+	}
+	if !foundReplaced || !foundElected || maxUnits <= minUnits {
+		return common.Address{}, common.Address{}, false
+	}
+	return replaced, elected, true
+}
+
+// 某一轮的见证人和候选人的活跃度, 按地址排序
+func (wv *WitnessVoter) Candidates(round int64) []Candidate {
+	return wv.candidates(round, nil)
+}
+
+// 某一轮的候选人, 活跃度加上还未写入数据库的部分
+func (wv *WitnessVoter) candidates(round int64, pending map[common.Address]int64) []Candidate {
+	activity := wv.db.GetRoundActivity(round)
+	for address, units := range pending {
+		activity[address] += units
+	}
+	for _, witness := range wv.wdb.GetWitnessesAsHash() {
+		if _, ok := activity[witness]; !ok {
+			activity[witness] = 0
+		}
+	}
+	candidates := make([]Candidate, 0, len(activity))
+	for address, units := range activity {
+		isWitness := wv.wdb.IsWitness(address)
+		candidates = append(candidates, Candidate{
+			Address:   address,
+			Units:     units,
+			IsWitness: isWitness,
+			Eligible:  !isWitness && units >= int64(config.MinTradeRate),
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Address.String() < candidates[j].Address.String()
+	})
+	return candidates
+}
@@ -0,0 +1,192 @@
+package dag
+
+import (
+	"testing"
+
+	"babyboy-dag/boydb"
+	"github.com/babyboy/common"
+	"github.com/babyboy/config"
+	"github.com/babyboy/core/types"
+	"github.com/babyboy/dag/memdb"
+)
+
+var (
+	testWitnesses = []common.Address{common.HexToAddress("0x01"), common.HexToAddress("0x02"), common.HexToAddress("0x03")}
+	testCandidate = common.HexToAddress("0x10")
+)
+
+// voteTest feeds stable units to the witness voter of a fresh chain
+type voteTest struct {
+	db    *boydb.DatabaseManager
+	wdb   *memdb.WitnessMemDB
+	voter *WitnessVoter
+	seq   int
+}
+
+func newVoteTest() *voteTest {
+	db := boydb.NewDatabaseManager()
+	db.InitWithDatabase(boydb.NewMemDatabase())
+	wdb := memdb.NewWitnessMemDB(db)
+	wdb.InitWitnessMemDB()
+	wdb.SaveWitnessList(testWitnesses)
+	return &voteTest{db: db, wdb: wdb, voter: NewWitnessVoter(db, wdb)}
+}
+
+// units returns count stable units of author at the given main chain index
+func (vt *voteTest) units(mci int64, author common.Address, count int) types.Units {
+	units := make(types.Units, count)
+	for i := range units {
+		vt.seq++
+		unit := types.NewEmptyUnit()
+		unit.Hash = common.BytesToHash([]byte{byte(vt.seq >> 8), byte(vt.seq)})
+		unit.MainChainIndex = mci
+		unit.TimeStamp = mci
+		unit.IsStable = true
+		unit.Authors = types.Authors{types.NewAuthor(author, nil)}
+		units[i] = unit
+	}
+	return units
+}
+
+func (vt *voteTest) apply(t *testing.T, units types.Units) {
+	if err := vt.voter.ApplyStableUnits(units); err != nil {
+		t.Fatalf("applying stable units: %v", err)
+	}
+}
+
+// replaceThird makes the candidate outvote the third witness in round 0
+func (vt *voteTest) replaceThird(t *testing.T) {
+	var units types.Units
+	units = append(units, vt.units(0, testWitnesses[0], 2)...)
+	units = append(units, vt.units(1, testWitnesses[1], 2)...)
+	units = append(units, vt.units(2, testCandidate, int(config.MinTradeRate)+1)...)
+	vt.apply(t, units)
+}
+
+func TestFreshChainReplaceRound(t *testing.T) {
+	t.Parallel()
+
+	vt := newVoteTest()
+	if round := vt.wdb.GetReplaceRound(); round != -1 {
+		t.Fatalf("replace round of a fresh chain: got %d, want -1", round)
+	}
+}
+
+func TestWitnessReplacement(t *testing.T) {
+	t.Parallel()
+
+	vt := newVoteTest()
+	vt.replaceThird(t)
+
+	// Round r is closed by the first unit of round r+1, the result of round 0
+	// activates when round Const_Stable_Rounds is closed
+	for round := int64(1); round <= config.Const_Stable_Rounds; round++ {
+		vt.apply(t, vt.units(round*VoteRoundLength, testWitnesses[0], 1))
+		if !vt.wdb.IsWitness(testWitnesses[2]) || vt.wdb.IsWitness(testCandidate) {
+			t.Fatalf("witnesses after closing round %d: got %v, replacement activated early", round-1, vt.wdb.GetWitnessesAsHash())
+		}
+	}
+	result := vt.wdb.GetVoteResultByRound(0)
+	if result.ReplacedWitness != testWitnesses[2] || result.VoteResult != testCandidate {
+		t.Fatalf("result of round 0: got %v replaced by %v, want %v replaced by %v", result.ReplacedWitness, result.VoteResult, testWitnesses[2], testCandidate)
+	}
+
+	vt.apply(t, vt.units((config.Const_Stable_Rounds+1)*VoteRoundLength, testWitnesses[0], 1))
+	if vt.wdb.IsWitness(testWitnesses[2]) || !vt.wdb.IsWitness(testCandidate) {
+		t.Fatalf("witnesses after activation: got %v, want %v replaced by %v", vt.wdb.GetWitnessesAsHash(), testWitnesses[2], testCandidate)
+	}
+	if round := vt.wdb.GetReplaceRound(); round != 0 {
+		t.Fatalf("replace round after activation: got %d, want 0", round)
+	}
+
+	// The swap, the vote round and the activity were written together
+	reloaded := memdb.NewWitnessMemDB(vt.db)
+	reloaded.InitWitnessMemDB()
+	if reloaded.IsWitness(testWitnesses[2]) || !reloaded.IsWitness(testCandidate) {
+		t.Fatalf("stored witnesses: got %v, want %v replaced by %v", reloaded.GetWitnessesAsHash(), testWitnesses[2], testCandidate)
+	}
+	if round := reloaded.GetVoteRound(); round != config.Const_Stable_Rounds {
+		t.Fatalf("stored vote round: got %d, want %d", round, config.Const_Stable_Rounds)
+	}
+	if units := vt.db.GetRoundActivity(0)[testCandidate]; units != int64(config.MinTradeRate)+1 {
+		t.Fatalf("stored activity of the candidate: got %d, want %d", units, int64(config.MinTradeRate)+1)
+	}
+}
+
+func TestTally(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		candidate int // stable units of the candidate in round 0
+		witness   int // stable units of every witness in round 0
+		replaced  bool
+	}{
+		{name: "no candidate", candidate: 0, witness: 1, replaced: false},
+		{name: "below the trade rate", candidate: int(config.MinTradeRate) - 1, witness: 0, replaced: false},
+		{name: "not more active than the witnesses", candidate: int(config.MinTradeRate), witness: int(config.MinTradeRate), replaced: false},
+		{name: "more active than a witness", candidate: int(config.MinTradeRate) + 1, witness: 1, replaced: true},
+	}
+	for _, test := range tests {
+		vt := newVoteTest()
+		var units types.Units
+		units = append(units, vt.units(1, testCandidate, test.candidate)...)
+		for _, witness := range testWitnesses {
+			units = append(units, vt.units(2, witness, test.witness)...)
+		}
+		vt.apply(t, units)
+		vt.apply(t, vt.units(VoteRoundLength, testWitnesses[0], 1))
+
+		result := vt.wdb.GetVoteResultByRound(0)
+		if result.HasReplacement() != test.replaced {
+			t.Errorf("%s: got replacement %v, want %v", test.name, result.HasReplacement(), test.replaced)
+			continue
+		}
+		// Witnesses with equal activity are replaced in address order
+		if test.replaced && (result.VoteResult != testCandidate || result.ReplacedWitness != testWitnesses[0]) {
+			t.Errorf("%s: got %v replaced by %v, want %v replaced by %v", test.name, result.ReplacedWitness, result.VoteResult, testWitnesses[0], testCandidate)
+		}
+	}
+}
+
+func TestVoteHistory(t *testing.T) {
+	t.Parallel()
+
+	vt := newVoteTest()
+	vt.replaceThird(t)
+	for round := int64(1); round <= config.Const_Stable_Rounds+1; round++ {
+		vt.apply(t, vt.units(round*VoteRoundLength, testWitnesses[0], 1))
+	}
+	vh := NewVoteHistory(vt.db, vt.wdb)
+
+	if rounds := vh.Rounds(0, config.Const_Stable_Rounds); int64(len(rounds)) != config.Const_Stable_Rounds+1 {
+		t.Fatalf("rounds: got %d results, want %d", len(rounds), config.Const_Stable_Rounds+1)
+	}
+	if replacements := vh.Replacements(); len(replacements) != 1 || replacements[0].Round != 0 {
+		t.Fatalf("replacements: got %v, want the one of round 0", replacements)
+	}
+	result, ok := vh.ReplacementOf(testWitnesses[2])
+	if !ok {
+		t.Fatal("no replacement of the third witness")
+	}
+	if _, ok := vh.ReplacementOf(testWitnesses[0]); ok {
+		t.Fatal("replacement of a witness that was not replaced")
+	}
+
+	contains := func(list []common.Address, address common.Address) bool {
+		for _, a := range list {
+			if a == address {
+				return true
+			}
+		}
+		return false
+	}
+	before := vh.WitnessListAt(result.ActivateMCI - 1)
+	if !contains(before, testWitnesses[2]) || contains(before, testCandidate) {
+		t.Fatalf("witnesses before activation: got %v", before)
+	}
+	after := vh.WitnessListAt(result.ActivateMCI)
+	if contains(after, testWitnesses[2]) || !contains(after, testCandidate) {
+		t.Fatalf("witnesses at activation: got %v", after)
+	}
+}
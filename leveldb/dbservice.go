@@ -3,43 +3,40 @@ package leveldb
 import (
 	"encoding/json"
 	"log"
-	"strings"
-	"sync"
+	"sort"
 
 	"github.com/babyboy/common"
 	"github.com/babyboy/config"
 	"github.com/babyboy/core/types"
-	"strconv"
 )
 
-var DbMgr *DatabaseManager
-var once sync.Once
-
-func GetDbInstance() *DatabaseManager {
-	once.Do(func() {
-		if DbMgr == nil {
-			DbMgr = &DatabaseManager{}
-		}
-	})
-	return DbMgr
+// 新建一个数据库管理实例, 每个节点一个, 由 InitDatabase 打开
+func NewDatabaseManager() *DatabaseManager {
+	return &DatabaseManager{}
 }
 
 type DatabaseManager struct {
 	config.DataBaseConfig
-	db *LDBDatabase
+	db IteratorDatabase
 }
 
-// Init DataBase
-func (dbm *DatabaseManager) InitDatabase(dbPath string) error {
-	var err error
-	if dbm.db, err = dbm.OpenDatabase(dbPath, 0, 0); err != nil {
+// Init DataBase, cache (in megabytes) and handles are handed to leveldb as is
+func (dbm *DatabaseManager) InitDatabase(dbPath string, cache int, handles int) error {
+	db, err := dbm.OpenDatabase(dbPath, cache, handles)
+	if err != nil {
 		log.Fatal(err)
 		return err
 	}
+	dbm.db = db
 
 	return nil
 }
 
+// 使用已打开的数据库, 例如内存数据库 MemDatabase
+func (dbm *DatabaseManager) InitWithDatabase(db IteratorDatabase) {
+	dbm.db = db
+}
+
 // OpenDatabase
 func (dbm *DatabaseManager) OpenDatabase(path string, cache int, handles int) (*LDBDatabase, error) {
 	// Zhangxuesong TODO 检测一下 DataDir
@@ -51,7 +48,11 @@ func (dbm *DatabaseManager) OpenDatabase(path string, cache int, handles int) (*
 }
 
 func (dbm *DatabaseManager) Delete(key string) {
-	err := dbm.db.Delete([]byte(key))
+	dbm.delete([]byte(key))
+}
+
+func (dbm *DatabaseManager) delete(key []byte) {
+	err := dbm.db.Delete(key)
 	if err != nil {
 		log.Println(err)
 	}
@@ -61,16 +62,17 @@ func (dbm *DatabaseManager) CloseDb() {
 	dbm.db.Close()
 }
 
-// 存储创世单元
-func (dbm *DatabaseManager) SaveGenisisUnit(unit interface{}) error {
+// 存储创世单元, 键为配置的创世文件生成的单元哈希
+func (dbm *DatabaseManager) SaveGenisisUnit(unit types.Unit) error {
 	batch := dbm.db.NewBatch()
 	jsonUnit, err := json.Marshal(unit)
 	if err != nil {
 		log.Fatalln(err)
 		return err
 	}
-	keyUnit := strings.Join([]string{"unit.", config.GENISIS_UNIT_HASH}, "")
-	batch.Put([]byte(keyUnit), jsonUnit)
+	batch.Put(unitKey(unit.Hash), jsonUnit)
+	// 创世单元的球没有父球, 之后稳定单元的球都由它推出
+	batch.Put(ballKey(unit.Hash), types.Ball2Byte(types.NewBall(unit.Hash, []common.Hash{}, false)))
 	batch.Write()
 
 	return nil
@@ -80,8 +82,7 @@ func (dbm *DatabaseManager) SaveGenisisUnit(unit interface{}) error {
 func (dbm *DatabaseManager) SaveUnitToDb(unit types.Unit) {
 	batch := dbm.db.NewBatch()
 
-	keyUnit := strings.Join([]string{config.ConstDBUnitPrefix, unit.Hash.String()}, "")
-	batch.Put([]byte(keyUnit), types.Unit2Byte(unit))
+	batch.Put(unitKey(unit.Hash), types.Unit2Byte(unit))
 	batch.Write()
 }
 
@@ -89,8 +90,7 @@ func (dbm *DatabaseManager) SaveUnitToDb(unit types.Unit) {
 func (dbm *DatabaseManager) DelUnitFromDb(unit types.Unit) {
 	batch := dbm.db.NewBatch()
 
-	keyUnit := strings.Join([]string{config.ConstDBUnitPrefix, unit.Hash.String()}, "")
-	batch.Delete([]byte(keyUnit))
+	batch.Delete(unitKey(unit.Hash))
 	batch.Write()
 }
 
@@ -98,27 +98,22 @@ func (dbm *DatabaseManager) DelUnitFromDb(unit types.Unit) {
 func (dbm *DatabaseManager) SaveUnitsToDb(units types.Units) {
 	batch := dbm.db.NewBatch()
 	for _, unit := range units {
-		keyUnit := strings.Join([]string{config.ConstDBUnitPrefix, unit.Hash.String()}, "")
-		batch.Put([]byte(keyUnit), types.Unit2Byte(unit))
+		batch.Put(unitKey(unit.Hash), types.Unit2Byte(unit))
 	}
 	batch.Write()
 }
 
 // 获取单元
 func (dbm *DatabaseManager) GetUnitByHash(unitHash common.Hash) (types.Unit, error) {
-	keyUnit := strings.Join([]string{config.ConstDBUnitPrefix, unitHash.String()}, "")
-	readData, err := dbm.db.Get([]byte(keyUnit))
+	readData, err := dbm.db.Get(unitKey(unitHash))
 	unit := types.Byte2Unit(readData)
 
 	return unit, err
 }
 
-// 在pending池中是否存在一笔UTXO
+// 数据库中是否存在单元
 func (dbm *DatabaseManager) IsExistUnit(unitHash common.Hash) bool {
-	unSpentKey := strings.Join([]string{config.ConstDBUnitPrefix, unitHash.String()}, "")
-	it := dbm.db.NewIteratorWithPrefix([]byte(unSpentKey))
-	isExist := it.Seek([]byte(""))
-
+	isExist, _ := dbm.db.Has(unitKey(unitHash))
 	return isExist
 }
 
@@ -126,8 +121,7 @@ func (dbm *DatabaseManager) IsExistUnit(unitHash common.Hash) bool {
 func (dbm *DatabaseManager) SaveBallToDb(ball types.Ball) {
 	batch := dbm.db.NewBatch()
 
-	keyBall := strings.Join([]string{config.ConstDBBallPrefix, ball.StringKey()}, "")
-	batch.Put([]byte(keyBall), types.Ball2Byte(ball))
+	batch.Put(ballKey(ball.HashKey()), types.Ball2Byte(ball))
 	batch.Write()
 }
 
@@ -135,16 +129,14 @@ func (dbm *DatabaseManager) SaveBallToDb(ball types.Ball) {
 func (dbm *DatabaseManager) SaveBallsToDb(balls types.Balls) {
 	batch := dbm.db.NewBatch()
 	for _, ball := range balls {
-		keyBall := strings.Join([]string{config.ConstDBBallPrefix, ball.StringKey()}, "")
-		batch.Put([]byte(keyBall), types.Ball2Byte(ball))
+		batch.Put(ballKey(ball.HashKey()), types.Ball2Byte(ball))
 	}
 	batch.Write()
 }
 
 // 获取球
 func (dbm *DatabaseManager) GetBallByHash(ballHash common.Hash) (types.Ball, error) {
-	keyBall := strings.Join([]string{config.ConstDBBallPrefix, ballHash.String()}, "")
-	readData, err := dbm.db.Get([]byte(keyBall))
+	readData, err := dbm.db.Get(ballKey(ballHash))
 	ball := types.Byte2Ball(readData)
 
 	return ball, err
@@ -152,11 +144,9 @@ func (dbm *DatabaseManager) GetBallByHash(ballHash common.Hash) (types.Ball, err
 
 func (dbm *DatabaseManager) GetAllBalls() (types.Balls, error) {
 	var allBalls types.Balls
-	key := strings.Join([]string{config.ConstDBBallPrefix}, "")
-	it := dbm.db.NewIteratorWithPrefix([]byte(key))
+	it := dbm.db.NewIteratorWithPrefix(ballPrefix)
 	it.Seek([]byte(""))
 	for it.Valid() {
-		log.Println(string(it.Key()))
 		var msg types.Ball
 		json.Unmarshal(it.Value(), &msg)
 		allBalls = append(allBalls, msg)
@@ -171,8 +161,7 @@ func (dbm *DatabaseManager) SaveParentsList(parentsList []common.Hash) {
 	batch := dbm.db.NewBatch()
 
 	for _, val := range parentsList {
-		key := strings.Join([]string{config.ConstDBParentListPrefix, val.String()}, "")
-		batch.Put([]byte(key), val.Bytes())
+		batch.Put(parentKey(val), val.Bytes())
 	}
 	batch.Write()
 }
@@ -180,7 +169,7 @@ func (dbm *DatabaseManager) SaveParentsList(parentsList []common.Hash) {
 // 获取单元列表
 func (dbm *DatabaseManager) GetParentsList() []common.Hash {
 	parentsList := make([]common.Hash, 0)
-	it := dbm.db.NewIteratorWithPrefix([]byte(config.ConstDBParentListPrefix))
+	it := dbm.db.NewIteratorWithPrefix(parentPrefix)
 	it.Seek([]byte(""))
 	for it.Valid() {
 		value := it.Value()
@@ -194,24 +183,21 @@ func (dbm *DatabaseManager) GetParentsList() []common.Hash {
 func (dbm *DatabaseManager) SaveParent(hash common.Hash) {
 	batch := dbm.db.NewBatch()
 
-	key := strings.Join([]string{config.ConstDBParentListPrefix, hash.String()}, "")
-	batch.Put([]byte(key), hash.Bytes())
+	batch.Put(parentKey(hash), hash.Bytes())
 
 	batch.Write()
 }
 
 // 删除指定父单元
 func (dbm *DatabaseManager) DelParent(hash common.Hash) {
-	parent := strings.Join([]string{config.ConstDBParentListPrefix, hash.String()}, "")
-	dbm.Delete(parent)
+	dbm.delete(parentKey(hash))
 }
 
 // 存储见证人列表
 func (dbm *DatabaseManager) SaveWitnessList(witnesses []common.Address) {
 	batch := dbm.db.NewBatch()
 	for _, witness := range witnesses {
-		wit := strings.Join([]string{config.ConstDBWitnessListPrefix, witness.String()}, "")
-		batch.Put([]byte(wit), witness.Bytes())
+		batch.Put(witnessKey(witness), witness.Bytes())
 	}
 	batch.Write()
 }
@@ -219,7 +205,7 @@ func (dbm *DatabaseManager) SaveWitnessList(witnesses []common.Address) {
 // 获取见证人列表
 func (dbm *DatabaseManager) GetWitnessList() []common.Address {
 	witnessList := make([]common.Address, 0)
-	it := dbm.db.NewIteratorWithPrefix([]byte(config.ConstDBWitnessListPrefix))
+	it := dbm.db.NewIteratorWithPrefix(witnessPrefix)
 	it.Seek([]byte(""))
 	for it.Valid() {
 		value := it.Value()
@@ -233,24 +219,31 @@ func (dbm *DatabaseManager) GetWitnessList() []common.Address {
 func (dbm *DatabaseManager) SaveWitness(hash common.Address) {
 	batch := dbm.db.NewBatch()
 
-	key := strings.Join([]string{config.ConstDBWitnessListPrefix, hash.String()}, "")
-	batch.Put([]byte(key), hash.Bytes())
+	batch.Put(witnessKey(hash), hash.Bytes())
 
 	batch.Write()
 }
 
 // 删除指定见证人
 func (dbm *DatabaseManager) DelWitness(hash common.Address) {
-	witness := strings.Join([]string{config.ConstDBWitnessListPrefix, hash.String()}, "")
-	dbm.Delete(witness)
+	dbm.delete(witnessKey(hash))
+}
+
+// 在批次中添加一个见证人
+func (dbm *DatabaseManager) PutWitness(batch Putter, witness common.Address) error {
+	return batch.Put(witnessKey(witness), witness.Bytes())
+}
+
+// 在批次中删除一个见证人
+func (dbm *DatabaseManager) DeleteWitness(batch Deleter, witness common.Address) error {
+	return batch.Delete(witnessKey(witness))
 }
 
 // 存储球数组
 func (dbm *DatabaseManager) SaveBalls(balls []common.Hash) {
 	batch := dbm.db.NewBatch()
 	for _, witness := range balls {
-		wit := strings.Join([]string{config.ConstDBBallPrefix, witness.String()}, "")
-		batch.Put([]byte(wit), witness.Bytes())
+		batch.Put(stableBallKey(witness), witness.Bytes())
 		//log.Println(witness.String())
 	}
 	batch.Write()
@@ -259,11 +252,10 @@ func (dbm *DatabaseManager) SaveBalls(balls []common.Hash) {
 // 获取所有球
 func (dbm *DatabaseManager) GetBalls() []common.Hash {
 	balls := make([]common.Hash, 0)
-	it := dbm.db.NewIteratorWithPrefix([]byte(config.ConstDBBallPrefix))
+	it := dbm.db.NewIteratorWithPrefix(stableBallPrefix)
 	it.Seek([]byte(""))
 	for it.Valid() {
 		value := it.Value()
-		log.Println(common.BytesToHash(value).String())
 		balls = append(balls, common.BytesToHash(value))
 		it.Next()
 	}
@@ -272,29 +264,27 @@ func (dbm *DatabaseManager) GetBalls() []common.Hash {
 
 // 删除指定球
 func (dbm *DatabaseManager) DelBall(hash common.Hash) {
-	witness := strings.Join([]string{config.ConstDBBallPrefix, hash.String()}, "")
-	dbm.Delete(witness)
+	dbm.delete(stableBallKey(hash))
 }
 
 // ===================== UTXO 相关 ================
 // 存入一笔未花费的output
 func (dbm *DatabaseManager) SaveUnspentOutput(address common.Address, utxo types.UTXO) {
 	batch := dbm.db.NewBatch()
-	key := strings.Join([]string{config.ConstDBOutputPrefix, address.String(), ".", utxo.ToHash().String()}, "")
+	key := utxoKey(address, utxo.ToHash())
 	jsonStr, err := json.Marshal(utxo)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	batch.Put([]byte(key), jsonStr)
+	batch.Put(key, jsonStr)
 	batch.Write()
 }
 
 // 删除一笔未花费的output
 func (dbm *DatabaseManager) DelUnspentOutput(address common.Address, utxo types.UTXO) {
 	batch := dbm.db.NewBatch()
-	key := strings.Join([]string{config.ConstDBOutputPrefix, address.String(), ".", utxo.ToHash().String()}, "")
-	err := batch.Delete([]byte(key))
+	err := batch.Delete(utxoKey(address, utxo.ToHash()))
 	if err != nil {
 		log.Println("DelUnSpent Error ", err)
 	}
@@ -311,13 +301,13 @@ func (dbm *DatabaseManager) DelUnspentOutput(address common.Address, utxo types.
 func (dbm *DatabaseManager) SaveBatchUnspentOutput(commissions []types.Commission) {
 	batch := dbm.db.NewBatch()
 	for _, com := range commissions {
-		key := strings.Join([]string{config.ConstDBOutputPrefix, com.Address.String(), ".", com.UTXO.ToHash().String()}, "")
+		key := utxoKey(com.Address, com.UTXO.ToHash())
 		jsonStr, err := json.Marshal(com.UTXO)
 		if err != nil {
 			log.Println(err)
 			return
 		}
-		batch.Put([]byte(key), jsonStr)
+		batch.Put(key, jsonStr)
 
 		//log.Println("Save Stable UTXO")
 		//strByte, _ := json.Marshal(com.UTXO)
@@ -332,8 +322,7 @@ func (dbm *DatabaseManager) SaveBatchUnspentOutput(commissions []types.Commissio
 // 删除一笔pending池中的未花费的output
 func (dbm *DatabaseManager) DelPendingUnspentOutput(address common.Address, utxo types.UTXO) {
 	batch := dbm.db.NewBatch()
-	unSpentKey := strings.Join([]string{config.ConstDBPendingUnitPrefix, address.String(), ".", utxo.ToHash().String()}, "")
-	err := batch.Delete([]byte(unSpentKey))
+	err := batch.Delete(pendingUTXOKey(address, utxo.ToHash()))
 	if err != nil {
 		log.Println("Pending Unspent Error ", err)
 	}
@@ -349,8 +338,7 @@ func (dbm *DatabaseManager) DelPendingUnspentOutput(address common.Address, utxo
 // 获取指定地址所有未花费的unSpent
 func (dbm *DatabaseManager) GetUnspentOutput(address common.Address) []types.UTXO {
 	var utxos []types.UTXO
-	key := strings.Join([]string{config.ConstDBOutputPrefix, address.String()}, "")
-	it := dbm.db.NewIteratorWithPrefix([]byte(key))
+	it := dbm.db.NewIteratorWithPrefix(utxoAddressPrefix(address))
 	it.Seek([]byte(""))
 	for it.Valid() {
 		var msg types.UTXO
@@ -362,12 +350,9 @@ func (dbm *DatabaseManager) GetUnspentOutput(address common.Address) []types.UTX
 	return utxos
 }
 
-// 获取指定地址所有未花费的unSpent
+// 指定地址是否有这一笔未花费的unSpent
 func (dbm *DatabaseManager) IsExistUnspentOutput(address common.Address, utxo types.UTXO) bool {
-	key := strings.Join([]string{config.ConstDBOutputPrefix, address.String(), ".", utxo.ToHash().String()}, "")
-	it := dbm.db.NewIteratorWithPrefix([]byte(key))
-	find := it.Seek([]byte(""))
-
+	find, _ := dbm.db.Has(utxoKey(address, utxo.ToHash()))
 	return find
 }
 
@@ -375,14 +360,13 @@ func (dbm *DatabaseManager) IsExistUnspentOutput(address common.Address, utxo ty
 // 存入一笔UTXO到Pending池中
 func (dbm *DatabaseManager) SavePendingUTXO(address common.Address, utxo types.UTXO) {
 	batch := dbm.db.NewBatch()
-	unSpentKey := strings.Join([]string{config.ConstDBPendingUnitPrefix, address.String(), ".", utxo.ToHash().String()}, "")
-	//log.Println("WP: ", unSpentKey, ": ", utxo.Amount)
+	unSpentKey := pendingUTXOKey(address, utxo.ToHash())
 	jsonStr, err := json.Marshal(utxo)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	err = batch.Put([]byte(unSpentKey), jsonStr)
+	err = batch.Put(unSpentKey, jsonStr)
 	if err != nil {
 		log.Println("PendingUnit Error ", err)
 	}
@@ -392,9 +376,7 @@ func (dbm *DatabaseManager) SavePendingUTXO(address common.Address, utxo types.U
 // 删除一笔UTXO从Pending池中
 func (dbm *DatabaseManager) DelPendingUTXO(address common.Address, utxo types.UTXO) {
 	batch := dbm.db.NewBatch()
-	unSpentKey := strings.Join([]string{config.ConstDBPendingUnitPrefix, address.String(), ".", utxo.ToHash().String()}, "")
-	//log.Println("DP: ", unSpentKey, ": ", utxo.Amount)
-	err := batch.Delete([]byte(unSpentKey))
+	err := batch.Delete(pendingUTXOKey(address, utxo.ToHash()))
 	if err != nil {
 		log.Println("PendingUnit Error ", err)
 	}
@@ -404,15 +386,8 @@ func (dbm *DatabaseManager) DelPendingUTXO(address common.Address, utxo types.UT
 // 查找一笔UTXO是否存在于Pending池中
 func (dbm *DatabaseManager) GetPendingUTXO(address common.Address, hash common.Hash) types.UTXO {
 	utxo := types.NewEmptyUTXO()
-	unSpentKey := strings.Join([]string{config.ConstDBPendingUnitPrefix, address.String(), ".", hash.String()}, "")
-	//log.Println("RP: ", unSpentKey)
-	it := dbm.db.NewIteratorWithPrefix([]byte(unSpentKey))
-	it.Seek([]byte(""))
-	for it.Valid() {
-		var msg types.UTXO
-		json.Unmarshal(it.Value(), &msg)
-		utxo = msg
-		it.Next()
+	if data, err := dbm.db.Get(pendingUTXOKey(address, hash)); err == nil {
+		json.Unmarshal(data, &utxo)
 	}
 
 	return utxo
@@ -421,9 +396,7 @@ func (dbm *DatabaseManager) GetPendingUTXO(address common.Address, hash common.H
 // 查找一笔UTXO是否存在于Pending池中通过指定作者
 func (dbm *DatabaseManager) GetPendingUTXOByAuthor(address common.Address) []types.UTXO {
 	var pendingUnspent []types.UTXO
-	unSpentKey := strings.Join([]string{config.ConstDBPendingUnitPrefix, address.String()}, "")
-	//log.Println("RP: ", unSpentKey)
-	it := dbm.db.NewIteratorWithPrefix([]byte(unSpentKey))
+	it := dbm.db.NewIteratorWithPrefix(pendingUTXOAddressPrefix(address))
 	it.Seek([]byte(""))
 	for it.Valid() {
 		var msg types.UTXO
@@ -437,22 +410,16 @@ func (dbm *DatabaseManager) GetPendingUTXOByAuthor(address common.Address) []typ
 
 // 在pending池中是否存在一笔UTXO
 func (dbm *DatabaseManager) IsExistPendingUTXO(address common.Address, utxo types.UTXO) bool {
-	unSpentKey := strings.Join([]string{config.ConstDBPendingUnitPrefix, address.String(), ".", utxo.ToHash().String()}, "")
-	//log.Println("RP: ", unSpentKey)
-	it := dbm.db.NewIteratorWithPrefix([]byte(unSpentKey))
-	isExist := it.Seek([]byte(""))
-
+	isExist, _ := dbm.db.Has(pendingUTXOKey(address, utxo.ToHash()))
 	return isExist
 }
 
 // 获取指定地址所有Pending未花费
 func (dbm *DatabaseManager) GetAllPendingUnSpent(address common.Address) []types.UTXO {
 	var spent []types.UTXO
-	key := strings.Join([]string{config.ConstDBPendingUnitPrefix, address.String(), "."}, "")
-	it := dbm.db.NewIteratorWithPrefix([]byte(key))
+	it := dbm.db.NewIteratorWithPrefix(pendingUTXOAddressPrefix(address))
 	it.Seek([]byte(""))
 	for it.Valid() {
-		log.Println(string(it.Key()))
 		var msg types.UTXO
 		json.Unmarshal(it.Value(), &msg)
 		spent = append(spent, msg)
@@ -467,8 +434,7 @@ func (dbm *DatabaseManager) GetAllPendingUnSpent(address common.Address) []types
 // 获取指定地址所有未花费的unSpent从Pending池中
 func (dbm *DatabaseManager) GetUnspentOutputFromPendingPool(address common.Address) map[string]types.UTXO {
 	var unSpent = make(map[string]types.UTXO, 1)
-	key := strings.Join([]string{config.ConstDBPendingUnitPrefix, address.String()}, "")
-	it := dbm.db.NewIteratorWithPrefix([]byte(key))
+	it := dbm.db.NewIteratorWithPrefix(pendingUTXOAddressPrefix(address))
 	it.Seek([]byte(""))
 	for it.Valid() {
 		var msg types.UTXO
@@ -482,40 +448,32 @@ func (dbm *DatabaseManager) GetUnspentOutputFromPendingPool(address common.Addre
 
 // 获取所有Pending状态的UTXO
 func (dbm *DatabaseManager) GetAllPendingOutput() {
-	it := dbm.db.NewIteratorWithPrefix([]byte(config.ConstDBPendingUnitPrefix))
+	it := dbm.db.NewIteratorWithPrefix(pendingUTXOPrefix)
 	it.Seek([]byte(""))
 	for it.Valid() {
-		key := it.Key()
-		value := it.Value()
-
-		log.Println(string(key))
-		log.Println(string(value))
+		log.Println(string(it.Value()))
 		it.Next()
 	}
 }
 
 // 获取所有Stable状态的UTXO
 func (dbm *DatabaseManager) GetAllStableOutput() {
-	it := dbm.db.NewIteratorWithPrefix([]byte(config.ConstDBOutputPrefix))
+	it := dbm.db.NewIteratorWithPrefix(utxoPrefix)
 	it.Seek([]byte(""))
 	for it.Valid() {
-		key := it.Key()
-		value := it.Value()
-
-		log.Println(string(key))
-		log.Println(string(value))
+		log.Println(string(it.Value()))
 		it.Next()
 	}
 }
 
 // 返回所有单元
 func (dbm *DatabaseManager) GetAllUnits(fn func(hash string, value string)) {
-	it := dbm.db.NewIteratorWithPrefix([]byte(config.ConstDBUnitPrefix))
+	it := dbm.db.NewIteratorWithPrefix(unitPrefix)
 	it.Seek([]byte(""))
 	for it.Valid() {
-		key := it.Key()
+		hash := common.BytesToHash(it.Key()[len(unitPrefix):])
 		if fn != nil {
-			fn(string(key), string(it.Value()))
+			fn(hash.String(), string(it.Value()))
 		}
 		it.Next()
 	}
@@ -524,7 +482,7 @@ func (dbm *DatabaseManager) GetAllUnits(fn func(hash string, value string)) {
 // 获取所有单元的总数量
 func (dbm *DatabaseManager) GetAllUnitCount() int64 {
 	var count int64
-	it := dbm.db.NewIteratorWithPrefix([]byte(config.ConstDBUnitPrefix))
+	it := dbm.db.NewIteratorWithPrefix(unitPrefix)
 	it.Seek([]byte(""))
 	for it.Valid() {
 		count++
@@ -537,7 +495,7 @@ func (dbm *DatabaseManager) GetAllUnitCount() int64 {
 // 获取稳定点数量
 func (dbm *DatabaseManager) GetAllStableUnitCount() int64 {
 	var count int64
-	it := dbm.db.NewIteratorWithPrefix([]byte(config.ConstDBUnitPrefix))
+	it := dbm.db.NewIteratorWithPrefix(unitPrefix)
 	it.Seek([]byte(""))
 	for it.Valid() {
 		var unit types.Unit
@@ -554,7 +512,7 @@ func (dbm *DatabaseManager) GetAllStableUnitCount() int64 {
 // 获取不稳定点数量
 func (dbm *DatabaseManager) GetAllUnStableUnitCount() int64 {
 	var count int64
-	it := dbm.db.NewIteratorWithPrefix([]byte(config.ConstDBUnitPrefix))
+	it := dbm.db.NewIteratorWithPrefix(unitPrefix)
 	it.Seek([]byte(""))
 	for it.Valid() {
 		var unit types.Unit
@@ -572,14 +530,12 @@ func (dbm *DatabaseManager) GetAllUnStableUnitCount() int64 {
 func (dbm *DatabaseManager) SaveChildrenUnit(parentunit common.Hash, children types.HashArray) {
 	batch := dbm.db.NewBatch()
 
-	key := strings.Join([]string{config.ConstDBChildrenHash, parentunit.String()}, "")
-	log.Println("Save Children: ", key, children)
 	childrenByte, err := json.Marshal(children)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	err = batch.Put([]byte(key), childrenByte)
+	err = batch.Put(childrenKey(parentunit), childrenByte)
 	if err != nil {
 		log.Println("Save Children Error ", err)
 	}
@@ -590,13 +546,8 @@ func (dbm *DatabaseManager) SaveChildrenUnit(parentunit common.Hash, children ty
 // 获得单元的子单元
 func (dbm *DatabaseManager) GetChildrenUnit(hash common.Hash) (types.HashArray, error) {
 	children := types.NewHashArray()
-	key := strings.Join([]string{config.ConstDBChildrenHash, hash.String()}, "")
-	//log.Println("Get Children: ", key)
-	it := dbm.db.NewIteratorWithPrefix([]byte(key))
-	it.Seek([]byte(""))
-	for it.Valid() {
-		json.Unmarshal(it.Value(), &children)
-		it.Next()
+	if data, err := dbm.db.Get(childrenKey(hash)); err == nil {
+		json.Unmarshal(data, &children)
 	}
 
 	return children, nil
@@ -606,14 +557,12 @@ func (dbm *DatabaseManager) GetChildrenUnit(hash common.Hash) (types.HashArray,
 func (dbm *DatabaseManager) SaveStableUnits(mcUnit common.Hash, stableUnits types.HashArray) {
 	batch := dbm.db.NewBatch()
 
-	key := strings.Join([]string{config.ConstDBStableUnitsPrefix, mcUnit.String()}, "")
-	//log.Println("Save Stable Units: ", key, stableUnits)
 	stableUnitsByte, err := json.Marshal(stableUnits)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	if err := batch.Put([]byte(key), stableUnitsByte); err != nil {
+	if err := batch.Put(stableUnitsKey(mcUnit), stableUnitsByte); err != nil {
 		log.Println("Save Stable Units Error ", err)
 		return
 	}
@@ -623,14 +572,9 @@ func (dbm *DatabaseManager) SaveStableUnits(mcUnit common.Hash, stableUnits type
 // 获得主链上稳定点对应稳定的单元列表
 func (dbm *DatabaseManager) GetStableUnits(hash common.Hash) (types.Units, error) {
 	stableUnitsHashes := types.NewHashArray()
-	key := strings.Join([]string{config.ConstDBStableUnitsPrefix, hash.String()}, "")
-	log.Println("Get Stable Units: ", key)
 	stableUnits := types.NewUnits()
-	it := dbm.db.NewIteratorWithPrefix([]byte(key))
-	it.Seek([]byte(""))
-	for it.Valid() {
-		json.Unmarshal(it.Value(), &stableUnitsHashes)
-		it.Next()
+	if data, err := dbm.db.Get(stableUnitsKey(hash)); err == nil {
+		json.Unmarshal(data, &stableUnitsHashes)
 	}
 	for _, val := range stableUnitsHashes.Hashes {
 		unit, err := dbm.GetUnitByHash(val)
@@ -646,30 +590,27 @@ func (dbm *DatabaseManager) GetStableUnits(hash common.Hash) (types.Units, error
 // 存入当前收到的最新的投票轮数
 func (dbm *DatabaseManager) SaveVoteRound(voteRound int64) {
 	batch := dbm.db.NewBatch()
-	key := strings.Join([]string{config.ConstDBVoteRound}, "")
-	voteRoundByte, err := json.Marshal(voteRound)
-	if err != nil {
-		log.Println(err)
+	if err := dbm.PutVoteRound(batch, voteRound); err != nil {
+		log.Println("Save VoteRound Error ", err)
 		return
 	}
-	err = batch.Put([]byte(key), voteRoundByte)
+	batch.Write()
+}
+
+// 在批次中写入最新的投票轮数
+func (dbm *DatabaseManager) PutVoteRound(batch Putter, voteRound int64) error {
+	voteRoundByte, err := json.Marshal(voteRound)
 	if err != nil {
-		log.Println("Save VoteRound Error ", err)
+		return err
 	}
-
-	batch.Write()
+	return batch.Put(voteRoundKey, voteRoundByte)
 }
 
-// 获得当前收到的最新的投票轮数
+// 获得当前收到的最新的投票轮数, 还没有任何一轮计票时为 -1
 func (dbm *DatabaseManager) GetVoteRound() (int64, error) {
-	var voteRound int64
-	key := strings.Join([]string{config.ConstDBVoteRound}, "")
-	//log.Println("Get Children: ", key)
-	it := dbm.db.NewIteratorWithPrefix([]byte(key))
-	it.Seek([]byte(""))
-	for it.Valid() {
-		json.Unmarshal(it.Value(), &voteRound)
-		it.Next()
+	voteRound := int64(-1)
+	if data, err := dbm.db.Get(voteRoundKey); err == nil {
+		json.Unmarshal(data, &voteRound)
 	}
 
 	return voteRound, nil
@@ -678,40 +619,135 @@ func (dbm *DatabaseManager) GetVoteRound() (int64, error) {
 // 存入某一轮投票结果
 func (dbm *DatabaseManager) SaveVoteResult(voteRound int64, result types.VoteResult) {
 	batch := dbm.db.NewBatch()
-
-	key := strings.Join([]string{config.ConstDBVoteResult, strconv.FormatInt(voteRound, 10)}, "")
-	resultByte, err := json.Marshal(result)
-	if err != nil {
-		log.Println(err)
+	if err := dbm.PutVoteResult(batch, voteRound, result); err != nil {
+		log.Println("Save vote result Error ", err)
 		return
 	}
-	err = batch.Put([]byte(key), resultByte)
+	batch.Write()
+}
+
+// 在批次中写入某一轮投票结果
+func (dbm *DatabaseManager) PutVoteResult(batch Putter, voteRound int64, result types.VoteResult) error {
+	resultByte, err := json.Marshal(result)
 	if err != nil {
-		log.Println("Save vote result Error ", err)
+		return err
 	}
-
-	batch.Write()
+	return batch.Put(voteResultKey(voteRound), resultByte)
 }
 
 // 获得某一轮投票结果
 func (dbm *DatabaseManager) GetVoteResult(voteRound int64) (types.VoteResult, error) {
 	var voteResult types.VoteResult
-	key := strings.Join([]string{config.ConstDBVoteResult, strconv.FormatInt(voteRound, 10)}, "")
-	it := dbm.db.NewIteratorWithPrefix([]byte(key))
+	data, err := dbm.db.Get(voteResultKey(voteRound))
+	if err != nil {
+		return voteResult, err
+	}
+	err = json.Unmarshal(data, &voteResult)
+
+	return voteResult, err
+}
+
+// 按轮次顺序遍历已计票的投票结果, fn 返回 false 时停止
+func (dbm *DatabaseManager) IterateVoteResults(from int64, fn func(result types.VoteResult) bool) {
+	last, _ := dbm.GetVoteRound()
+	if from < 0 {
+		from = 0
+	}
+	for round := from; round <= last; round++ {
+		result, err := dbm.GetVoteResult(round)
+		if err != nil {
+			continue
+		}
+		if !fn(result) {
+			return
+		}
+	}
+}
+
+// 新建一个批次, 写入在 Write 时一起生效
+func (dbm *DatabaseManager) NewBatch() Batch {
+	return dbm.db.NewBatch()
+}
+
+// 在批次中写入稳定单元和它们计入的各轮活跃度, activity 为每一轮每个地址新增的稳定单元数.
+// 同一地址同一轮的新增数必须在一次调用中给出, 批次写入前数据库中的计数不变
+func (dbm *DatabaseManager) PutStableUnitsActivity(batch Putter, units types.Units, activity map[int64]map[common.Address]int64) error {
+	for _, unit := range units {
+		if err := batch.Put(unitKey(unit.Hash), types.Unit2Byte(unit)); err != nil {
+			return err
+		}
+	}
+	for round, deltas := range activity {
+		for address, delta := range deltas {
+			key := voteActivityKey(round, address)
+			var count int64
+			if data, err := dbm.db.Get(key); err == nil {
+				json.Unmarshal(data, &count)
+			}
+			countByte, err := json.Marshal(count + delta)
+			if err != nil {
+				return err
+			}
+			if err := batch.Put(key, countByte); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 在批次中写入稳定单元的球, 父球取自数据库或本批次中层级更低的单元.
+// 父单元没有球的单元 (旧数据库中的单元) 不写入球
+func (dbm *DatabaseManager) PutStableBalls(batch Putter, units types.Units) error {
+	sorted := make(types.Units, len(units))
+	copy(sorted, units)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Level < sorted[j].Level })
+
+	balls := make(map[common.Hash]types.Ball)
+	for _, unit := range sorted {
+		parentBalls := make([]common.Hash, 0, len(unit.ParentList))
+		for _, parent := range unit.ParentList {
+			ball, ok := balls[parent]
+			if !ok {
+				var err error
+				if ball, err = dbm.GetBallByHash(parent); err != nil {
+					break
+				}
+			}
+			parentBalls = append(parentBalls, ball.BallHash())
+		}
+		if len(parentBalls) != len(unit.ParentList) {
+			log.Println("父单元的球不存在: ", unit.Hash.String())
+			continue
+		}
+		ball := types.NewBall(unit.Hash, parentBalls, unit.Invalid)
+		if err := batch.Put(ballKey(ball.HashKey()), types.Ball2Byte(ball)); err != nil {
+			return err
+		}
+		balls[unit.Hash] = ball
+	}
+	return nil
+}
+
+// 获得某一轮中每个地址的稳定单元数
+func (dbm *DatabaseManager) GetRoundActivity(voteRound int64) map[common.Address]int64 {
+	activity := make(map[common.Address]int64)
+	prefix := voteActivityRoundPrefix(voteRound)
+	it := dbm.db.NewIteratorWithPrefix(prefix)
 	it.Seek([]byte(""))
 	for it.Valid() {
-		json.Unmarshal(it.Value(), &voteResult)
+		var count int64
+		json.Unmarshal(it.Value(), &count)
+		activity[common.BytesToAddress(it.Key()[len(prefix):])] = count
 		it.Next()
 	}
-
-	return voteResult, nil
+	return activity
 }
 
 // 清空数据
 func (dbm *DatabaseManager) DelAllData(key string) {
 	batch := dbm.db.NewBatch()
-	unSpentKey := strings.Join([]string{config.ConstDBUnitPrefix, key}, "")
-	err := batch.Delete([]byte(unSpentKey))
+	err := batch.Delete(unitKey(common.HexToHash(key)))
 	if err != nil {
 		log.Println("Delete Error ", err)
 	}
@@ -722,16 +758,14 @@ func (dbm *DatabaseManager) DelAllData(key string) {
 func (dbm *DatabaseManager) SaveCacheUnitToDb(unit types.Unit) {
 	batch := dbm.db.NewBatch()
 
-	keyUnit := strings.Join([]string{config.ConstCacheUnit, unit.Hash.String()}, "")
-	batch.Put([]byte(keyUnit), types.Unit2Byte(unit))
+	batch.Put(cacheUnitKey(unit.Hash), types.Unit2Byte(unit))
 	batch.Write()
 }
 
 // 缓存未发送的单元
 func (dbm *DatabaseManager) GetCacheUnitFromDb() types.Units {
 	cacheUnits := types.Units{}
-	key := strings.Join([]string{config.ConstCacheUnit}, "")
-	it := dbm.db.NewIteratorWithPrefix([]byte(key))
+	it := dbm.db.NewIteratorWithPrefix(cacheUnitPrefix)
 	it.Seek([]byte(""))
 	for it.Valid() {
 		unit := types.Unit{}
@@ -746,8 +780,7 @@ func (dbm *DatabaseManager) GetCacheUnitFromDb() types.Units {
 // 清除缓存未发送的单元
 func (dbm *DatabaseManager) DelCacheUnitFromDb(unit types.Unit) {
 	batch := dbm.db.NewBatch()
-	key := strings.Join([]string{config.ConstCacheUnit, unit.Hash.String()}, "")
-	err := batch.Delete([]byte(key))
+	err := batch.Delete(cacheUnitKey(unit.Hash))
 	if err != nil {
 		log.Println("Delete Error ", err)
 	}
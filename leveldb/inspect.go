@@ -0,0 +1,233 @@
+package leveldb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/babyboy/common"
+	"github.com/babyboy/core/types"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var ErrNotOnDisk = errors.New("database is not backed by leveldb")
+
+// 每种记录的名称和前缀, 用于统计和导出
+var schemaPrefixes = []struct {
+	Name   string
+	Prefix []byte
+}{
+	{"unit", unitPrefix},
+	{"ball", ballPrefix},
+	{"stable-ball", stableBallPrefix},
+	{"children", childrenPrefix},
+	{"stable-units", stableUnitsPrefix},
+	{"tip", parentPrefix},
+	{"witness", witnessPrefix},
+	{"utxo", utxoPrefix},
+	{"pending-utxo", pendingUTXOPrefix},
+	{"vote-round", voteRoundKey},
+	{"vote-result", voteResultPrefix},
+	{"vote-activity", voteActivityPrefix},
+	{"cache-unit", cacheUnitPrefix},
+	{"schema-version", schemaVersionKey},
+	{"schema-migration", schemaMigrationKey},
+}
+
+// 一种记录的数量和大小
+type PrefixStat struct {
+	Name      string
+	Count     int64
+	KeySize   int64
+	ValueSize int64
+}
+
+// 所有记录类型的名称
+func PrefixNames() []string {
+	names := make([]string, len(schemaPrefixes))
+	for i, p := range schemaPrefixes {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// 按名称获取前缀, 也接受十六进制的前缀 (例如 "0x01")
+func PrefixByName(name string) ([]byte, error) {
+	for _, p := range schemaPrefixes {
+		if p.Name == name {
+			return p.Prefix, nil
+		}
+	}
+	if strings.HasPrefix(name, "0x") {
+		return hex.DecodeString(name[2:])
+	}
+	return nil, fmt.Errorf("unknown prefix %q, want one of %s or a hex prefix", name, strings.Join(PrefixNames(), ", "))
+}
+
+// 统计每种记录的数量和大小, 不属于任何前缀的记录计入 "other"
+func (dbm *DatabaseManager) Stats() []PrefixStat {
+	stats := make([]PrefixStat, len(schemaPrefixes)+1)
+	for i, p := range schemaPrefixes {
+		stats[i].Name = p.Name
+	}
+	other := &stats[len(schemaPrefixes)]
+	other.Name = "other"
+
+	it := dbm.db.NewIterator()
+	defer it.Release()
+	for it.Next() {
+		stat := other
+		for i, p := range schemaPrefixes {
+			if bytes.HasPrefix(it.Key(), p.Prefix) {
+				stat = &stats[i]
+				break
+			}
+		}
+		stat.Count++
+		stat.KeySize += int64(len(it.Key()))
+		stat.ValueSize += int64(len(it.Value()))
+	}
+	return stats
+}
+
+// 按顺序遍历某个前缀的所有记录, fn 返回 false 时停止
+func (dbm *DatabaseManager) Dump(prefix []byte, fn func(key, value []byte) bool) error {
+	it := dbm.db.NewIteratorWithPrefix(prefix)
+	defer it.Release()
+	for it.Next() {
+		if !fn(it.Key(), it.Value()) {
+			break
+		}
+	}
+	return it.Error()
+}
+
+// leveldb 的内部统计信息, 包括每层的文件和压缩数据
+func (dbm *DatabaseManager) LevelDBStats() (string, error) {
+	ldb, ok := dbm.db.(*LDBDatabase)
+	if !ok {
+		return "", ErrNotOnDisk
+	}
+	return ldb.LDB().GetProperty("leveldb.stats")
+}
+
+// 压缩整个数据库
+func (dbm *DatabaseManager) Compact() error {
+	ldb, ok := dbm.db.(*LDBDatabase)
+	if !ok {
+		return ErrNotOnDisk
+	}
+	return ldb.LDB().CompactRange(util.Range{})
+}
+
+// 检查子单元索引, tip 和稳定单元列表是否互相一致, 返回发现的问题
+//
+//  1. 每个父单元的子单元索引包含该单元, 索引中的子单元都存在并引用该父单元
+//  2. 每个 tip 都存在并且没有子单元, 没有子单元的单元都是 tip
+//  3. 稳定单元列表所属的主链单元和列表中的单元都存在并且是稳定的
+func (dbm *DatabaseManager) Check() []string {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	units := make(map[common.Hash]types.Unit)
+	dbm.Dump(unitPrefix, func(key, value []byte) bool {
+		unit := types.Byte2Unit(value)
+		units[common.BytesToHash(key[len(unitPrefix):])] = unit
+		return true
+	})
+
+	children := make(map[common.Hash]map[common.Hash]bool)
+	dbm.Dump(childrenPrefix, func(key, value []byte) bool {
+		parent := common.BytesToHash(key[len(childrenPrefix):])
+		list, _ := dbm.GetChildrenUnit(parent)
+		set := make(map[common.Hash]bool)
+		for _, child := range list.Hashes {
+			set[child] = true
+		}
+		children[parent] = set
+		return true
+	})
+
+	// 1. 子单元索引
+	for hash, unit := range units {
+		for _, parent := range unit.ParentList {
+			if _, ok := units[parent]; !ok {
+				report("unit %s: parent %s missing", hash.String(), parent.String())
+			}
+			if !children[parent][hash] {
+				report("unit %s: not in the children index of parent %s", hash.String(), parent.String())
+			}
+		}
+	}
+	for parent, set := range children {
+		if _, ok := units[parent]; !ok {
+			report("children index of missing unit %s", parent.String())
+		}
+		for child := range set {
+			unit, ok := units[child]
+			if !ok {
+				report("children index of %s: child %s missing", parent.String(), child.String())
+				continue
+			}
+			found := false
+			for _, p := range unit.ParentList {
+				found = found || p == parent
+			}
+			if !found {
+				report("children index of %s: child %s does not reference it", parent.String(), child.String())
+			}
+		}
+	}
+
+	// 2. tip
+	tips := make(map[common.Hash]bool)
+	for _, tip := range dbm.GetParentsList() {
+		tips[tip] = true
+		if _, ok := units[tip]; !ok {
+			report("tip %s: unit missing", tip.String())
+		}
+		if len(children[tip]) > 0 {
+			report("tip %s: has %d children", tip.String(), len(children[tip]))
+		}
+	}
+	referenced := make(map[common.Hash]bool)
+	for _, unit := range units {
+		for _, parent := range unit.ParentList {
+			referenced[parent] = true
+		}
+	}
+	for hash := range units {
+		if !referenced[hash] && !tips[hash] {
+			report("unit %s: has no children but is not a tip", hash.String())
+		}
+	}
+
+	// 3. 稳定单元列表
+	dbm.Dump(stableUnitsPrefix, func(key, value []byte) bool {
+		mcUnit := common.BytesToHash(key[len(stableUnitsPrefix):])
+		if unit, ok := units[mcUnit]; !ok {
+			report("stable units of %s: main chain unit missing", mcUnit.String())
+		} else if !unit.IsStable || !unit.IsOnMainChain {
+			report("stable units of %s: main chain unit is not stable on the main chain", mcUnit.String())
+		}
+		hashes := types.NewHashArray()
+		if err := json.Unmarshal(value, &hashes); err != nil {
+			report("stable units of %s: %v", mcUnit.String(), err)
+			return true
+		}
+		for _, hash := range hashes.Hashes {
+			if unit, ok := units[hash]; !ok {
+				report("stable units of %s: unit %s missing", mcUnit.String(), hash.String())
+			} else if !unit.IsStable {
+				report("stable units of %s: unit %s is not stable", mcUnit.String(), hash.String())
+			}
+		}
+		return true
+	})
+	return problems
+}
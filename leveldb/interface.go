@@ -1,5 +1,7 @@
 package leveldb
 
+import "github.com/syndtr/goleveldb/leveldb/iterator"
+
 // Code using batches should try to add this much data to the batch.
 // The value was determined empirically.
 const IdealBatchSize = 100 * 1024
@@ -24,6 +26,14 @@ type Database interface {
 	NewBatch() Batch
 }
 
+// IteratorDatabase is a Database that can also iterate over its keys in
+// order, which the DatabaseManager needs for its prefix scans.
+type IteratorDatabase interface {
+	Database
+	NewIterator() iterator.Iterator
+	NewIteratorWithPrefix(prefix []byte) iterator.Iterator
+}
+
 // Batch is a write-only database that commits changes to its host database
 // when Write is called. Batch cannot be used concurrently.
 type Batch interface {
@@ -0,0 +1,133 @@
+package leveldb
+
+import (
+	"sync"
+
+	"github.com/babyboy/common"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// MemDatabase is an in-memory key-value store keeping keys in the same order
+// as LDBDatabase, for ephemeral nodes, tests and simulations.
+type MemDatabase struct {
+	db   *memdb.DB
+	lock sync.RWMutex
+}
+
+// NewMemDatabase returns an empty in-memory database.
+func NewMemDatabase() *MemDatabase {
+	return &MemDatabase{
+		db: memdb.New(comparer.DefaultComparer, 0),
+	}
+}
+
+// Put puts the given key / value to the database
+func (db *MemDatabase) Put(key []byte, value []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.db.Put(key, value)
+}
+
+func (db *MemDatabase) Has(key []byte) (bool, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.db.Contains(key), nil
+}
+
+// Get returns a copy of the value of the given key if it's present.
+func (db *MemDatabase) Get(key []byte) ([]byte, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	dat, err := db.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, dat...), nil
+}
+
+// Delete deletes the key from the database, missing keys are not an error
+func (db *MemDatabase) Delete(key []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if err := db.db.Delete(key); err != nil && err != errors.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+func (db *MemDatabase) NewIterator() iterator.Iterator {
+	return db.db.NewIterator(nil)
+}
+
+// NewIteratorWithPrefix returns a iterator to iterate over subset of database content with a particular prefix.
+func (db *MemDatabase) NewIteratorWithPrefix(prefix []byte) iterator.Iterator {
+	return db.db.NewIterator(util.BytesPrefix(prefix))
+}
+
+// Len returns the number of keys in the database.
+func (db *MemDatabase) Len() int {
+	return db.db.Len()
+}
+
+func (db *MemDatabase) Close() {}
+
+func (db *MemDatabase) NewBatch() Batch {
+	return &memBatch{db: db}
+}
+
+type kv struct {
+	k, v []byte
+	del  bool
+}
+
+type memBatch struct {
+	db     *MemDatabase
+	writes []kv
+	size   int
+}
+
+func (b *memBatch) Put(key, value []byte) error {
+	b.writes = append(b.writes, kv{common.CopyBytes(key), common.CopyBytes(value), false})
+	b.size += len(value)
+	return nil
+}
+
+func (b *memBatch) Delete(key []byte) error {
+	b.writes = append(b.writes, kv{common.CopyBytes(key), nil, true})
+	b.size += 1
+	return nil
+}
+
+// Write applies the batch in one step, readers never see half of it.
+func (b *memBatch) Write() error {
+	b.db.lock.Lock()
+	defer b.db.lock.Unlock()
+
+	for _, kv := range b.writes {
+		if kv.del {
+			b.db.db.Delete(kv.k)
+			continue
+		}
+		if err := b.db.db.Put(kv.k, kv.v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *memBatch) ValueSize() int {
+	return b.size
+}
+
+func (b *memBatch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
@@ -0,0 +1,276 @@
+package leveldb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/babyboy/common"
+	"github.com/babyboy/config"
+	"github.com/babyboy/core/types"
+)
+
+// 当前的数据库格式版本
+//
+//	0: 字符串key, 投票结果的开始和结束时间共用 "time_stamp" 标签, 都没有保存
+//	1: 字符串key, 投票结果有单独的 start_time 和 end_time
+//	2: 按记录类型区分的二进制key
+const SchemaVersion = 2
+
+var ErrSchemaTooNew = errors.New("database schema is newer than this version of the node")
+
+// 每种记录一个字节的前缀, 后面是二进制的hash/地址/轮数.
+// 前缀都小于0x20, 不会和旧版本的字符串key混淆.
+var (
+	unitPrefix         = []byte{0x01} // unitPrefix + unit hash -> unit json
+	ballPrefix         = []byte{0x02} // ballPrefix + unit hash -> ball json
+	stableBallPrefix   = []byte{0x03} // stableBallPrefix + ball hash -> ball hash (SaveBalls)
+	childrenPrefix     = []byte{0x04} // childrenPrefix + unit hash -> children hash array json
+	stableUnitsPrefix  = []byte{0x05} // stableUnitsPrefix + main chain unit hash -> stable units hash array json
+	parentPrefix       = []byte{0x06} // parentPrefix + tip hash -> tip hash
+	witnessPrefix      = []byte{0x07} // witnessPrefix + address -> address
+	utxoPrefix         = []byte{0x08} // utxoPrefix + address + utxo hash -> utxo json
+	pendingUTXOPrefix  = []byte{0x09} // pendingUTXOPrefix + address + utxo hash -> utxo json
+	voteRoundKey       = []byte{0x0a} // last tallied vote round
+	voteResultPrefix   = []byte{0x0b} // voteResultPrefix + round (uint64 big endian) -> vote result json
+	voteActivityPrefix = []byte{0x0c} // voteActivityPrefix + round + address -> stable unit count
+	cacheUnitPrefix    = []byte{0x0d} // cacheUnitPrefix + unit hash -> unit json
+	schemaVersionKey   = []byte{0x0e} // schema version of the database
+	schemaMigrationKey = []byte{0x0f} // source schema version of a migration in progress
+)
+
+func concatKey(parts ...[]byte) []byte {
+	size := 0
+	for _, part := range parts {
+		size += len(part)
+	}
+	key := make([]byte, 0, size)
+	for _, part := range parts {
+		key = append(key, part...)
+	}
+	return key
+}
+
+func encodeRound(round int64) []byte {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, uint64(round))
+	return enc
+}
+
+func unitKey(hash common.Hash) []byte        { return concatKey(unitPrefix, hash.Bytes()) }
+func ballKey(hash common.Hash) []byte        { return concatKey(ballPrefix, hash.Bytes()) }
+func stableBallKey(hash common.Hash) []byte  { return concatKey(stableBallPrefix, hash.Bytes()) }
+func childrenKey(hash common.Hash) []byte    { return concatKey(childrenPrefix, hash.Bytes()) }
+func stableUnitsKey(hash common.Hash) []byte { return concatKey(stableUnitsPrefix, hash.Bytes()) }
+func parentKey(hash common.Hash) []byte      { return concatKey(parentPrefix, hash.Bytes()) }
+func witnessKey(addr common.Address) []byte  { return concatKey(witnessPrefix, addr.Bytes()) }
+func cacheUnitKey(hash common.Hash) []byte   { return concatKey(cacheUnitPrefix, hash.Bytes()) }
+func voteResultKey(round int64) []byte       { return concatKey(voteResultPrefix, encodeRound(round)) }
+
+func utxoKey(addr common.Address, hash common.Hash) []byte {
+	return concatKey(utxoPrefix, addr.Bytes(), hash.Bytes())
+}
+
+func utxoAddressPrefix(addr common.Address) []byte {
+	return concatKey(utxoPrefix, addr.Bytes())
+}
+
+func pendingUTXOKey(addr common.Address, hash common.Hash) []byte {
+	return concatKey(pendingUTXOPrefix, addr.Bytes(), hash.Bytes())
+}
+
+func pendingUTXOAddressPrefix(addr common.Address) []byte {
+	return concatKey(pendingUTXOPrefix, addr.Bytes())
+}
+
+func voteActivityKey(round int64, addr common.Address) []byte {
+	return concatKey(voteActivityPrefix, encodeRound(round), addr.Bytes())
+}
+
+func voteActivityRoundPrefix(round int64) []byte {
+	return concatKey(voteActivityPrefix, encodeRound(round))
+}
+
+// 旧版本中标记投票结果格式的key
+const legacyVoteSchemaKey = "vote.schema"
+
+// 获取数据库的格式版本, 新数据库返回 SchemaVersion.
+// 迁移中断的数据库返回迁移前的版本, 迁移可以重新执行.
+func (dbm *DatabaseManager) GetSchemaVersion() int {
+	if data, err := dbm.db.Get(schemaMigrationKey); err == nil {
+		var version int
+		json.Unmarshal(data, &version)
+		return version
+	}
+	if data, err := dbm.db.Get(schemaVersionKey); err == nil {
+		var version int
+		json.Unmarshal(data, &version)
+		return version
+	}
+	if data, err := dbm.db.Get([]byte(legacyVoteSchemaKey)); err == nil {
+		var version int
+		json.Unmarshal(data, &version)
+		return version
+	}
+	it := dbm.db.NewIteratorWithPrefix([]byte(config.ConstDBUnitPrefix))
+	defer it.Release()
+	if it.Next() {
+		return 0
+	}
+	return SchemaVersion
+}
+
+func (dbm *DatabaseManager) saveSchemaVersion(version int) error {
+	versionByte, _ := json.Marshal(version)
+	return dbm.db.Put(schemaVersionKey, versionByte)
+}
+
+// 启动时把数据库迁移到当前的格式版本
+func (dbm *DatabaseManager) Migrate() error {
+	version := dbm.GetSchemaVersion()
+	if version > SchemaVersion {
+		return ErrSchemaTooNew
+	}
+	if version < 2 {
+		if err := dbm.migrateLegacyKeys(version); err != nil {
+			return err
+		}
+		log.Println("Migrated database from schema version", version, "to", SchemaVersion)
+	}
+	return dbm.saveSchemaVersion(SchemaVersion)
+}
+
+// 按前缀迁移旧版本的字符串key, key的后缀无法解析时保留原记录
+//
+// 记录分多个批次写入, 开始前先写入迁移标记, 最后一个批次写入新版本并删除
+// 标记. 中断后 GetSchemaVersion 仍返回旧版本, 已迁移的记录不再匹配旧前缀,
+// 重新执行会迁移剩余的记录.
+func (dbm *DatabaseManager) migrateLegacyKeys(from int) error {
+	fromByte, _ := json.Marshal(from)
+	if err := dbm.db.Put(schemaMigrationKey, fromByte); err != nil {
+		return err
+	}
+	batch := dbm.db.NewBatch()
+	flush := func() error {
+		if batch.ValueSize() < IdealBatchSize {
+			return nil
+		}
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+		return nil
+	}
+	move := func(prefix string, convert func(rest string, value []byte) ([]byte, []byte, bool)) error {
+		it := dbm.db.NewIteratorWithPrefix([]byte(prefix))
+		defer it.Release()
+		for it.Next() {
+			key, value, ok := convert(string(it.Key()[len(prefix):]), common.CopyBytes(it.Value()))
+			if !ok {
+				continue
+			}
+			batch.Put(key, value)
+			batch.Delete(common.CopyBytes(it.Key()))
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		return it.Error()
+	}
+	byHash := func(keyFn func(common.Hash) []byte) func(string, []byte) ([]byte, []byte, bool) {
+		return func(rest string, value []byte) ([]byte, []byte, bool) {
+			hash, ok := parseLegacyHash(rest)
+			return keyFn(hash), value, ok
+		}
+	}
+	byAddressAndHash := func(keyFn func(common.Address, common.Hash) []byte) func(string, []byte) ([]byte, []byte, bool) {
+		return func(rest string, value []byte) ([]byte, []byte, bool) {
+			parts := strings.SplitN(rest, ".", 2)
+			if len(parts) != 2 || !common.IsHexAddress(parts[0]) {
+				return nil, nil, false
+			}
+			hash, ok := parseLegacyHash(parts[1])
+			return keyFn(common.HexToAddress(parts[0]), hash), value, ok
+		}
+	}
+
+	steps := []struct {
+		prefix  string
+		convert func(string, []byte) ([]byte, []byte, bool)
+	}{
+		{config.ConstDBUnitPrefix, byHash(unitKey)},
+		// SaveBallToDb 和 SaveBalls 共用了前缀, 只有hash的记录属于 SaveBalls
+		{config.ConstDBBallPrefix, func(rest string, value []byte) ([]byte, []byte, bool) {
+			hash, ok := parseLegacyHash(rest)
+			if len(value) == common.HashLength {
+				return stableBallKey(hash), value, ok
+			}
+			return ballKey(hash), value, ok
+		}},
+		{config.ConstDBChildrenHash, byHash(childrenKey)},
+		{config.ConstDBStableUnitsPrefix, byHash(stableUnitsKey)},
+		{config.ConstDBParentListPrefix, byHash(parentKey)},
+		{config.ConstDBWitnessListPrefix, func(rest string, value []byte) ([]byte, []byte, bool) {
+			return witnessKey(common.HexToAddress(rest)), value, common.IsHexAddress(rest)
+		}},
+		{config.ConstDBOutputPrefix, byAddressAndHash(utxoKey)},
+		{config.ConstDBPendingUnitPrefix, byAddressAndHash(pendingUTXOKey)},
+		{config.ConstCacheUnit, byHash(cacheUnitKey)},
+		{"vote.activity.", func(rest string, value []byte) ([]byte, []byte, bool) {
+			parts := strings.SplitN(rest, ".", 2)
+			if len(parts) != 2 || !common.IsHexAddress(parts[1]) {
+				return nil, nil, false
+			}
+			round, err := strconv.ParseInt(parts[0], 10, 64)
+			return voteActivityKey(round, common.HexToAddress(parts[1])), value, err == nil
+		}},
+		{config.ConstDBVoteResult, migrateLegacyVoteResult(from)},
+	}
+	for _, step := range steps {
+		if err := move(step.prefix, step.convert); err != nil {
+			return err
+		}
+	}
+	if data, err := dbm.db.Get([]byte(config.ConstDBVoteRound)); err == nil {
+		batch.Put(voteRoundKey, data)
+		batch.Delete([]byte(config.ConstDBVoteRound))
+	}
+	batch.Delete([]byte(legacyVoteSchemaKey))
+	versionByte, _ := json.Marshal(SchemaVersion)
+	batch.Put(schemaVersionKey, versionByte)
+	batch.Delete(schemaMigrationKey)
+	return batch.Write()
+}
+
+// 迁移一条投票结果
+//
+// 版本0的开始时间和结束时间使用了相同的json标签 "time_stamp", 编码时两个
+// 字段都被忽略, 所以版本0的投票结果中没有保存时间, 也无法恢复. 迁移后这些
+// 结果的开始和结束时间为0, 其他字段不变.
+func migrateLegacyVoteResult(from int) func(string, []byte) ([]byte, []byte, bool) {
+	return func(rest string, value []byte) ([]byte, []byte, bool) {
+		round, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			return nil, nil, false
+		}
+		if from >= 1 {
+			return voteResultKey(round), value, true
+		}
+		var result types.VoteResult
+		if err := json.Unmarshal(value, &result); err != nil {
+			return nil, nil, false
+		}
+		resultByte, err := json.Marshal(result)
+		return voteResultKey(round), resultByte, err == nil
+	}
+}
+
+func parseLegacyHash(s string) (common.Hash, bool) {
+	if len(s) != 2+2*common.HashLength || !strings.HasPrefix(s, "0x") {
+		return common.Hash{}, false
+	}
+	return common.HexToHash(s), true
+}
@@ -1,31 +1,38 @@
 package node
 
 import (
+	"babyboy-dag/common"
+	"babyboy-dag/core/types"
+	"babyboy-dag/dag"
 	"errors"
 	"fmt"
 	"babyboy-dag/p2p/discover"
 	"babyboy-dag/p2p"
+	"strings"
+	"time"
 )
 
 var (
 	ErrNodeStopped    = errors.New("node not started")
+	ErrDevRounds      = errors.New("number of rounds must be positive")
+	ErrNotReplaced    = errors.New("witness has not been replaced")
 )
 
-// PrivateAdminAPI is the collection of administrative API methods exposed only
-// over a secure RPC channel.
-type PrivateAdminAPI struct {
+// PrivatePeerListAPI holds the admin methods that change the static, trusted and
+// banned peers of the node. It is served over IPC only.
+type PrivatePeerListAPI struct {
 	node *Node // Node interfaced by this API
 }
 
-// NewPrivateAdminAPI creates a new API definition for the private admin methods
-// of the node itself.
-func NewPrivateAdminAPI(node *Node) *PrivateAdminAPI {
-	return &PrivateAdminAPI{node: node}
+// NewPrivatePeerListAPI creates a new API definition for the static, trusted and
+// banned peer methods.
+func NewPrivatePeerListAPI(node *Node) *PrivatePeerListAPI {
+	return &PrivatePeerListAPI{node: node}
 }
 
 // AddPeer requests connecting to a remote node, and also maintaining the new
 // connection at all times, even reconnecting if it is lost.
-func (api *PrivateAdminAPI) AddPeer(url string) (bool, error) {
+func (api *PrivatePeerListAPI) AddPeer(url string) (bool, error) {
 	// Make sure the server is running, fail otherwise
 	server := api.node.Server()
 
@@ -38,11 +45,14 @@ func (api *PrivateAdminAPI) AddPeer(url string) (bool, error) {
 		return false, fmt.Errorf("invalid enode: %v", err)
 	}
 	server.AddPeer(node)
+	if err := api.node.updateNodeList(datadirStaticNodes, node, true); err != nil {
+		return true, err
+	}
 	return true, nil
 }
 
 // RemovePeer disconnects from a a remote node if the connection exists
-func (api *PrivateAdminAPI) RemovePeer(url string) (bool, error) {
+func (api *PrivatePeerListAPI) RemovePeer(url string) (bool, error) {
 	// Make sure the server is running, fail otherwise
 	server := api.node.Server()
 	if server == nil {
@@ -54,9 +64,110 @@ func (api *PrivateAdminAPI) RemovePeer(url string) (bool, error) {
 		return false, fmt.Errorf("invalid enode: %v", err)
 	}
 	server.RemovePeer(node)
+	if err := api.node.updateNodeList(datadirStaticNodes, node, false); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// AddTrustedPeer allows a remote node to always connect, even if slots are full.
+// The node is kept in the trusted node list of the datadir.
+func (api *PrivatePeerListAPI) AddTrustedPeer(url string) (bool, error) {
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	node, err := discover.ParseNode(url)
+	if err != nil {
+		return false, fmt.Errorf("invalid enode: %v", err)
+	}
+	server.AddTrustedPeer(node)
+	if err := api.node.updateNodeList(datadirTrustedNodes, node, true); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// RemoveTrustedPeer removes a remote node from the trusted peer set, but it
+// does not disconnect it automatically.
+func (api *PrivatePeerListAPI) RemoveTrustedPeer(url string) (bool, error) {
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	node, err := discover.ParseNode(url)
+	if err != nil {
+		return false, fmt.Errorf("invalid enode: %v", err)
+	}
+	server.RemoveTrustedPeer(node)
+	if err := api.node.updateNodeList(datadirTrustedNodes, node, false); err != nil {
+		return true, err
+	}
 	return true, nil
 }
 
+// BanPeer disconnects a remote node, given by enode URL or ID, and refuses its
+// connections for the given number of seconds (forever if zero or omitted).
+func (api *PrivatePeerListAPI) BanPeer(id string, seconds *uint64, reason *string) (p2p.Ban, error) {
+	server := api.node.Server()
+	if server == nil {
+		return p2p.Ban{}, ErrNodeStopped
+	}
+	nodeID, err := parseNodeID(id)
+	if err != nil {
+		return p2p.Ban{}, err
+	}
+	var expires time.Time
+	if seconds != nil && *seconds > 0 {
+		expires = time.Now().Add(time.Duration(*seconds) * time.Second)
+	}
+	why := ""
+	if reason != nil {
+		why = *reason
+	}
+	ban := server.BanPeer(nodeID, expires, why)
+	return ban, api.node.saveBans()
+}
+
+// UnbanPeer lifts the ban of a remote node, given by enode URL or ID.
+func (api *PrivatePeerListAPI) UnbanPeer(id string) (bool, error) {
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	nodeID, err := parseNodeID(id)
+	if err != nil {
+		return false, err
+	}
+	ok := server.UnbanPeer(nodeID)
+	return ok, api.node.saveBans()
+}
+
+// ListBans returns the bans in force.
+func (api *PrivatePeerListAPI) ListBans() ([]p2p.Ban, error) {
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.Bans(), nil
+}
+
+// parseNodeID accepts an enode URL or a hex node ID.
+func parseNodeID(id string) (discover.NodeID, error) {
+	if strings.HasPrefix(id, "enode://") {
+		node, err := discover.ParseNode(id)
+		if err != nil {
+			return discover.NodeID{}, fmt.Errorf("invalid enode: %v", err)
+		}
+		return node.ID, nil
+	}
+	nodeID, err := discover.HexID(id)
+	if err != nil {
+		return discover.NodeID{}, fmt.Errorf("invalid node ID: %v", err)
+	}
+	return nodeID, nil
+}
+
 func (api *PublicAdminAPI) NodeInfo() (*p2p.NodeInfo, error) {
 	server := api.node.Server()
 	if server == nil {
@@ -91,12 +202,158 @@ func (api *PublicAdminAPI) Datadir() string {
 	return api.node.DataDir()
 }
 
+// RpcMethods retrieves the callable methods of every registered RPC namespace,
+// used by attached consoles for tab completion.
+func (api *PublicAdminAPI) RpcMethods() map[string][]string {
+	return api.node.apiMethods()
+}
+
 // Peers retrieves all the information we know about each individual peer at the
-// protocol granularity.
-func (api *PublicAdminAPI) Peers() ([]*p2p.PeerInfo, error) {
+// protocol granularity, along with its reputation.
+func (api *PublicAdminAPI) Peers() ([]*PeerInfo, error) {
 	server := api.node.Server()
 	if server == nil {
 		return nil, ErrNodeStopped
 	}
-	return server.PeersInfo(), nil
-}
\ No newline at end of file
+	infos := server.PeersInfo()
+	peers := make([]*PeerInfo, len(infos))
+	for i, info := range infos {
+		peers[i] = &PeerInfo{PeerInfo: info}
+		if id, err := discover.HexID(info.ID); err == nil {
+			peers[i].Reputation = api.node.scores.score(id)
+		}
+	}
+	return peers, nil
+}
+// PrivateDevAPI is the collection of developer network methods, only served
+// when the node runs with --dev.
+type PrivateDevAPI struct {
+	node *Node // Node interfaced by this API
+}
+
+// NewPrivateDevAPI creates a new API definition for the developer network
+// methods of the node.
+func NewPrivateDevAPI(node *Node) *PrivateDevAPI {
+	return &PrivateDevAPI{node: node}
+}
+
+// Advance posts the given number of witness rounds (one by default), one unit
+// per witness each, and returns the hashes of the posted units.
+func (api *PrivateDevAPI) Advance(rounds *int) ([]common.Hash, error) {
+	count := 1
+	if rounds != nil {
+		count = *rounds
+	}
+	if count <= 0 {
+		return nil, ErrDevRounds
+	}
+	return api.node.dev.advance(count)
+}
+
+// PublicVoteAPI provides an API to inspect the witness replacement voting.
+type PublicVoteAPI struct {
+	node *Node // Node interfaced by this API
+}
+
+// NewPublicVoteAPI creates a new API definition for the witness voting.
+func NewPublicVoteAPI(node *Node) *PublicVoteAPI {
+	return &PublicVoteAPI{node: node}
+}
+
+// VoteRoundInfo describes the vote round currently collecting stable units.
+type VoteRoundInfo struct {
+	Round        int64 `json:"round"`
+	StartMCI     int64 `json:"startMci"`
+	EndMCI       int64 `json:"endMci"`
+	TalliedRound int64 `json:"talliedRound"` // Last closed round, -1 if none
+	AppliedRound int64 `json:"appliedRound"` // Last round whose result is in force
+}
+
+// Round returns the open vote round and how far tallying and replacement got.
+func (api *PublicVoteAPI) Round() VoteRoundInfo {
+	wdb := api.node.witnessMemDB
+	round := wdb.GetVoteRound() + 1
+	return VoteRoundInfo{
+		Round:        round,
+		StartMCI:     round * dag.VoteRoundLength,
+		EndMCI:       (round+1)*dag.VoteRoundLength - 1,
+		TalliedRound: wdb.GetVoteRound(),
+		AppliedRound: wdb.GetReplaceRound(),
+	}
+}
+
+// Result returns the outcome of a closed vote round.
+func (api *PublicVoteAPI) Result(round int64) (types.VoteResult, error) {
+	return api.node.dbManager.GetVoteResult(round)
+}
+
+// Candidates returns the activity of the witnesses and of every other author
+// in the given round, the open round by default.
+func (api *PublicVoteAPI) Candidates(round *int64) []dag.Candidate {
+	r := api.node.witnessMemDB.GetVoteRound() + 1
+	if round != nil {
+		r = *round
+	}
+	return dag.NewWitnessVoter(api.node.dbManager, api.node.witnessMemDB).Candidates(r)
+}
+
+// Witnesses returns the witness list currently in force.
+func (api *PublicVoteAPI) Witnesses() []common.Address {
+	return api.node.Witnesses()
+}
+
+// History returns the results of the closed rounds between from and to
+// (inclusive, the last closed round by default).
+func (api *PublicVoteAPI) History(from int64, to *int64) []types.VoteResult {
+	last := api.node.witnessMemDB.GetVoteRound()
+	if to != nil {
+		last = *to
+	}
+	return dag.NewVoteHistory(api.node.dbManager, api.node.witnessMemDB).Rounds(from, last)
+}
+
+// Replacements returns every round that replaced a witness, including the
+// ones not in force yet.
+func (api *PublicVoteAPI) Replacements() []types.VoteResult {
+	return dag.NewVoteHistory(api.node.dbManager, api.node.witnessMemDB).Replacements()
+}
+
+// ReplacedAt returns the round in which the given witness was voted out.
+func (api *PublicVoteAPI) ReplacedAt(witness common.Address) (*types.VoteResult, error) {
+	result, ok := dag.NewVoteHistory(api.node.dbManager, api.node.witnessMemDB).ReplacementOf(witness)
+	if !ok {
+		return nil, ErrNotReplaced
+	}
+	return &result, nil
+}
+
+// WitnessesAt returns the witness list in force at the given main chain index.
+func (api *PublicVoteAPI) WitnessesAt(mci int64) []common.Address {
+	return dag.NewVoteHistory(api.node.dbManager, api.node.witnessMemDB).WitnessListAt(mci)
+}
+
+// PublicOutboxAPI provides an API to follow the delivery of the units authored
+// by this node.
+type PublicOutboxAPI struct {
+	node *Node // Node interfaced by this API
+}
+
+// NewPublicOutboxAPI creates a new API definition for the outbound unit queue.
+func NewPublicOutboxAPI(node *Node) *PublicOutboxAPI {
+	return &PublicOutboxAPI{node: node}
+}
+
+// Status returns the queued units, oldest first, followed by the units that
+// recently reached enough peers.
+func (api *PublicOutboxAPI) Status() []OutboxEntry {
+	return api.node.outbox.status()
+}
+
+// Unit returns the delivery state of a unit authored by this node, "unknown"
+// if it is neither queued nor recently delivered.
+func (api *PublicOutboxAPI) Unit(hash common.Hash) OutboxEntry {
+	if entry, ok := api.node.outbox.lookup(hash); ok {
+		return entry
+	}
+	return OutboxEntry{Hash: hash, State: OutboxUnknown, Peers: []string{}}
+}
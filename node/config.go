@@ -3,14 +3,31 @@ package node
 import (
 	"babyboy-dag/accounts"
 	"babyboy-dag/accounts/keystore"
+	"babyboy-dag/config"
+	"babyboy-dag/core"
+	"babyboy-dag/crypto"
+	"babyboy-dag/dag/memdb"
 	"babyboy-dag/p2p"
+	"babyboy-dag/p2p/discover"
+	"crypto/ecdsa"
+	"encoding/json"
 	"io/ioutil"
+	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 )
 
 const (
-	datadirDefaultKeyStore = "keystore" // Path within the datadir to the keystore
+	datadirDefaultKeyStore = "keystore"           // Path within the datadir to the keystore
+	datadirPrivateKey      = "nodekey"            // Path within the datadir to the node's private key
+	datadirNodeDatabase    = "nodes"              // Path within the datadir to store the node infos
+	datadirStaticNodes     = "static-nodes.json"  // Path within the datadir to the static node list
+	datadirTrustedNodes    = "trusted-nodes.json" // Path within the datadir to the trusted node list
+	datadirBannedNodes     = "banned-nodes.json"  // Path within the datadir to the ban list
 )
 
 type Config struct {
@@ -22,9 +39,56 @@ type Config struct {
 	// in memory.
 	DataDir string
 
+	// Genesis selects the network to join. Nil means mainnet, other networks
+	// are chosen with --testnet or --genesis and get their own data directory.
+	Genesis *core.Genesis `toml:"-"`
+
+	// Dev turns the node into a single node developer network whose witnesses
+	// are all driven by the node itself (--dev).
+	Dev *DevConfig `toml:"-"`
+
+	// Light turns the node into a light node that keeps no DAG and composes
+	// its units with the help of trusted hubs (--light, --hubs).
+	Light *LightConfig `toml:",omitempty"`
+
 	// Configuration of peer-to-peer networking.
 	P2P p2p.Config
 
+	// NAT is the port mapping mechanism to use for the p2p listener, in the form
+	// accepted by nat.Parse (e.g. "any", "none", "upnp", "pmp", "extip:<IP>").
+	// It overrides P2P.NAT when set.
+	NAT string `toml:",omitempty"`
+
+	// DatabaseCache is the amount of memory (in megabytes) to allocate to the
+	// internal leveldb caching, DatabaseHandles the number of open files it may
+	// use. Values below the leveldb minimums are raised to them.
+	DatabaseCache   int
+	DatabaseHandles int
+
+	// Ephemeral keeps the database in memory instead of DataDir, everything
+	// is lost when the node stops.
+	Ephemeral bool `toml:",omitempty"`
+
+	// TipPolicy decides which tips new units of this node reference as parents.
+	TipPolicy memdb.TipPolicy
+
+	// UnitAckPeers is the number of peers a unit authored by this node must
+	// reach before it leaves the outbound queue.
+	UnitAckPeers int
+
+	// Roles are advertised as discovery v5 topics, so that other nodes can
+	// look up full nodes, witnesses and hubs serving light clients. Nil
+	// advertises the full role, and the light role if MaxLightClients > 0.
+	Roles []string `toml:",omitempty"`
+
+	// MaxLightClients caps the number of light clients served through the
+	// hub API at a time, 0 serves none.
+	MaxLightClients int
+
+	// MetricsAddr is the address of the HTTP server exporting the metrics in
+	// the Prometheus format at /metrics. Empty disables it.
+	MetricsAddr string `toml:",omitempty"`
+
 	// KeyStoreDir is the file system folder that contains private keys. The directory can
 	// be specified as a relative path, in which case it is resolved relative to the
 	// current directory.
@@ -37,6 +101,28 @@ type Config struct {
 	// Rpc Server
 	RpcServer string
 
+	// HTTPCors is the Cross-Origin Resource Sharing header to send to requesting
+	// clients. Please be aware that CORS is a browser enforced security, it's fully
+	// useless for custom HTTP clients.
+	HTTPCors []string `toml:",omitempty"`
+
+	// HTTPVirtualHosts is the list of virtual hostnames which are allowed on incoming requests.
+	// This is by default {'localhost'}. Using this prevents attacks like
+	// DNS rebinding, which bypasses SOP by simply masquerading as being within the same
+	// origin. These attacks do not utilize CORS, since they are not cross-domain.
+	HTTPVirtualHosts []string `toml:",omitempty"`
+
+	// HTTPModules is a list of API modules to expose via the HTTP RPC interface.
+	// If the module list is empty, all RPC API endpoints designated public will be
+	// exposed.
+	HTTPModules []string `toml:",omitempty"`
+
+	// IPCPath is the requested location to place the IPC endpoint. If the path is
+	// a simple file name, it is placed inside the data directory (or on the root
+	// pipe path on Windows), whereas if it's a resolvable path name (absolute or
+	// relative), then that specific path is enforced. An empty path disables IPC.
+	IPCPath string `toml:",omitempty"`
+
 	// ReplaceWitness Server
 	RemoteServer string
 }
@@ -69,6 +155,181 @@ func (c *Config) AccountConfig() (int, int, string, error) {
 	return scryptN, scryptP, keydir, err
 }
 
+// IPCEndpoint resolves an IPC endpoint based on a configured value, taking into
+// account the set data folders as well as the designated platform we're currently
+// running on.
+func (c *Config) IPCEndpoint() string {
+	// Short circuit if IPC has not been enabled
+	if c.IPCPath == "" {
+		return ""
+	}
+	// On windows we can only use plain top-level pipes
+	if runtime.GOOS == "windows" {
+		if strings.HasPrefix(c.IPCPath, `\\.\pipe\`) {
+			return c.IPCPath
+		}
+		return `\\.\pipe\` + c.IPCPath
+	}
+	// Resolve names into the data directory full paths otherwise
+	if filepath.Base(c.IPCPath) == c.IPCPath {
+		if c.DataDir == "" {
+			return filepath.Join(os.TempDir(), c.IPCPath)
+		}
+		return filepath.Join(c.DataDir, c.IPCPath)
+	}
+	return c.IPCPath
+}
+
+// DatabaseDir returns the directory of the leveldb database within DataDir.
+func (c *Config) DatabaseDir() string {
+	return path.Join(c.DataDir, config.Const_DATABASE_PATH+config.Const_DATABASE_NAME)
+}
+
+// NodeKey retrieves the currently configured private key of the node, checking
+// first any manually set key, falling back to the one found in the configured
+// data folder. If no key can be found, a new one is generated and stored there.
+func (c *Config) NodeKey() *ecdsa.PrivateKey {
+	// Use any specifically configured key.
+	if c.P2P.PrivateKey != nil {
+		return c.P2P.PrivateKey
+	}
+	// Generate ephemeral key if no datadir is being used.
+	if c.DataDir == "" || c.Ephemeral {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			log.Fatalf("Failed to generate ephemeral node key: %v", err)
+		}
+		return key
+	}
+
+	keyfile := c.NodeKeyFile()
+	if key, err := crypto.LoadECDSA(keyfile); err == nil {
+		return key
+	}
+	// No persistent key found, generate and store a new one.
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		log.Fatalf("Failed to generate node key: %v", err)
+	}
+	if err := os.MkdirAll(c.DataDir, 0700); err != nil {
+		log.Printf("Failed to persist node key: %v", err)
+		return key
+	}
+	if err := crypto.SaveECDSA(keyfile, key); err != nil {
+		log.Printf("Failed to persist node key: %v", err)
+	}
+	return key
+}
+
+// NodeKeyFile returns the path of the node key within DataDir.
+func (c *Config) NodeKeyFile() string {
+	return filepath.Join(c.DataDir, datadirPrivateKey)
+}
+
+// NodeDB returns the path to the discovery node database, empty for nodes
+// without persistent storage (the discovery database is then kept in memory).
+func (c *Config) NodeDB() string {
+	if c.DataDir == "" || c.Ephemeral {
+		return ""
+	}
+	return filepath.Join(c.DataDir, datadirNodeDatabase)
+}
+
+// StaticNodes returns a list of node enode URLs configured as static nodes.
+func (c *Config) StaticNodes() []*discover.Node {
+	return c.parsePersistentNodes(c.nodeListFile(datadirStaticNodes))
+}
+
+// TrustedNodes returns a list of node enode URLs configured as trusted nodes.
+func (c *Config) TrustedNodes() []*discover.Node {
+	return c.parsePersistentNodes(c.nodeListFile(datadirTrustedNodes))
+}
+
+// BannedNodes returns the bans stored in the datadir that did not expire yet.
+func (c *Config) BannedNodes() []p2p.Ban {
+	path := c.nodeListFile(datadirBannedNodes)
+	if path == "" {
+		return nil
+	}
+	var bans []p2p.Ban
+	if err := loadJSON(path, &bans); err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Can't load node file %s: %v", path, err)
+		}
+		return nil
+	}
+	now := time.Now()
+	active := make([]p2p.Ban, 0, len(bans))
+	for _, ban := range bans {
+		if !ban.Expired(now) {
+			active = append(active, ban)
+		}
+	}
+	return active
+}
+
+// nodeListFile returns the path of a node list within DataDir, empty for nodes
+// without persistent storage.
+func (c *Config) nodeListFile(name string) string {
+	if c.DataDir == "" || c.Ephemeral {
+		return ""
+	}
+	return filepath.Join(c.DataDir, name)
+}
+
+// parsePersistentNodes parses a list of discovery node URLs loaded from a .json
+// file from within the data directory.
+func (c *Config) parsePersistentNodes(path string) []*discover.Node {
+	if path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	// Load the nodes from the config file.
+	var nodelist []string
+	if err := loadJSON(path, &nodelist); err != nil {
+		log.Printf("Can't load node file %s: %v", path, err)
+		return nil
+	}
+	// Interpret the list as a discovery node array
+	var nodes []*discover.Node
+	for _, url := range nodelist {
+		if url == "" {
+			continue
+		}
+		node, err := discover.ParseNode(url)
+		if err != nil {
+			log.Printf("Node URL %s: %v", url, err)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// loadJSON reads the given file and unmarshals its content.
+func loadJSON(file string, val interface{}) error {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, val)
+}
+
+// saveJSON marshals val into the given file, replacing it atomically.
+func saveJSON(file string, val interface{}) error {
+	content, err := json.MarshalIndent(val, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
 func (c *Config) GetConfig() string {
 	return c.DataDir
 }
@@ -1,23 +1,35 @@
 package node
 
 import (
+	"babyboy-dag/dag/memdb"
 	"babyboy-dag/p2p"
-	"babyboy-dag/p2p/nat"
 	"os"
 	"os/user"
 	"path/filepath"
 	"runtime"
 )
 
+const (
+	DefaultIPCPath = "babyboy.ipc" // Default IPC endpoint file name within the datadir
+	DefaultHubPort = 8545          // Default RPC port of the hubs found by discovery
+)
+
 // DefaultConfig contains reasonable default settings.
 var DefaultConfig = Config{
-	DataDir:      "data/",
-	RpcServer:    "0.0.0.0:8545",
-	RemoteServer: "http://192.168.1.13:8888",
+	DataDir:          "data/",
+	RpcServer:        "0.0.0.0:8545",
+	HTTPVirtualHosts: []string{"localhost"},
+	IPCPath:          DefaultIPCPath,
+	RemoteServer:     "http://192.168.1.13:8888",
+	NAT:              "any",
+	DatabaseCache:    128,
+	DatabaseHandles:  256,
+	TipPolicy:        memdb.DefaultTipPolicy,
+	UnitAckPeers:     2,
+	MaxLightClients:  50,
 	P2P: p2p.Config{
 		ListenAddr: ":3000",
-		MaxPeers:   25,
-		NAT:        nat.Any(),
+		MaxPeers:   100,
 	},
 }
 
@@ -0,0 +1,161 @@
+package node
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"babyboy-dag/accounts"
+	"babyboy-dag/accounts/keystore"
+	"babyboy-dag/common"
+	"babyboy-dag/core/types"
+	"babyboy-dag/crypto"
+	"babyboy-dag/transaction"
+)
+
+// devUnitTimeout is how long the developer witness waits for one of its units
+// to be handled before giving up on the round.
+const devUnitTimeout = 5 * time.Second
+
+// DevConfig holds the settings of the single node developer network, in which
+// the node controls every witness of the genesis.
+type DevConfig struct {
+	// WitnessKeys are the ephemeral keys of the genesis witnesses.
+	WitnessKeys []*ecdsa.PrivateKey
+
+	// Accounts are the pre-funded accounts, imported into the keystore with
+	// Password so they can be used through the wallet RPCs.
+	Accounts []*ecdsa.PrivateKey
+	Password string
+
+	// Period is the interval between two witness rounds. Zero disables the
+	// schedule, rounds are then only posted through dev_advance.
+	Period time.Duration
+}
+
+// devWitness posts the units of all witnesses of a developer network, one unit
+// per witness and round, so that payments become stable within seconds.
+type devWitness struct {
+	node   *Node
+	keys   []*ecdsa.PrivateKey
+	period time.Duration
+	lock   sync.Mutex // serializes rounds of the schedule and of dev_advance
+	quit   chan struct{}
+	once   sync.Once
+}
+
+func newDevWitness(n *Node, conf *DevConfig) *devWitness {
+	return &devWitness{node: n, keys: conf.WitnessKeys, period: conf.Period, quit: make(chan struct{})}
+}
+
+// stop terminates the schedule, rounds in progress are completed.
+func (w *devWitness) stop() {
+	w.once.Do(func() { close(w.quit) })
+}
+
+// importAccounts adds the pre-funded accounts to the keystore and prints them
+// along with the witnesses.
+func (w *devWitness) importAccounts(conf *DevConfig) {
+	ks := w.node.fetchKeystore(w.node.accmgr)
+
+	fmt.Println("Developer network, pre-funded accounts (password \"" + conf.Password + "\"):")
+	for _, key := range conf.Accounts {
+		if _, err := ks.ImportECDSA(key, conf.Password); err != nil && err != keystore.ErrAccountAlreadyExists {
+			log.Println("Failed to import developer account:", err)
+		}
+		w.printKey(key)
+	}
+	fmt.Println("Developer witnesses:")
+	for _, key := range w.keys {
+		w.printKey(key)
+	}
+}
+
+func (w *devWitness) printKey(key *ecdsa.PrivateKey) {
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	fmt.Printf("  %s  %d  (key %s)\n", address.String(), w.node.genesis.Alloc[address], hex.EncodeToString(crypto.FromECDSA(key)))
+}
+
+// loop posts a witness round every period until the witness is stopped.
+func (w *devWitness) loop() {
+	if w.period <= 0 {
+		return
+	}
+	ticker := time.NewTicker(w.period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.quit:
+			return
+		}
+		// A detached node is offline, its witnesses post nothing
+		if !w.node.online() {
+			continue
+		}
+		if _, err := w.advance(1); err != nil {
+			log.Println("Developer witness round failed:", err)
+		}
+	}
+}
+
+// advance posts the given number of witness rounds and returns the hashes of
+// the units posted.
+func (w *devWitness) advance(rounds int) ([]common.Hash, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	// Every unit has to be handled before the next one is built, otherwise it
+	// would not be referenced as parent and the witnessed level would stall.
+	done := make(chan transaction.TXEvent, 64)
+	sub := w.node.transaction.Subscribe(done)
+	defer sub.Unsubscribe()
+
+	var hashes []common.Hash
+	for i := 0; i < rounds; i++ {
+		for _, key := range w.keys {
+			unit, err := w.node.transaction.CreateWitnessUnit()
+			if err != nil {
+				return hashes, err
+			}
+			if unit, err = w.node.signUnitWithKey(unit, key); err != nil {
+				return hashes, err
+			}
+			w.node.SubmitUnit(unit)
+			if err := waitUnitHandled(done, unit.Hash); err != nil {
+				return hashes, err
+			}
+			hashes = append(hashes, unit.Hash)
+		}
+	}
+	return hashes, nil
+}
+
+func waitUnitHandled(done <-chan transaction.TXEvent, hash common.Hash) error {
+	timeout := time.NewTimer(devUnitTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case ev := <-done:
+			if ev.Kind == transaction.NewUnitHandleDone && ev.NewUnitEntity.NewUnit.Hash == hash {
+				return nil
+			}
+		case <-timeout.C:
+			return fmt.Errorf("unit %s not handled within %v", hash.String(), devUnitTimeout)
+		}
+	}
+}
+
+// signUnitWithKey is like SignUnit, but signs with a key held in memory
+// instead of a keystore account.
+func (n *Node) signUnitWithKey(unit types.Unit, key *ecdsa.PrivateKey) (types.Unit, error) {
+	account := accounts.Account{Address: crypto.PubkeyToAddress(key.PublicKey)}
+	return n.sealUnit(unit, account, func(hash []byte) ([]byte, error) {
+		return crypto.Sign(hash, key)
+	})
+}
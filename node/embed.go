@@ -0,0 +1,184 @@
+package node
+
+import (
+	"log"
+	"sync"
+
+	"babyboy-dag/boy"
+	"babyboy-dag/boydb"
+	"babyboy-dag/common"
+	"babyboy-dag/crypto"
+	"babyboy-dag/dag"
+	"babyboy-dag/p2p"
+	"babyboy-dag/rpc"
+)
+
+// Protocols returns the DAG protocols of the node, for running the node on a
+// p2p server it does not own (see Attach).
+func (n *Node) Protocols() []p2p.Protocol {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.protocolManager == nil {
+		n.protocolManager, _ = boy.NewProtocolManager(n.genesis.NetworkID)
+		n.protocolManager.EventBus = n.eventBus
+	}
+	return n.wire.extend(n.protocolManager.Protocol())
+}
+
+// APIs returns the RPC APIs of the node, for serving them from the stack the
+// node is embedded in.
+func (n *Node) APIs() []rpc.API {
+	return n.apis()
+}
+
+// Attach starts the node on a server running its Protocols instead of a p2p
+// server of its own, e.g. on a node of the p2p simulations. A node attached
+// again after Detach resumes with the DAG it had.
+func (n *Node) Attach(srv *p2p.Server) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.light != nil {
+		return ErrAttachLight
+	}
+	if n.protocolManager == nil {
+		return ErrAttachProtocols
+	}
+	if n.server != nil {
+		return ErrAttached
+	}
+	n.server = srv
+	n.protocolManager.Self = srv.NodeInfo().ID[:8]
+
+	var err error
+	n.attachOnce.Do(func() {
+		if err = n.initDatabase(); err != nil {
+			return
+		}
+		n.initGenesis()
+		if n.stableStates != nil {
+			n.recordStableState()
+		}
+		n.protocolManager.StartTimer()
+		n.initEventBus()
+		n.outbox.start()
+
+		if n.dev != nil {
+			n.dev.importAccounts(n.config.Dev)
+			go n.dev.loop()
+		}
+		log.Println("DAG node attached to", srv.NodeInfo().ID[:16])
+	})
+	return err
+}
+
+// Detach stops using the server the node was attached to. The DAG is kept,
+// witness rounds of the node pause until it is attached again.
+func (n *Node) Detach() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.server = nil
+}
+
+// online tells whether the node has a running p2p server.
+func (n *Node) online() bool {
+	return n.Server() != nil
+}
+
+// LastStableBall returns the hash of the last stable ball on the main chain.
+func (n *Node) LastStableBall() common.Hash {
+	graphInfo := dag.NewGraphInfoGetter(n.dbManager, n.parentMemDB.GetDagAllTips(), n.witnessMemDB.GetWitnessesAsHash())
+	return graphInfo.GetLastStableBall()
+}
+
+// LastStableMCI returns the main chain index of the last stable ball.
+func (n *Node) LastStableMCI() uint64 {
+	return n.lastStableMCI()
+}
+
+// UnspentDigest returns the number of stable unspent outputs and a hash over
+// all of them, equal on nodes that agree on the UTXO set.
+func (n *Node) UnspentDigest() (int, common.Hash, error) {
+	prefix, err := boydb.PrefixByName("utxo")
+	if err != nil {
+		return 0, common.Hash{}, err
+	}
+	var (
+		count int
+		data  []byte
+	)
+	// 记录按键排序, 键包含地址和输出的哈希
+	err = n.dbManager.Dump(prefix, func(key, value []byte) bool {
+		count++
+		data = append(data, key...)
+		return true
+	})
+	if err != nil {
+		return 0, common.Hash{}, err
+	}
+	return count, common.BytesToHash(crypto.Keccak256(data)), nil
+}
+
+// stableHistory is the number of main chain indexes a dev node keeps the
+// stable state of.
+const stableHistory = 256
+
+// StableState is the view of a node on the DAG right after a main chain index
+// became stable: its ball and the stable UTXO set.
+type StableState struct {
+	MCI           uint64
+	Ball          common.Hash
+	Unspent       int
+	UnspentDigest common.Hash
+}
+
+// stableStates holds the stable states of the last stableHistory main chain
+// indexes.
+type stableStates struct {
+	lock   sync.Mutex
+	states map[uint64]StableState
+}
+
+func newStableStates() *stableStates {
+	return &stableStates{states: make(map[uint64]StableState)}
+}
+
+// recordStableState records the stable state of the last stable main chain
+// index. It runs when an index becomes stable, before the next one can.
+func (n *Node) recordStableState() {
+	count, digest, err := n.UnspentDigest()
+	if err != nil {
+		log.Println("Failed to record stable state:", err)
+		return
+	}
+	state := StableState{
+		MCI:           n.LastStableMCI(),
+		Ball:          n.LastStableBall(),
+		Unspent:       count,
+		UnspentDigest: digest,
+	}
+	ss := n.stableStates
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	ss.states[state.MCI] = state
+	if state.MCI >= stableHistory {
+		delete(ss.states, state.MCI-stableHistory)
+	}
+}
+
+// StableState returns the stable state of the node at the given main chain
+// index. Only dev nodes record them, for the last stableHistory indexes.
+func (n *Node) StableState(mci uint64) (StableState, bool) {
+	ss := n.stableStates
+	if ss == nil {
+		return StableState{}, false
+	}
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	state, ok := ss.states[mci]
+	return state, ok
+}
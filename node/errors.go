@@ -14,3 +14,33 @@ var (
 	ErrAmountRange   = errors.New("AmountRange Error")
 	ErrLockAccount   = errors.New("LockAccount Error")
 )
+
+var (
+	ErrLightDisabled      = errors.New("node is not running in light mode")
+	ErrLightNoHub         = errors.New("no reachable hub")
+	ErrLightUnitHash      = errors.New("unit hash does not match its content")
+	ErrLightUnitSignature = errors.New("invalid unit signature")
+	ErrLightWitnessProof  = errors.New("invalid witness proof")
+	ErrLightUTXOProof     = errors.New("unspent output does not match its unit")
+	ErrLightWitnessList   = errors.New("hub uses another witness list")
+	ErrLightBallProof     = errors.New("invalid ball proof")
+)
+
+var (
+	ErrStatusExpected   = errors.New("first message must be the status")
+	ErrStatusNetworkID  = errors.New("network ID mismatch")
+	ErrStatusGenesis    = errors.New("genesis mismatch")
+	ErrStatusUnexpected = errors.New("unexpected DAG message")
+	ErrStatusPending    = errors.New("status handshake with the peer not done")
+)
+
+var (
+	ErrHubFull      = errors.New("hub serves the maximum number of light clients")
+	ErrHubNoSession = errors.New("no light client slot, call hub_hello first")
+)
+
+var (
+	ErrAttachLight     = errors.New("light nodes can't be attached to a p2p server")
+	ErrAttachProtocols = errors.New("protocols of the node are not running on the server")
+	ErrAttached        = errors.New("node is already attached to a p2p server")
+)
@@ -0,0 +1,262 @@
+package node
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"babyboy-dag/boy"
+	"babyboy-dag/common"
+	"babyboy-dag/core/types"
+)
+
+const (
+	maxKnownUnits      = 4096             // Units remembered per peer to avoid sending them back
+	gossipPushSize     = 4096             // Units larger than this (JSON bytes) are only announced
+	gossipFetchLimit   = 64               // Units served for a single fetch request
+	gossipFetchTimeout = 10 * time.Second // Delay before an announced unit is requested elsewhere
+)
+
+// knownUnits is a bounded set of unit hashes, the oldest ones are forgotten
+// first.
+type knownUnits struct {
+	set   map[common.Hash]struct{}
+	order []common.Hash
+}
+
+func newKnownUnits() *knownUnits {
+	return &knownUnits{set: make(map[common.Hash]struct{})}
+}
+
+func (k *knownUnits) add(hash common.Hash) {
+	if _, ok := k.set[hash]; ok {
+		return
+	}
+	if len(k.order) >= maxKnownUnits {
+		delete(k.set, k.order[0])
+		k.order = k.order[1:]
+	}
+	k.set[hash] = struct{}{}
+	k.order = append(k.order, hash)
+}
+
+func (k *knownUnits) has(hash common.Hash) bool {
+	_, ok := k.set[hash]
+	return ok
+}
+
+type gossipPeer struct {
+	peer  *boy.Peer
+	known *knownUnits
+}
+
+// gossip propagates units to the peers that do not have them yet. A relayed
+// unit is pushed in full to the square root of those peers and announced by
+// hash to the others, which fetch it if they still miss it. Large units are
+// only announced.
+type gossip struct {
+	node *Node
+
+	lock     sync.Mutex
+	peers    map[string]*gossipPeer // Keyed by node ID
+	fetching map[common.Hash]time.Time
+}
+
+func newGossip(n *Node) *gossip {
+	return &gossip{
+		node:     n,
+		peers:    make(map[string]*gossipPeer),
+		fetching: make(map[common.Hash]time.Time),
+	}
+}
+
+// register starts tracking the units known to a newly connected peer.
+func (g *gossip) register(p *boy.Peer) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.peers[p.ID().String()] = &gossipPeer{peer: p, known: newKnownUnits()}
+}
+
+// live returns the tracked peers that are still connected and drops the
+// others. The caller holds the lock.
+func (g *gossip) live() []*gossipPeer {
+	ids := g.node.protocolManager.GetPeers().GetPeersIds()
+	peers := make([]*gossipPeer, 0, len(ids))
+	for id, gp := range g.peers {
+		connected := false
+		for _, peerID := range ids {
+			connected = connected || peerID != "" && strings.HasPrefix(id, peerID)
+		}
+		if !connected {
+			delete(g.peers, id)
+			continue
+		}
+		peers = append(peers, gp)
+	}
+	return peers
+}
+
+// lookup finds the tracked peer with the given protocol peer id, which is a
+// prefix of its node ID. The caller holds the lock.
+func (g *gossip) lookup(peerID string) *gossipPeer {
+	if peerID == "" || peerID == "local" {
+		return nil
+	}
+	for id, gp := range g.peers {
+		if strings.HasPrefix(id, peerID) {
+			return gp
+		}
+	}
+	return nil
+}
+
+// markKnown records that a peer has the given units.
+func (g *gossip) markKnown(peerID string, hashes ...common.Hash) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if gp := g.lookup(peerID); gp != nil {
+		for _, hash := range hashes {
+			gp.known.add(hash)
+		}
+	}
+}
+
+// received records a unit that arrived in full, ending its fetch.
+func (g *gossip) received(peerID string, hash common.Hash) {
+	g.markKnown(peerID, hash)
+
+	g.lock.Lock()
+	delete(g.fetching, hash)
+	g.lock.Unlock()
+}
+
+// missing returns the peers that do not know a unit and marks it known to
+// them, as it is about to be sent.
+func (g *gossip) missing(hash common.Hash) []*boy.Peer {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	var peers []*boy.Peer
+	for _, gp := range g.live() {
+		if !gp.known.has(hash) {
+			gp.known.add(hash)
+			peers = append(peers, gp.peer)
+		}
+	}
+	return peers
+}
+
+// all returns the connected peers and marks a unit known to them, as it is
+// about to be sent to every peer.
+func (g *gossip) all(hash common.Hash) []*boy.Peer {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	var peers []*boy.Peer
+	for _, gp := range g.live() {
+		gp.known.add(hash)
+		peers = append(peers, gp.peer)
+	}
+	return peers
+}
+
+// relay propagates a unit received from a peer: sqrt(n) of the peers missing it
+// get it in full, the rest get its hash.
+func (g *gossip) relay(unit types.Unit) {
+	data, err := json.Marshal(unit)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	peers := g.missing(unit.Hash)
+	direct := 0
+	if len(data) <= gossipPushSize {
+		direct = int(math.Sqrt(float64(len(peers))))
+		if direct == 0 && len(peers) > 0 {
+			direct = 1
+		}
+	}
+	rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+	for i, p := range peers {
+		var err error
+		if i < direct {
+			err = g.node.wire.sendUnit(p, unit)
+		} else {
+			err = g.node.wire.send(p, &UnitHashesMsg{Hashes: []common.Hash{unit.Hash}})
+		}
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// announced requests the units a peer announced that are neither stored nor
+// already requested from another peer.
+func (g *gossip) announced(peerID string, hashes []common.Hash) {
+	g.markKnown(peerID, hashes...)
+	// Announcing a unit we authored means the peer received it
+	for _, hash := range hashes {
+		g.node.outbox.delivered(hash, []string{peerID})
+	}
+
+	g.lock.Lock()
+	gp := g.lookup(peerID)
+	now := time.Now()
+	var request []common.Hash
+	for _, hash := range hashes {
+		if gp == nil || len(request) >= gossipFetchLimit {
+			break
+		}
+		if requested, ok := g.fetching[hash]; ok && now.Sub(requested) < gossipFetchTimeout {
+			continue
+		}
+		if g.node.dbManager.IsExistUnit(hash) {
+			continue
+		}
+		g.fetching[hash] = now
+		request = append(request, hash)
+	}
+	for hash, requested := range g.fetching {
+		if now.Sub(requested) >= gossipFetchTimeout {
+			delete(g.fetching, hash)
+		}
+	}
+	g.lock.Unlock()
+
+	if len(request) > 0 {
+		if err := g.node.wire.send(gp.peer, &GetUnitsMsg{Hashes: request}); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// serve answers a fetch request of a peer with the requested units found in the
+// DAG.
+func (g *gossip) serve(peerID string, hashes []common.Hash) {
+	g.lock.Lock()
+	gp := g.lookup(peerID)
+	g.lock.Unlock()
+	if gp == nil {
+		return
+	}
+
+	if len(hashes) > gossipFetchLimit {
+		hashes = hashes[:gossipFetchLimit]
+	}
+	for _, hash := range hashes {
+		unit, err := g.node.dbManager.GetUnitByHash(hash)
+		if err != nil {
+			continue
+		}
+		g.markKnown(peerID, hash)
+		if err := g.node.wire.sendUnit(gp.peer, unit); err != nil {
+			log.Println(err)
+		}
+	}
+}
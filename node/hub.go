@@ -0,0 +1,273 @@
+package node
+
+import (
+	"context"
+
+	"babyboy-dag/boydb"
+	"babyboy-dag/common"
+	"babyboy-dag/core"
+	"babyboy-dag/core/types"
+	"babyboy-dag/dag"
+)
+
+// LightProps are the properties a light client needs to compose a unit on top
+// of the DAG of its hub.
+type LightProps struct {
+	ParentList     []common.Hash    `json:"parentList"`
+	BestParentUnit common.Hash      `json:"bestParentUnit"`
+	Level          int64            `json:"level"`
+	WitnessedLevel int64            `json:"witnessedLevel"`
+	LastBallUnit   common.Hash      `json:"lastBallUnit"`
+	LastBall       types.Ball       `json:"lastBall"`
+	WitnessList    []common.Address `json:"witnessList"`
+
+	// WitnessProof is the best parent chain from BestParentUnit down to
+	// LastBallUnit, newest first.
+	WitnessProof types.Units `json:"witnessProof"`
+}
+
+// LightUTXO is an unspent output along with the unit that created it, so that
+// the light client can check the output against the signed unit.
+type LightUTXO struct {
+	UTXO   types.UTXO  `json:"utxo"`
+	Unit   types.Unit  `json:"unit"`
+	Ball   *types.Ball `json:"ball"` // Ball of the unit, nil while it is pending
+	Stable bool        `json:"stable"`
+
+	// BallProof links the last ball the client asked for to Unit: units from
+	// the last ball unit down to a child of Unit, each a parent of the one
+	// before, newest first. Empty if Unit is the last ball unit. ProofBalls
+	// are the balls of these units, in the same order.
+	BallProof  types.Units `json:"ballProof,omitempty"`
+	ProofBalls types.Balls `json:"proofBalls,omitempty"`
+}
+
+// LightBalance lists the unspent outputs of an address.
+type LightBalance struct {
+	Address common.Address `json:"address"`
+	Stable  int64          `json:"stable"`
+	Pending int64          `json:"pending"`
+	UTXOs   []LightUTXO    `json:"utxos"`
+}
+
+// PublicHubAPI serves light clients: it hands out the properties of new units,
+// the unspent outputs of addresses with their proofs, and relays the units the
+// light clients composed and signed themselves.
+type PublicHubAPI struct {
+	node *Node // Node interfaced by this API
+}
+
+// NewPublicHubAPI creates a new API definition for the light client hub.
+func NewPublicHubAPI(node *Node) *PublicHubAPI {
+	return &PublicHubAPI{node: node}
+}
+
+// Hello gives the calling light client a slot at the hub, or renews it. Hubs
+// serve at most MaxLightClients light clients at a time, the other methods
+// require a slot.
+func (api *PublicHubAPI) Hello(ctx context.Context) error {
+	return api.node.lightSessions.hello(ctx)
+}
+
+// Props returns the parents, last ball and witness proof a new unit should use.
+func (api *PublicHubAPI) Props(ctx context.Context) (LightProps, error) {
+	if err := api.node.lightSessions.check(ctx); err != nil {
+		return LightProps{}, err
+	}
+	n := api.node
+	witnessList := n.witnessMemDB.GetWitnessesAsHash()
+	parentList, err := n.parentMemDB.SelectTips(witnessList, n.config.TipPolicy)
+	if err != nil {
+		return LightProps{}, err
+	}
+	gig := dag.NewGraphInfoGetter(n.dbManager, parentList, witnessList)
+	// Units without a compatible parent can't become stable, serve no props
+	bestParent, err := gig.GetBestParentUnit()
+	if err != nil {
+		return LightProps{}, err
+	}
+
+	props := LightProps{
+		ParentList:     parentList,
+		BestParentUnit: bestParent,
+		Level:          gig.GetLevel(),
+		WitnessedLevel: gig.GetWitnessLevel(),
+		LastBallUnit:   gig.GetLastStableBall(),
+		WitnessList:    witnessList,
+		WitnessProof:   gig.GetWitnessProof(),
+	}
+	ball, err := n.dbManager.GetBallByHash(props.LastBallUnit)
+	if err != nil {
+		return LightProps{}, err
+	}
+	props.LastBall = ball
+	return props, nil
+}
+
+// Balance returns the stable and pending unspent outputs of an address. Stable
+// outputs are proven against lastBall, the last ball of the props the client
+// verified; outputs that became stable after it are returned as pending.
+func (api *PublicHubAPI) Balance(ctx context.Context, address common.Address, lastBall common.Hash) (LightBalance, error) {
+	if err := api.node.lightSessions.check(ctx); err != nil {
+		return LightBalance{}, err
+	}
+	n := api.node
+	balance := LightBalance{Address: address, UTXOs: []LightUTXO{}}
+	prover := &ballProver{db: n.dbManager, lastBall: lastBall}
+
+	add := func(utxo types.UTXO, stable bool) {
+		unit, err := n.dbManager.GetUnitByHash(utxo.UnitHash)
+		if err != nil {
+			return
+		}
+		entry := LightUTXO{UTXO: utxo, Unit: unit, Stable: stable}
+		if stable {
+			ball, err := n.dbManager.GetBallByHash(utxo.UnitHash)
+			proof, balls, found := prover.prove(unit)
+			entry.Stable = err == nil && found
+			if entry.Stable {
+				entry.Ball, entry.BallProof, entry.ProofBalls = &ball, proof, balls
+			}
+		}
+		if entry.Stable {
+			balance.Stable += int64(utxo.Output.Amount)
+		} else {
+			balance.Pending += int64(utxo.Output.Amount)
+		}
+		balance.UTXOs = append(balance.UTXOs, entry)
+	}
+	for _, utxo := range n.transaction.FindUnspentTransactionFromStable(address) {
+		add(utxo, true)
+	}
+	for _, utxo := range n.transaction.FindUnspentTransactionFromPendingPool(address) {
+		add(utxo, false)
+	}
+	return balance, nil
+}
+
+// ballProver builds the ball proofs of the outputs of a balance. The proofs
+// follow the main chain from the last ball down to the main chain index of the
+// unit, then the units that became stable at that index, so the hub never
+// searches the DAG below the unit. The main chain is walked once per balance.
+type ballProver struct {
+	db       *boydb.DatabaseManager
+	lastBall common.Hash
+	chain    types.Units // Main chain units from the last ball down, newest first
+	failed   bool        // The main chain could not be walked further
+}
+
+// mainChainUnit returns the index in chain of the main chain unit of mci,
+// walking the main chain down as far as needed.
+func (bp *ballProver) mainChainUnit(mci int64) (int, bool) {
+	if len(bp.chain) == 0 && !bp.failed {
+		start, err := bp.db.GetUnitByHash(bp.lastBall)
+		if err != nil || !start.IsStable || !start.IsOnMainChain {
+			bp.failed = true
+			return 0, false
+		}
+		bp.chain = types.Units{start}
+	}
+	for !bp.failed {
+		last := bp.chain[len(bp.chain)-1]
+		if last.MainChainIndex <= mci {
+			break
+		}
+		next, err := bp.db.GetUnitByHash(last.BestParentUnit)
+		if err != nil || !next.IsOnMainChain {
+			bp.failed = true
+			break
+		}
+		bp.chain = append(bp.chain, next)
+	}
+	for i := len(bp.chain) - 1; i >= 0; i-- {
+		if bp.chain[i].MainChainIndex == mci {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// prove returns the units linking the last ball to unit and their balls, see
+// LightUTXO.
+func (bp *ballProver) prove(unit types.Unit) (types.Units, types.Balls, bool) {
+	if !unit.IsStable {
+		return nil, nil, false
+	}
+	index, ok := bp.mainChainUnit(unit.MainChainIndex)
+	if !ok {
+		return nil, nil, false
+	}
+	// The main chain down to the main chain unit of the index, then its
+	// ancestors that became stable with it
+	proof := append(types.Units{}, bp.chain[:index+1]...)
+	if proof[index].Hash == unit.Hash {
+		proof = proof[:index]
+	} else {
+		path, found := bp.stablePath(proof[index], unit)
+		if !found {
+			return nil, nil, false
+		}
+		proof = append(proof, path...)
+	}
+	balls := make(types.Balls, 0, len(proof))
+	for _, link := range proof {
+		ball, err := bp.db.GetBallByHash(link.Hash)
+		if err != nil {
+			return nil, nil, false
+		}
+		balls = append(balls, ball)
+	}
+	return proof, balls, true
+}
+
+// stablePath searches the units of the main chain index of mcUnit for unit and
+// returns the units linking them below mcUnit, newest first, without unit.
+func (bp *ballProver) stablePath(mcUnit types.Unit, unit types.Unit) (types.Units, bool) {
+	child := map[common.Hash]common.Hash{mcUnit.Hash: {}}
+	units := map[common.Hash]types.Unit{mcUnit.Hash: mcUnit}
+	queue := []types.Unit{mcUnit}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, parent := range current.ParentList {
+			if _, ok := child[parent]; ok {
+				continue
+			}
+			child[parent] = current.Hash
+			if parent == unit.Hash {
+				path := types.Units{}
+				for hash := current.Hash; hash != mcUnit.Hash; hash = child[hash] {
+					path = append(types.Units{units[hash]}, path...)
+				}
+				return path, true
+			}
+			parentUnit, err := bp.db.GetUnitByHash(parent)
+			if err != nil || parentUnit.MainChainIndex != mcUnit.MainChainIndex {
+				continue
+			}
+			units[parent] = parentUnit
+			queue = append(queue, parentUnit)
+		}
+	}
+	return nil, false
+}
+
+// Submit checks the hash, signature and witness list of a unit composed by a
+// light client and hands it to the DAG. The hub keeps broadcasting it until
+// enough peers have it, see outbox_unit.
+func (api *PublicHubAPI) Submit(ctx context.Context, unit types.Unit) (common.Hash, error) {
+	if err := api.node.lightSessions.check(ctx); err != nil {
+		return common.Hash{}, err
+	}
+	if len(unit.Authors) == 0 || unit.Hash != unit.HashKey() {
+		return common.Hash{}, ErrLightUnitHash
+	}
+	if !core.NewSigner().VerifyUnit(unit) {
+		return common.Hash{}, ErrLightUnitSignature
+	}
+	if err := api.node.transaction.ReviewWitnessList(unit); err != nil {
+		return common.Hash{}, err
+	}
+	api.node.SubmitUnit(unit)
+	return unit.Hash, nil
+}
@@ -0,0 +1,474 @@
+package node
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"babyboy-dag/accounts"
+	"babyboy-dag/common"
+	"babyboy-dag/config"
+	"babyboy-dag/core"
+	"babyboy-dag/core/types"
+	"babyboy-dag/p2p"
+	"babyboy-dag/rpc"
+	"babyboy-dag/transaction"
+)
+
+// LightConfig holds the settings of a light node, which keeps no DAG of its own
+// and relies on trusted full nodes (hubs) instead.
+type LightConfig struct {
+	// Hubs are the RPC endpoints of the trusted full nodes, in order of
+	// preference. The light node falls back to the next one when a hub fails.
+	Hubs []string
+
+	// Discover looks up more hubs through discovery v5, by the topic of the
+	// light role. HubPort is the RPC port assumed for the hubs found this way.
+	Discover bool `toml:",omitempty"`
+	HubPort  int  `toml:",omitempty"`
+
+	// Witnesses is the witness list the units of the hubs must use, the one
+	// of the genesis if empty. Networks whose witnesses were replaced by
+	// votes set the current list here.
+	Witnesses []common.Address `toml:",omitempty"`
+}
+
+// lightClient talks to the hub of a light node. Units are composed and signed
+// locally, the hub only supplies the DAG properties and relays the units.
+type lightClient struct {
+	node *Node
+
+	conf      *LightConfig
+	witnesses []common.Address // Witness list the hubs are checked against
+
+	lock   sync.Mutex
+	hubs   []string
+	hub    int         // Index of the hub in use
+	client *rpc.Client // Connection to the hub in use, nil if none
+	hello  time.Time   // Last time the hub in use renewed our slot
+}
+
+func newLightClient(n *Node, conf *LightConfig) *lightClient {
+	witnesses := conf.Witnesses
+	if len(witnesses) == 0 {
+		witnesses = n.genesis.Witnesses
+	}
+	return &lightClient{node: n, conf: conf, witnesses: witnesses, hubs: append([]string{}, conf.Hubs...)}
+}
+
+// connect dials the hubs in order, starting with the one in use, until one of
+// them answers. The caller holds the lock.
+func (lc *lightClient) connect() error {
+	if lc.client != nil {
+		lc.client.Close()
+		lc.client = nil
+	}
+	if len(lc.hubs) == 0 {
+		return ErrLightNoHub
+	}
+	for i := 0; i < len(lc.hubs); i++ {
+		hub := (lc.hub + i) % len(lc.hubs)
+		client, err := rpc.Dial(lc.hubs[hub])
+		if err != nil {
+			log.Println("Light: hub", lc.hubs[hub], "unreachable:", err)
+			continue
+		}
+		// Hubs serve a limited number of light clients
+		if err := client.Call(nil, "hub_hello"); err != nil {
+			log.Println("Light: hub", lc.hubs[hub], "refused:", err)
+			client.Close()
+			continue
+		}
+		lc.hub, lc.client, lc.hello = hub, client, time.Now()
+		return nil
+	}
+	return ErrLightNoHub
+}
+
+// start connects to the first reachable hub. A node without reachable hub
+// still starts, the hub can be switched over RPC later or be discovered.
+func (lc *lightClient) start() error {
+	if lc.conf.Discover {
+		if err := lc.startDiscovery(); err != nil {
+			return err
+		}
+	}
+
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	if err := lc.connect(); err != nil {
+		log.Println("Light: no hub available:", err)
+		return nil
+	}
+	log.Println("Light: using hub", lc.hubs[lc.hub])
+	return nil
+}
+
+// startDiscovery runs a discovery v5 only P2P server, dialing no peers, to
+// look up hubs.
+func (lc *lightClient) startDiscovery() error {
+	p2pConfig := lc.node.config.P2P
+	p2pConfig.PrivateKey = lc.node.config.NodeKey()
+	p2pConfig.NoDiscovery = true
+	p2pConfig.DiscoveryV5 = true
+	p2pConfig.NoDial = true
+	p2pConfig.MaxPeers = 1
+	p2pConfig.Protocols = nil
+	server := &p2p.Server{Config: p2pConfig}
+	if err := server.Start(); err != nil {
+		return err
+	}
+	lc.node.server = server
+
+	port := lc.conf.HubPort
+	if port == 0 {
+		port = DefaultHubPort
+	}
+	go lc.discoverHubs(server.DiscV5, port)
+	return nil
+}
+
+// switchHub makes url the hub in use, adding it to the hub list if needed.
+func (lc *lightClient) switchHub(url string) error {
+	client, err := rpc.Dial(url)
+	if err != nil {
+		return err
+	}
+
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	if lc.client != nil {
+		lc.client.Close()
+	}
+	lc.client, lc.hub, lc.hello = client, -1, time.Time{}
+	for i, hub := range lc.hubs {
+		if hub == url {
+			lc.hub = i
+		}
+	}
+	if lc.hub < 0 {
+		lc.hubs = append([]string{url}, lc.hubs...)
+		lc.hub = 0
+	}
+	return nil
+}
+
+// current returns the hub in use and the configured hubs.
+func (lc *lightClient) current() (string, []string) {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	hubs := append([]string{}, lc.hubs...)
+	if lc.client == nil {
+		return "", hubs
+	}
+	return lc.hubs[lc.hub], hubs
+}
+
+// call invokes a hub method. If the hub cannot be reached or refuses the light
+// client the next one is tried, errors returned by the method are passed on.
+func (lc *lightClient) call(result interface{}, method string, args ...interface{}) error {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	if lc.client == nil {
+		if err := lc.connect(); err != nil {
+			return err
+		}
+	}
+	// A hub that no longer has a slot for us is left like a failed one
+	err := lc.renew()
+	if err == nil {
+		err = lc.client.Call(result, method, args...)
+		if _, ok := err.(rpc.Error); err == nil || ok {
+			return err
+		}
+	}
+	log.Println("Light: hub", lc.hubs[lc.hub], "failed:", err)
+	lc.hub = (lc.hub + 1) % len(lc.hubs)
+	if err := lc.connect(); err != nil {
+		return err
+	}
+	return lc.client.Call(result, method, args...)
+}
+
+// renew keeps the slot of the light client at the hub in use. The caller holds
+// the lock.
+func (lc *lightClient) renew() error {
+	if time.Since(lc.hello) < lightHelloInterval {
+		return nil
+	}
+	if err := lc.client.Call(nil, "hub_hello"); err != nil {
+		return err
+	}
+	lc.hello = time.Now()
+	return nil
+}
+
+// props fetches the properties of a new unit and checks the witness proof.
+func (lc *lightClient) props() (LightProps, error) {
+	var props LightProps
+	if err := lc.call(&props, "hub_props"); err != nil {
+		return LightProps{}, err
+	}
+	if err := lc.verifyProps(props); err != nil {
+		return LightProps{}, err
+	}
+	return props, nil
+}
+
+// verifyProps checks that the hub uses our witness list and that the last ball
+// is confirmed by the witness proof: the proof must link the best parent to the
+// last ball unit through signed units, posted by a majority of the witnesses
+// unless it reaches the genesis.
+func (lc *lightClient) verifyProps(props LightProps) error {
+	if !sameWitnesses(props.WitnessList, lc.witnesses) {
+		return ErrLightWitnessList
+	}
+	proof := props.WitnessProof
+	if len(proof) == 0 || proof[0].Hash != props.BestParentUnit {
+		return ErrLightWitnessProof
+	}
+	isParent := false
+	for _, parent := range props.ParentList {
+		isParent = isParent || parent == props.BestParentUnit
+	}
+	if !isParent {
+		return ErrLightWitnessProof
+	}
+
+	witnesses := make(map[common.Address]bool)
+	for _, witness := range lc.witnesses {
+		witnesses[witness] = true
+	}
+	signer := core.NewSigner()
+	authors := make(map[common.Address]bool)
+	for i, unit := range proof {
+		if unit.Hash != unit.HashKey() {
+			return ErrLightUnitHash
+		}
+		if i > 0 && proof[i-1].BestParentUnit != unit.Hash {
+			return ErrLightWitnessProof
+		}
+		if len(unit.ParentList) == 0 {
+			// The genesis needs no witnesses, but it must be ours
+			if unit.Hash != lc.node.genesisHash || i != len(proof)-1 {
+				return ErrLightWitnessProof
+			}
+			continue
+		}
+		if len(unit.Authors) == 0 || !signer.VerifyUnit(signedForm(unit)) {
+			return ErrLightUnitSignature
+		}
+		if i < len(proof)-1 && witnesses[unit.Authors[0].Address] {
+			authors[unit.Authors[0].Address] = true
+		}
+	}
+
+	last := proof[len(proof)-1]
+	if last.Hash != props.LastBallUnit || props.LastBall.UnitHash != props.LastBallUnit {
+		return ErrLightWitnessProof
+	}
+	if last.Hash != lc.node.genesisHash && len(authors) < config.MajorityOfWitnesses {
+		return ErrLightWitnessProof
+	}
+	return nil
+}
+
+// sameWitnesses tells whether two witness lists hold the same witnesses.
+func sameWitnesses(list, other []common.Address) bool {
+	if len(list) != len(other) {
+		return false
+	}
+	witnesses := make(map[common.Address]bool)
+	for _, witness := range other {
+		witnesses[witness] = true
+	}
+	for _, witness := range list {
+		if !witnesses[witness] {
+			return false
+		}
+	}
+	return true
+}
+
+// balance fetches the unspent outputs of an address and drops the ones that do
+// not match the unit they claim to come from. Stable outputs are proven against
+// the last ball of verified props.
+func (lc *lightClient) balance(address common.Address) (LightBalance, error) {
+	props, err := lc.props()
+	if err != nil {
+		return LightBalance{}, err
+	}
+	var balance LightBalance
+	if err := lc.call(&balance, "hub_balance", address, props.LastBallUnit); err != nil {
+		return LightBalance{}, err
+	}
+	verified := LightBalance{Address: address, UTXOs: []LightUTXO{}}
+	for _, utxo := range balance.UTXOs {
+		if err := verifyLightUTXO(address, utxo, props.LastBallUnit); err != nil {
+			log.Println("Light: dropping output of unit", utxo.UTXO.UnitHash.String(), err)
+			continue
+		}
+		if utxo.Stable {
+			verified.Stable += int64(utxo.UTXO.Output.Amount)
+		} else {
+			verified.Pending += int64(utxo.UTXO.Output.Amount)
+		}
+		verified.UTXOs = append(verified.UTXOs, utxo)
+	}
+	return verified, nil
+}
+
+// verifyLightUTXO checks that an unspent output is paid to address by a signed
+// unit, and that stable outputs come with the ball of their unit and a proof
+// that the unit is an ancestor of lastBall, so stable as well.
+func verifyLightUTXO(address common.Address, utxo LightUTXO, lastBall common.Hash) error {
+	unit := utxo.Unit
+	if unit.Hash != utxo.UTXO.UnitHash || unit.Hash != unit.HashKey() {
+		return ErrLightUnitHash
+	}
+	if len(unit.Authors) == 0 || !core.NewSigner().VerifyUnit(signedForm(unit)) {
+		return ErrLightUnitSignature
+	}
+	if utxo.UTXO.MessageIndex < 0 || utxo.UTXO.MessageIndex >= len(unit.Messages) {
+		return ErrLightUTXOProof
+	}
+	outputs := unit.Messages[utxo.UTXO.MessageIndex].Payload.Outputs
+	if utxo.UTXO.OutputIndex < 0 || utxo.UTXO.OutputIndex >= len(outputs) {
+		return ErrLightUTXOProof
+	}
+	output := outputs[utxo.UTXO.OutputIndex]
+	if output != utxo.UTXO.Output || output.Address != address {
+		return ErrLightUTXOProof
+	}
+	if utxo.Stable {
+		return verifyLightBall(unit, utxo.Ball, utxo.BallProof, utxo.ProofBalls, lastBall)
+	}
+	return nil
+}
+
+// verifyLightBall checks that the proof links lastBall to unit through the
+// parents of hashed units, and that ball is the valid ball of unit: the hash
+// of every ball, recomputed from its unit and parent balls, must be the parent
+// ball its child lists for it.
+func verifyLightBall(unit types.Unit, ball *types.Ball, proof types.Units, proofBalls types.Balls, lastBall common.Hash) error {
+	if ball == nil || ball.IsInvalid || len(proofBalls) != len(proof) {
+		return ErrLightBallProof
+	}
+	chain := append(append(types.Units{}, proof...), unit)
+	balls := append(append(types.Balls{}, proofBalls...), *ball)
+	if chain[0].Hash != lastBall {
+		return ErrLightBallProof
+	}
+	for i := range chain {
+		if balls[i].UnitHash != chain[i].Hash || len(balls[i].ParentBalls) != len(chain[i].ParentList) {
+			return ErrLightBallProof
+		}
+		if i == 0 {
+			continue
+		}
+		if chain[i-1].Hash != chain[i-1].HashKey() {
+			return ErrLightUnitHash
+		}
+		linked := false
+		for j, parent := range chain[i-1].ParentList {
+			linked = linked || (parent == chain[i].Hash && balls[i-1].ParentBalls[j] == balls[i].BallHash())
+		}
+		if !linked {
+			return ErrLightBallProof
+		}
+	}
+	return nil
+}
+
+// send composes a payment on top of the hub's DAG, signs it with the local
+// keystore and submits it through the hub.
+func (lc *lightClient) send(from common.Address, passphrase string, to common.Address, amount int) (common.Hash, error) {
+	balance, err := lc.balance(from)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	props, err := lc.props()
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	unit := types.NewEmptyUnit()
+	unit.ParentList = props.ParentList
+	unit.WitnessList = props.WitnessList
+	unit.BestParentUnit = props.BestParentUnit
+	unit.Level = props.Level
+	unit.WitnessedLevel = props.WitnessedLevel
+	unit.LastBallUnit = props.LastBallUnit
+	unit.Authors = types.Authors{}
+	unit.SubStableMinHash = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+
+	unspent := make([]types.UTXO, len(balance.UTXOs))
+	for i, utxo := range balance.UTXOs {
+		unspent[i] = utxo.UTXO
+	}
+	unit, err = transaction.ComposePayment(unit, from, unspent, to, amount)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	unit, err = lc.node.SignUnitWithPassphrase(unit, accounts.Account{Address: from}, passphrase)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	var hash common.Hash
+	if err := lc.call(&hash, "hub_submit", unit); err != nil {
+		return common.Hash{}, err
+	}
+	return hash, nil
+}
+
+// signedForm undoes the changes the DAG makes to a stored unit, leaving the
+// unit as its author signed it.
+func signedForm(unit types.Unit) types.Unit {
+	unit.ResetStableState()
+	unit.SubStableMinHash = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	unit.SubStableAuthor = common.Address{}
+	return unit
+}
+
+// PublicLightAPI provides the wallet methods of a light node.
+type PublicLightAPI struct {
+	node *Node // Node interfaced by this API
+}
+
+// NewPublicLightAPI creates a new API definition for the light node methods.
+func NewPublicLightAPI(node *Node) *PublicLightAPI {
+	return &PublicLightAPI{node: node}
+}
+
+// Hub returns the hub in use, empty if none is reachable.
+func (api *PublicLightAPI) Hub() string {
+	hub, _ := api.node.light.current()
+	return hub
+}
+
+// Hubs returns the configured hubs in order of preference.
+func (api *PublicLightAPI) Hubs() []string {
+	_, hubs := api.node.light.current()
+	return hubs
+}
+
+// SwitchHub connects to another hub and uses it from now on.
+func (api *PublicLightAPI) SwitchHub(url string) error {
+	return api.node.light.switchHub(url)
+}
+
+// Balance returns the verified unspent outputs of an address.
+func (api *PublicLightAPI) Balance(address common.Address) (LightBalance, error) {
+	return api.node.light.balance(address)
+}
+
+// Send pays amount from an account of the local keystore to another address
+// and returns the hash of the unit.
+func (api *PublicLightAPI) Send(from common.Address, passphrase string, to common.Address, amount int) (common.Hash, error) {
+	return api.node.light.send(from, passphrase, to, amount)
+}
@@ -0,0 +1,231 @@
+package node
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"babyboy-dag/dag"
+	"babyboy-dag/p2p"
+)
+
+// dagMetrics counts the units added to the DAG and times the handling of the
+// DAG messages, the rest of the DAG metrics is read from the DAG when scraped.
+type dagMetrics struct {
+	units uint64 // Units handled by the DAG, accessed atomically
+
+	lock     sync.Mutex
+	handling map[string]*p2p.MsgLatency // Handling time by DAG message
+}
+
+func newDagMetrics() *dagMetrics {
+	return &dagMetrics{handling: make(map[string]*p2p.MsgLatency)}
+}
+
+func (m *dagMetrics) unitDone() {
+	atomic.AddUint64(&m.units, 1)
+}
+
+// handled records how long handling a DAG message took.
+func (m *dagMetrics) handled(msg string, elapsed time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	hist, ok := m.handling[msg]
+	if !ok {
+		hist = &p2p.MsgLatency{Buckets: make([]uint64, len(p2p.LatencyBuckets))}
+		m.handling[msg] = hist
+	}
+	seconds := elapsed.Seconds()
+	for i, bound := range p2p.LatencyBuckets {
+		if seconds <= bound {
+			hist.Buckets[i]++
+		}
+	}
+	hist.Count++
+	hist.Sum += seconds
+}
+
+// startMetrics serves the metrics in the Prometheus text format at /metrics
+// on MetricsAddr.
+func (n *Node) startMetrics() error {
+	if n.config.MetricsAddr == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", n.config.MetricsAddr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", n.serveMetrics)
+	go http.Serve(listener, mux)
+	log.Println("Metrics served on", "http://"+listener.Addr().String()+"/metrics")
+	return nil
+}
+
+func (n *Node) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+
+	n.writeDagMetrics(out)
+	n.metrics.writeHandling(out)
+	if server := n.Server(); server != nil {
+		writeMsgMetrics(out, server.MsgStats())
+		writeMetric(out, "babyboy_p2p_peers", "gauge", "Connected peers.", nil, float64(server.PeerCount()))
+	}
+}
+
+// writeHandling writes the handling time histograms of the DAG messages.
+func (m *dagMetrics) writeHandling(out *bufio.Writer) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	msgs := make([]string, 0, len(m.handling))
+	for msg := range m.handling {
+		msgs = append(msgs, msg)
+	}
+	sort.Strings(msgs)
+	writeHeader(out, "babyboy_dag_message_handling_seconds", "histogram", "Time the DAG took to handle the DAG messages of the peers.")
+	for _, msg := range msgs {
+		writeHistogram(out, "babyboy_dag_message_handling_seconds", []string{"message", msg}, *m.handling[msg])
+	}
+}
+
+// writeDagMetrics writes the unit count, the tip count and how far the last
+// stable unit lags behind the tips.
+func (n *Node) writeDagMetrics(out *bufio.Writer) {
+	writeMetric(out, "babyboy_dag_units_total", "counter", "Units added to the DAG since the start.", nil, float64(atomic.LoadUint64(&n.metrics.units)))
+	if n.light != nil {
+		return
+	}
+	tips := n.parentMemDB.GetDagAllTips()
+	writeMetric(out, "babyboy_dag_tips", "gauge", "Tips of the DAG.", nil, float64(len(tips)))
+
+	graphInfo := dag.NewGraphInfoGetter(n.dbManager, tips, n.witnessMemDB.GetWitnessesAsHash())
+	stable, err := n.dbManager.GetUnitByHash(graphInfo.GetLastStableBall())
+	if err != nil {
+		return
+	}
+	writeMetric(out, "babyboy_dag_last_stable_mci", "gauge", "Main chain index of the last stable ball.", nil, float64(graphInfo.GetLastStableBallMCI()))
+	writeMetric(out, "babyboy_dag_stabilization_lag", "gauge", "Levels between the highest tip and the last stable ball.", nil, float64(graphInfo.GetLevel()-1-stable.Level))
+}
+
+// writeMsgMetrics writes the message counters per protocol message code, in
+// total and per peer, and the message latency histograms.
+func writeMsgMetrics(out *bufio.Writer, stats p2p.MsgStatsSnapshot) {
+	keys := make([]p2p.MsgKey, 0, len(stats.Totals))
+	for key := range stats.Totals {
+		keys = append(keys, key)
+	}
+	sortMsgKeys(keys)
+
+	writeHeader(out, "babyboy_p2p_messages_total", "counter", "Messages by protocol, message code and direction.")
+	for _, key := range keys {
+		writeSample(out, "babyboy_p2p_messages_total", msgLabels(key), float64(stats.Totals[key].Packets))
+	}
+	writeHeader(out, "babyboy_p2p_message_bytes_total", "counter", "Message payload bytes by protocol, message code and direction.")
+	for _, key := range keys {
+		writeSample(out, "babyboy_p2p_message_bytes_total", msgLabels(key), float64(stats.Totals[key].Bytes))
+	}
+
+	peers := make([]string, 0, len(stats.Peers))
+	byPeer := make(map[string]map[p2p.MsgKey]p2p.MsgCounter, len(stats.Peers))
+	for id, counters := range stats.Peers {
+		peer := id.String()[:16]
+		peers = append(peers, peer)
+		byPeer[peer] = counters
+	}
+	sort.Strings(peers)
+	writeHeader(out, "babyboy_p2p_peer_messages_total", "counter", "Messages of the connected peers by protocol, message code and direction.")
+	for _, peer := range peers {
+		for _, key := range sortedKeys(byPeer[peer]) {
+			writeSample(out, "babyboy_p2p_peer_messages_total", append(msgLabels(key), "peer", peer), float64(byPeer[peer][key].Packets))
+		}
+	}
+	writeHeader(out, "babyboy_p2p_peer_message_bytes_total", "counter", "Message payload bytes of the connected peers by protocol, message code and direction.")
+	for _, peer := range peers {
+		for _, key := range sortedKeys(byPeer[peer]) {
+			writeSample(out, "babyboy_p2p_peer_message_bytes_total", append(msgLabels(key), "peer", peer), float64(byPeer[peer][key].Bytes))
+		}
+	}
+
+	writeHeader(out, "babyboy_p2p_message_latency_seconds", "histogram", "Time received messages waited to be read, and messages took to be written.")
+	for _, key := range keys {
+		if hist, ok := stats.Latency[key]; ok {
+			writeHistogram(out, "babyboy_p2p_message_latency_seconds", msgLabels(key), hist)
+		}
+	}
+}
+
+// writeHistogram writes the buckets, sum and count of a latency histogram.
+func writeHistogram(out *bufio.Writer, name string, labels []string, hist p2p.MsgLatency) {
+	for i, bound := range p2p.LatencyBuckets {
+		writeSample(out, name+"_bucket", append(labels, "le", strconv.FormatFloat(bound, 'g', -1, 64)), float64(hist.Buckets[i]))
+	}
+	writeSample(out, name+"_bucket", append(labels, "le", "+Inf"), float64(hist.Count))
+	writeSample(out, name+"_sum", labels, hist.Sum)
+	writeSample(out, name+"_count", labels, float64(hist.Count))
+}
+
+func msgLabels(key p2p.MsgKey) []string {
+	direction := "out"
+	if key.Ingress {
+		direction = "in"
+	}
+	return []string{"protocol", key.Protocol, "code", strconv.FormatUint(key.Code, 10), "direction", direction}
+}
+
+func sortedKeys(counters map[p2p.MsgKey]p2p.MsgCounter) []p2p.MsgKey {
+	keys := make([]p2p.MsgKey, 0, len(counters))
+	for key := range counters {
+		keys = append(keys, key)
+	}
+	sortMsgKeys(keys)
+	return keys
+}
+
+func sortMsgKeys(keys []p2p.MsgKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Protocol != keys[j].Protocol {
+			return keys[i].Protocol < keys[j].Protocol
+		}
+		if keys[i].Code != keys[j].Code {
+			return keys[i].Code < keys[j].Code
+		}
+		return keys[i].Ingress && !keys[j].Ingress
+	})
+}
+
+func writeMetric(out *bufio.Writer, name, kind, help string, labels []string, value float64) {
+	writeHeader(out, name, kind, help)
+	writeSample(out, name, labels, value)
+}
+
+func writeHeader(out *bufio.Writer, name, kind, help string) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeSample writes a sample, labels holds the label names and values in
+// turn.
+func writeSample(out *bufio.Writer, name string, labels []string, value float64) {
+	out.WriteString(name)
+	if len(labels) > 0 {
+		out.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			fmt.Fprintf(out, "%s=%q", labels[i], labels[i+1])
+		}
+		out.WriteByte('}')
+	}
+	fmt.Fprintf(out, " %s\n", strconv.FormatFloat(value, 'g', -1, 64))
+}
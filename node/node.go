@@ -3,9 +3,11 @@ package node
 import (
 	"fmt"
 	"log"
+	"net"
 	"path/filepath"
 	"reflect"
 	"sync"
+	"time"
 
 	"babyboy-dag/accounts"
 	"babyboy-dag/accounts/keystore"
@@ -15,6 +17,7 @@ import (
 	"babyboy-dag/common/hexutil"
 	"babyboy-dag/common/queue"
 	"babyboy-dag/config"
+	"babyboy-dag/core"
 	"babyboy-dag/core/types"
 	"babyboy-dag/crypto"
 	"babyboy-dag/dag"
@@ -23,10 +26,10 @@ import (
 	"babyboy-dag/eventbus"
 	"babyboy-dag/p2p"
 	"babyboy-dag/p2p/discover"
+	"babyboy-dag/p2p/nat"
 	"babyboy-dag/rpc"
 	"babyboy-dag/transaction"
 	"encoding/json"
-	"path"
 	"sort"
 	"strconv"
 	"strings"
@@ -51,16 +54,36 @@ type Node struct {
 	serviceFuncs      []ServiceConstructor     // Service constructors (in dependency order)
 	services          map[reflect.Type]Service // Currently running services
 	rpcAPIs           []rpc.API                // List of APIs currently provided by the node
+	ipcEndpoint       string                   // IPC endpoint to listen at (empty = IPC disabled)
+	ipcListener       net.Listener             // IPC RPC listener socket to serve API requests
+	ipcHandler        *rpc.Server              // IPC RPC request handler to process the API requests
 	lock              sync.RWMutex
 	transaction       *transaction.Transaction
 	protocolManager   *boy.ProtocolManager
 	dbManager         *boydb.DatabaseManager
-	server            *p2p.Server // Currently running P2P networking layer
+	parentMemDB       *memdb.ParentMemDB  // Tips of the DAG, backed by dbManager
+	witnessMemDB      *memdb.WitnessMemDB // Witness list and vote state, backed by dbManager
+	server            *p2p.Server         // Currently running P2P networking layer
 	state             State
 	recvQueue         *queue.Queue // 同步时接收数据队列
 	waitQueue         *queue.Queue // 同步时收到其他p2p广播的数据时缓存队列
 	syncCount         int
 	chain             map[common.Hash]*types.DagBlock
+	genesis           *core.Genesis  // Genesis of the network the node is part of
+	genesisHash       common.Hash    // Hash of the genesis unit, resolved at startup
+	dev               *devWitness    // Witness driver of the developer network (nil unless --dev)
+	outbox            *outbox        // Locally authored units not yet received by enough peers
+	light             *lightClient   // Hub connection of a light node (nil unless --light)
+	listLock          sync.Mutex     // Serializes edits of the static, trusted and banned node files
+	scores            *peerScores    // Reputation of the peers
+	gossip            *gossip        // Units known to every peer, for relaying
+	wire              *wireProtocol  // DAG messages run inside the boy protocol
+	lightSessions     *lightSessions // Light clients served by the hub API
+	eventBus          eventbus.Bus   // Sync events of this node, published by its protocol manager
+	stableStates      *stableStates  // States of the last stable MCIs (nil unless --dev)
+	metrics           *dagMetrics    // DAG counters exported at /metrics
+	attachOnce        sync.Once      // Loads the DAG the first time the node is attached to a server
+	lifecycles        []Lifecycle    // Services started with the node, stopped by Stop
 }
 
 // New creates a new P2P node, ready for protocol registration.
@@ -83,17 +106,50 @@ func New(conf *Config) (*Node, error) {
 	if err != nil {
 		return nil, err
 	}
+	genesis := conf.Genesis
+	if genesis == nil {
+		genesis = core.DefaultGenesis()
+	}
 	// Note: any interaction with Config that would create/touch files
 	// in the data directory or instance directory is delayed until Start.
-	return &Node{
+	// Every node owns its database and in-memory views, so that several
+	// nodes can run in the same process.
+	db := boydb.NewDatabaseManager()
+	pdb := memdb.NewParentMemDB(db)
+	wdb := memdb.NewWitnessMemDB(db)
+	node := &Node{
+		genesis:           genesis,
+		genesisHash:       genesis.ToUnit().Hash,
 		accmgr:            am,
 		ephemeralKeystore: ephemeralKeystore,
 		config:            conf,
+		ipcEndpoint:       conf.IPCEndpoint(),
 		serviceFuncs:      []ServiceConstructor{},
-		transaction:       transaction.NewTransaction(),
+		dbManager:         db,
+		parentMemDB:       pdb,
+		witnessMemDB:      wdb,
+		transaction:       transaction.NewTransaction(db, pdb, wdb),
 		recvQueue:         queue.New(),
 		waitQueue:         queue.New(),
-	}, nil
+		eventBus:          eventbus.New(),
+	}
+	node.transaction.SetTipPolicy(conf.TipPolicy)
+	node.transaction.SetGenesisHash(node.genesisHash)
+	node.outbox = newOutbox(node, conf.UnitAckPeers)
+	node.scores = newPeerScores(node)
+	node.gossip = newGossip(node)
+	node.wire = newWireProtocol(node)
+	node.lightSessions = newLightSessions(conf.MaxLightClients)
+	node.metrics = newDagMetrics()
+	if conf.Dev != nil {
+		node.dev = newDevWitness(node, conf.Dev)
+		node.stableStates = newStableStates()
+		node.transaction.SetStableHook(node.recordStableState)
+	}
+	if conf.Light != nil {
+		node.light = newLightClient(node, conf.Light)
+	}
+	return node, nil
 }
 
 // Register injects a new service into the node's stack. The service created by
@@ -112,7 +168,20 @@ func (n *Node) Start() error {
 	n.lock.Lock()
 	defer n.lock.Unlock()
 
-	n.initDatabase()
+	if err := n.initDatabase(); err != nil {
+		return err
+	}
+
+	// Light nodes keep no DAG, they only serve the wallet through their hub
+	if n.light != nil {
+		if err := n.light.start(); err != nil {
+			return err
+		}
+		return n.startServices()
+	}
+
+	// The node record and the status handshake report the DAG, load it first
+	n.initGenesis()
 
 	protocol, err := n.initP2p()
 	if err != nil {
@@ -120,6 +189,23 @@ func (n *Node) Start() error {
 	}
 	n.protocolManager = protocol
 
+	n.initEventBus()
+	n.outbox.start()
+
+	if n.dev != nil {
+		n.dev.importAccounts(n.config.Dev)
+		go n.dev.loop()
+	}
+
+	//G, _ := n.dbManager.GetUnitByHash(common.HexToHash(config.GENISIS_UNIT_HASH))
+	//n.InitDag(G)
+
+	return n.startServices()
+}
+
+// startServices creates the registered services, serves their APIs along with
+// the node's own and starts them.
+func (n *Node) startServices() error {
 	services, err := n.initServices()
 	if err != nil {
 		return err
@@ -128,13 +214,18 @@ func (n *Node) Start() error {
 	if err := n.startRPC(services); err != nil {
 		return err
 	}
+	if err := n.startMetrics(); err != nil {
+		return err
+	}
 
-	n.initEventBus()
-	n.initGenesis()
-
-	//G, _ := n.dbManager.GetUnitByHash(common.HexToHash(config.GENISIS_UNIT_HASH))
-	//n.InitDag(G)
-
+	for _, service := range services {
+		if lifecycle, ok := service.(Lifecycle); ok {
+			if err := lifecycle.Start(); err != nil {
+				return err
+			}
+			n.lifecycles = append(n.lifecycles, lifecycle)
+		}
+	}
 	return nil
 }
 
@@ -148,6 +239,9 @@ func (n *Node) initServices() (map[reflect.Type]Service, error) {
 			Services:       make(map[reflect.Type]Service),
 			EventMux:       n.eventmux,
 			AccountManager: n.accmgr,
+			Database:       n.dbManager,
+			ParentMemDB:    n.parentMemDB,
+			WitnessMemDB:   n.witnessMemDB,
 			Node:           n,
 		}
 		for kind, s := range services { // copy needed for threaded access
@@ -175,27 +269,25 @@ func (n *Node) initEventBus() {
 		for p2pevent := range p2pevents {
 			switch p2pevent.Kind {
 			case boy.NewUnitReceived:
-				entity := p2pevent.Data.(types.NewUnitEntity)
-				n.handleNewUnitEvent(entity)
+				n.unitReceived(p2pevent.Data.(types.NewUnitEntity))
 			case boy.NewNodeConnect:
 				//log.Println("新节点连接, 将Cache发送过去")
 				p := p2pevent.Data.(*boy.Peer)
+				n.gossip.register(p)
 				// TODO 暂时先强制只要有连接就同步一次不稳定点
-				pdb := memdb.GetParentMemDBInstance()
-				wdb := memdb.GetWitnessMemDBInstance()
-				graphInfo := dag.NewGraphInfoGetter(n.dbManager, pdb.GetDagAllTips(), wdb.GetWitnessesAsHash())
+				graphInfo := dag.NewGraphInfoGetter(n.dbManager, n.parentMemDB.GetDagAllTips(), n.witnessMemDB.GetWitnessesAsHash())
 				mci := graphInfo.GetLastStableBallMCI()
 				units, uUnits := graphInfo.GetMissingUnits(mci, mci)
 				units = append(units, uUnits...)
 				sort.Sort(units)
 				for _, unit := range units {
-					bUnit, _ := json.Marshal(unit)
-					if unit.Hash.String() == config.GENISIS_UNIT_HASH {
+					if unit.Hash == n.genesisHash {
 						continue
 					}
-					entity := &types.BroadUnitEntity{HasPeers: n.protocolManager.GetPeers().GetPeersIds(), Message: string(bUnit)}
-					n.protocolManager.SendMsgToPeer(p, boy.MSG_NewUnit, entity)
+					n.gossip.markKnown(p.ID().String(), unit.Hash)
+					n.wire.sendUnit(p, unit)
 				}
+				n.outbox.flush()
 			case boy.SyncDataRequst:
 				entity := p2pevent.Data.(boy.SyncDataRequestEntity)
 				go n.pickDataFromDag(entity.ReqPeer, entity.MCI)
@@ -211,18 +303,30 @@ func (n *Node) initEventBus() {
 			switch txevent.Kind {
 			case transaction.NewUnitHandleDone:
 				n.handleUnitDoneEvent(txevent.NewUnitEntity)
+			case transaction.UnitRejected:
+				if txevent.NewUnitEntity.FromPeerId == "local" {
+					n.outbox.rejected(txevent.NewUnitEntity.NewUnit.Hash, txevent.Err)
+					continue
+				}
+				n.scores.unitRejected(txevent.NewUnitEntity.FromPeerId, txevent.Err)
 			}
 		}
 	}()
 
-	eventbus.GetEventBus().Subscribe("node:SyncUnit", func() {
+	n.eventBus.Subscribe("node:SyncUnit", func() {
 		if n.state == Running {
+			peer := n.protocolManager.GetBestPeer()
+			// Without peers the sync stays required for the next round
+			if peer == nil {
+				return
+			}
 			n.protocolManager.SetIsRequireSync(false)
-			go n.protocolManager.Synchronise(n.protocolManager.GetBestPeer())
+			n.scores.syncRequested(peer)
+			go n.protocolManager.Synchronise(peer)
 		}
 	})
 
-	eventbus.GetEventBus().Subscribe("node:SyncDataReq", func(p *boy.Peer, endMci string) {
+	n.eventBus.Subscribe("node:SyncDataReq", func(p *boy.Peer, endMci string) {
 		log.Println("EventBus: ", "node:SyncDataReq")
 		if n.state == SynchronizingReponse {
 			log.Println("Syncing...")
@@ -235,8 +339,12 @@ func (n *Node) initEventBus() {
 		go n.pickDataFromDag(p, endMci)
 	})
 
-	eventbus.GetEventBus().Subscribe("node:SyncDataRep", func(p *boy.Peer, syncData types.SyncDataEntity) {
+	n.eventBus.Subscribe("node:SyncDataRep", func(p *boy.Peer, syncData types.SyncDataEntity) {
 		//log.Println("EventBus: ", "node:SyncDataRep")
+		// 丢弃未请求的同步数据
+		if !n.scores.syncAnswered(p, syncData.State != 0) {
+			return
+		}
 		if syncData.State == 2 {
 			log.Println("Request Busy...")
 			n.state = Running
@@ -247,7 +355,7 @@ func (n *Node) initEventBus() {
 		n.state = SynchronizingRecving
 		// 处理稳定单元
 		for _, unit := range syncData.StableUnits {
-			_, err := boydb.GetDbInstance().GetUnitByHash(unit.Hash)
+			_, err := n.dbManager.GetUnitByHash(unit.Hash)
 			if err == nil {
 				log.Println("Unit has exsit")
 				continue
@@ -255,7 +363,7 @@ func (n *Node) initEventBus() {
 
 			n.showProgress(int64(unit.Level), p.GetMaxLevel())
 
-			entity := types.NewUnitEntity{FromPeerId: "", HasPeerIds: []string{}, NewUnit: unit}
+			entity := types.NewUnitEntity{FromPeerId: p.ID().String(), NewUnit: unit}
 			n.recvQueue.Push(entity)
 		}
 
@@ -264,28 +372,28 @@ func (n *Node) initEventBus() {
 			go n.fetchData()
 		}
 	})
+}
 
-	eventbus.GetEventBus().Subscribe("node:LightNewUnit", func(entity types.LightNewUnitEntity, callback func(unit types.Unit, err error)) {
-		unit, err := n.CreateUnitForLight(entity.FromAddress, entity.ToAddress, entity.Amount)
-		callback(unit, err)
-	})
+// unitReceived handles a unit sent by a peer, through boy or as UnitMsg.
+func (n *Node) unitReceived(entity types.NewUnitEntity) {
+	// A peer relaying one of our units has received it
+	n.outbox.delivered(entity.NewUnit.Hash, []string{entity.FromPeerId})
+	n.gossip.received(entity.FromPeerId, entity.NewUnit.Hash)
+	n.handleNewUnitEvent(entity)
 }
 
 func (n *Node) handleNewUnitEvent(entity types.NewUnitEntity) {
 	//log.Println("New Unit Message: ", entity.NewUnit.Level)
 
+	if entity.FromPeerId == "local" {
+		// Keep the unit until enough peers have it, across restarts, also while
+		// it waits for the sync to finish
+		n.outbox.add(entity.NewUnit)
+	}
 	if n.state == SynchronizingRecving {
 		n.waitQueue.Push(entity)
 		return
 	}
-
-	if n.protocolManager.GetPeers().Len() == 0 {
-		//log.Println("当前未连接任何节点, 先将消息缓存在数据库中")
-		n.dbManager.SaveCacheUnitToDb(entity.NewUnit)
-
-		units := n.dbManager.GetCacheUnitFromDb()
-		log.Println(len(units))
-	}
 	n.transaction.RecvUnit(entity)
 }
 
@@ -296,31 +404,37 @@ func (n *Node) handleUnitDoneEvent(entity types.NewUnitEntity) {
 	//tips := n.FindTips(n.chain)
 	//log.Println("顶点个数: ", len(tips))
 	//n.countBlue(n.chain, entity.NewUnit)
+	n.metrics.unitDone()
 
-	unitByte, err := json.Marshal(entity.NewUnit)
-	if err != nil {
-		log.Println(err)
+	if entity.FromPeerId == "local" {
+		// Delivered once peers acknowledge, relay or announce the unit
+		n.outbox.accepted(entity.NewUnit.Hash)
+		if n.broadcastUnit(entity.NewUnit) > 0 {
+			n.outbox.sent(entity.NewUnit.Hash)
+		}
 		return
 	}
+	n.wire.ack(entity.FromPeerId, entity.NewUnit.Hash)
+	n.gossip.relay(entity.NewUnit)
+}
 
-	joint := &types.BroadUnitEntity{HasPeers: n.protocolManager.GetPeers().GetPeersIds(), Message: string(unitByte)}
-	jointByte, err := json.Marshal(joint)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	if entity.FromPeerId == "local" {
-		n.protocolManager.SendMsgToPeers(boy.MSG_NewUnit, string(jointByte))
-	} else {
-		n.protocolManager.BroadMsgExcludePeer(entity.HasPeerIds, boy.MSG_NewUnit, string(jointByte))
+// broadcastUnit sends a unit to all connected peers and returns the number of
+// peers it was sent to.
+func (n *Node) broadcastUnit(unit types.Unit) int {
+	sent := 0
+	for _, p := range n.gossip.all(unit.Hash) {
+		if err := n.wire.sendUnit(p, unit); err != nil {
+			log.Println(err)
+			continue
+		}
+		sent++
 	}
+	return sent
 }
 
 func (n *Node) pickDataFromDag(p *boy.Peer, endmci string) {
 
-	pdb := memdb.GetParentMemDBInstance()
-	wdb := memdb.GetWitnessMemDBInstance()
-	graphInfo := dag.NewGraphInfoGetter(n.dbManager, pdb.GetDagAllTips(), wdb.GetWitnessesAsHash())
+	graphInfo := dag.NewGraphInfoGetter(n.dbManager, n.parentMemDB.GetDagAllTips(), n.witnessMemDB.GetWitnessesAsHash())
 	startMci := graphInfo.GetLastStableBallMCI()
 	endMci, err := strconv.ParseInt(endmci, 10, 64)
 	if err != nil {
@@ -357,6 +471,10 @@ func (n *Node) fetchData() {
 		bs, _ := json.Marshal(newUnit)
 		log.Println(string(bs))
 		// 验证单元是否合格
+		if err := n.transaction.ReviewWitnessList(newUnit); err != nil {
+			log.Println(err)
+			continue
+		}
 		if err := n.transaction.ReviewUnit(newUnit); err != nil {
 			log.Println(err)
 			continue
@@ -376,6 +494,10 @@ func (n *Node) fetchData() {
 
 		newUnit := entity.NewUnit
 		// 验证单元是否合格
+		if err := n.transaction.ReviewWitnessList(newUnit); err != nil {
+			log.Println(err)
+			continue
+		}
 		if err := n.transaction.ReviewUnit(newUnit); err != nil {
 			log.Println(err)
 			continue
@@ -403,12 +525,50 @@ func (n *Node) notifyBusy(p *boy.Peer) {
 	}
 }
 
+// startIPC initializes and starts the IPC RPC endpoint.
+func (n *Node) startIPC(apis []rpc.API) error {
+	if n.ipcEndpoint == "" {
+		return nil // IPC disabled.
+	}
+	listener, handler, err := rpc.StartIPCEndpoint(n.ipcEndpoint, apis)
+	if err != nil {
+		return err
+	}
+	n.ipcListener = listener
+	n.ipcHandler = handler
+
+	log.Println("IPC endpoint opened", "url", n.ipcEndpoint)
+
+	return nil
+}
+
+// stopIPC terminates the IPC RPC endpoint.
+func (n *Node) stopIPC() {
+	if n.ipcListener != nil {
+		n.ipcListener.Close()
+		n.ipcListener = nil
+
+		log.Println("IPC endpoint closed", "endpoint", n.ipcEndpoint)
+	}
+	if n.ipcHandler != nil {
+		n.ipcHandler.Stop()
+		n.ipcHandler = nil
+	}
+}
+
 // startHTTP initializes and starts the HTTP RPC endpoint.
 func (n *Node) startHTTP(apis []rpc.API) error {
 	// Short circuit if the HTTP endpoint isn't being exposed
 	endpoint := n.config.RpcServer
 
-	_, _, err := rpc.StartHTTPEndpoint(endpoint, apis, []string{}, []string{}, []string{})
+	// Private APIs are only served over IPC
+	var public []rpc.API
+	for _, api := range apis {
+		if api.Public {
+			public = append(public, api)
+		}
+	}
+	_, _, err := rpc.StartHTTPEndpoint(endpoint, public, n.config.HTTPModules, n.config.HTTPCors, n.config.HTTPVirtualHosts)
 	if err != nil {
 		return err
 	}
@@ -430,7 +590,11 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 	}
 
 	// Start the various API endpoints, terminating all in case of errors
+	if err := n.startIPC(apis); err != nil {
+		return err
+	}
 	if err := n.startHTTP(apis); err != nil {
+		n.stopIPC()
 		return err
 	}
 
@@ -450,6 +614,11 @@ func (n *Node) Server() *p2p.Server {
 	return n.server
 }
 
+// IPCEndpoint retrieves the current IPC endpoint used by the protocol stack.
+func (n *Node) IPCEndpoint() string {
+	return n.ipcEndpoint
+}
+
 // DataDir retrieves the current datadir location.
 func (n *Node) DataDir() string {
 	return n.config.DataDir
@@ -469,46 +638,56 @@ func (n *Node) GetDbMgr() *boydb.DatabaseManager {
 }
 
 func (n *Node) GetWitness() []string {
-	return config.WitnessList
+	witnesses := make([]string, len(n.genesis.Witnesses))
+	for i, witness := range n.genesis.Witnesses {
+		witnesses[i] = witness.String()
+	}
+	return witnesses
+}
+
+// Genesis returns the genesis of the network the node is part of.
+func (n *Node) Genesis() *core.Genesis {
+	return n.genesis
 }
 
 func (n *Node) initDatabase() error {
-	databaseDir := config.Const_DATABASE_PATH + config.Const_DATABASE_NAME
-	databaseDir = path.Join(n.config.DataDir, databaseDir)
+	databaseDir := n.config.DatabaseDir()
 
 	// 初始化 数据存储
-	db := boydb.GetDbInstance()
-	err := db.InitDatabase(databaseDir)
+	if n.config.Ephemeral {
+		n.dbManager.InitWithDatabase(boydb.NewMemDatabase())
+		return n.dbManager.Migrate()
+	}
+	err := n.dbManager.InitDatabase(databaseDir, n.config.DatabaseCache, n.config.DatabaseHandles)
 	if err != nil {
 		return err
 	}
-
-	n.dbManager = db
+	if err := n.dbManager.Migrate(); err != nil {
+		return err
+	}
 
 	return nil
 }
 
 func (n *Node) initGenesis() {
-	pdb := memdb.GetParentMemDBInstance()
-	wdb := memdb.GetWitnessMemDBInstance()
+	pdb := n.parentMemDB
+	wdb := n.witnessMemDB
 
-	pdb.InitParentMemDB(n.dbManager)
-	wdb.InitWitnessMemDB(n.dbManager)
+	pdb.InitParentMemDB()
+	wdb.InitWitnessMemDB()
 
-	genesisUnit, err := n.dbManager.GetUnitByHash(common.HexToHash(config.GENISIS_UNIT_HASH))
+	genesisUnit, err := n.dbManager.GetUnitByHash(n.genesisHash)
 	if err != nil {
-		genesisUnit = config.GenesisUnit()
-		n.dbManager.SaveUnitToDb(genesisUnit)
+		genesisUnit = n.genesis.ToUnit()
+		n.dbManager.SaveGenisisUnit(genesisUnit)
 		pdb.SaveNewTip(genesisUnit.Hash)
 		wdb.SaveWitnessList(genesisUnit.WitnessList)
-		// log.Println(genesisUnit.HashKey().String())
-		// 这里存储12个见证人的未花费列表
-		for i := 0; i < len(genesisUnit.WitnessList); i++ {
-			unSpent := types.UTXO{UnitHash: genesisUnit.Hash, MessageIndex: 0, OutputIndex: i, Output: types.NewOutput(genesisUnit.WitnessList[i], 10000000)}
-			n.dbManager.SaveUnspentOutput(genesisUnit.WitnessList[i], unSpent)
+		// 这里存储创世文件中分配的未花费列表
+		for _, unSpent := range n.genesis.UnspentOutputs(genesisUnit) {
+			n.dbManager.SaveUnspentOutput(unSpent.Output.Address, unSpent)
 
 			strByte, _ := json.Marshal(unSpent)
-			log.Println(genesisUnit.WitnessList[i].String(), ":", string(strByte))
+			log.Println(unSpent.Output.Address.String(), ":", string(strByte))
 		}
 	}
 }
@@ -516,50 +695,68 @@ func (n *Node) initGenesis() {
 // 启动节点
 func (n *Node) initP2p() (*boy.ProtocolManager, error) {
 	// 根据配置生成协议管理类实例
-	protocol, _ := boy.NewProtocolManager(config.NETWORK_ID)
+	protocol, _ := boy.NewProtocolManager(n.genesis.NetworkID)
+	// 同步事件只发给本节点, 同一进程中的节点互不干扰
+	protocol.EventBus = n.eventBus
 
-	// ECDSA算法生成密钥对
-	nodeKey, err := crypto.GenerateKey()
-	if err != nil {
-		return &boy.ProtocolManager{}, err
-	}
 	port := n.config.P2P.ListenAddr
 
-	// 获取所有协议版本
-	arrProtocols := protocol.Protocol()
-
-	// 构建 p2p Server 结构体,Server管理所有节点的连接
-	n.server = &p2p.Server{
-		// 服务端配置
-		Config: p2p.Config{
-			MaxPeers:   100,
-			Name:       boy.ProtocolName,
-			PrivateKey: nodeKey,
-			ListenAddr: port,
-			Protocols:  arrProtocols,
-		},
+	// 获取所有协议版本, 加入DAG消息, 握手时拒绝其他网络的节点
+	arrProtocols := n.wire.extend(protocol.Protocol())
+
+	// 以节点配置为基础构建 p2p Server 结构体,Server管理所有节点的连接
+	serverConfig := n.config.P2P
+	serverConfig.Name = boy.ProtocolName
+	// 节点密钥保存在数据目录中, 重启后节点ID不变
+	serverConfig.PrivateKey = n.config.NodeKey()
+	serverConfig.Protocols = arrProtocols
+	if serverConfig.NodeDatabase == "" {
+		serverConfig.NodeDatabase = n.config.NodeDB()
+	}
+	// 数据目录中的静态节点, 可信节点和封禁列表
+	serverConfig.StaticNodes = append(serverConfig.StaticNodes, n.config.StaticNodes()...)
+	serverConfig.TrustedNodes = append(serverConfig.TrustedNodes, n.config.TrustedNodes()...)
+	serverConfig.BannedNodes = append(serverConfig.BannedNodes, n.config.BannedNodes()...)
+	// 节点记录中公布网络, 创世单元, 稳定MCI和角色, 拨号前过滤其他网络的节点
+	serverConfig.ENREntries = append(serverConfig.ENREntries, n.recordEntries()...)
+	serverConfig.DialFilter = n.acceptRecord
+	// 节点角色通过 discovery v5 的主题公布
+	if len(n.config.AdvertisedRoles()) > 0 {
+		serverConfig.DiscoveryV5 = true
 	}
 
-	// 遍历主网的引导节点，p2p服务器从BootstrapNodes中得到相邻节点
-	for _, value := range config.MainnetBootnodes {
-		nodeSuper, err := discover.ParseNode(value)
-
+	if n.config.NAT != "" {
+		natm, err := nat.Parse(n.config.NAT)
 		if err != nil {
-			return &boy.ProtocolManager{}, err
+			return &boy.ProtocolManager{}, fmt.Errorf("invalid NAT option %q: %v", n.config.NAT, err)
 		}
-		n.server.Config.BootstrapNodes = append(n.server.Config.BootstrapNodes, nodeSuper)
+		serverConfig.NAT = natm
 	}
 
-	// 是否发现其他节点
-	n.server.NoDiscovery = n.config.P2P.NoDiscovery
+	// 主网未配置引导节点时使用主网的引导节点，p2p服务器从BootstrapNodes中得到相邻节点
+	if len(serverConfig.BootstrapNodes) == 0 && n.config.Genesis == nil {
+		for _, value := range config.MainnetBootnodes {
+			nodeSuper, err := discover.ParseNode(value)
+
+			if err != nil {
+				return &boy.ProtocolManager{}, err
+			}
+			serverConfig.BootstrapNodes = append(serverConfig.BootstrapNodes, nodeSuper)
+		}
+	}
+	n.server = &p2p.Server{Config: serverConfig}
 
 	// 启动p2p服务
-	err = n.server.Start()
-	if err != nil {
+	if err := n.server.Start(); err != nil {
 		log.Println(err)
 		return &boy.ProtocolManager{}, err
 	}
 
+	n.advertiseRoles()
+	if n.server.Record() != nil {
+		go n.publishRecord()
+	}
+
 	// 给pm分配一个id
 	protocol.Self = n.server.NodeInfo().ID[:8]
 	protocol.StartTimer()
@@ -615,6 +812,74 @@ func (n *Node) SignMessage(data interface{}, addr common.Address, password strin
 	return signature, nil
 }
 
+// SignUnit signs the unit with an unlocked keystore account and seals its
+// author and hash.
+func (n *Node) SignUnit(unit types.Unit, account accounts.Account) (types.Unit, error) {
+	wallet, err := n.GetAccountManager().Find(account)
+	if err != nil {
+		return unit, err
+	}
+	return n.sealUnit(unit, account, func(hash []byte) ([]byte, error) {
+		return wallet.SignHash(account, hash)
+	})
+}
+
+// SignUnitWithPassphrase is like SignUnit, but unlocks the account with the
+// passphrase for this signature only.
+func (n *Node) SignUnitWithPassphrase(unit types.Unit, account accounts.Account, passphrase string) (types.Unit, error) {
+	wallet, err := n.GetAccountManager().Find(account)
+	if err != nil {
+		return unit, err
+	}
+	return n.sealUnit(unit, account, func(hash []byte) ([]byte, error) {
+		return wallet.SignHashWithPassphrase(account, passphrase, hash)
+	})
+}
+
+func (n *Node) sealUnit(unit types.Unit, account accounts.Account, sign func(hash []byte) ([]byte, error)) (types.Unit, error) {
+	unit.TimeStamp = time.Now().Unix()
+	data, err := json.Marshal(unit)
+	if err != nil {
+		return unit, err
+	}
+	signature, err := sign(n.signHash(data))
+	if err != nil {
+		return unit, err
+	}
+	signature[64] += 27 // Transform V from 0/1 to 27/28 according to the yellow paper
+
+	unit.Authors = types.Authors{types.NewAuthor(account.Address, signature)}
+	unit.Hash = unit.HashKey()
+	return unit, nil
+}
+
+// SubmitUnit hands a unit authored by this node to the DAG, it is broadcast to
+// the peers once handled.
+func (n *Node) SubmitUnit(unit types.Unit) {
+	entity := types.NewUnitEntity{FromPeerId: "local", NewUnit: unit}
+	n.handleNewUnitEvent(entity)
+}
+
+// Witnesses returns the witness list currently in force.
+func (n *Node) Witnesses() []common.Address {
+	return n.witnessMemDB.GetWitnessesAsHash()
+}
+
+// Database returns the database of the node.
+func (n *Node) Database() *boydb.DatabaseManager {
+	return n.dbManager
+}
+
+// ParentMemDB returns the in-memory view of the DAG tips.
+func (n *Node) ParentMemDB() *memdb.ParentMemDB {
+	return n.parentMemDB
+}
+
+// WitnessMemDB returns the in-memory witness list and vote state.
+func (n *Node) WitnessMemDB() *memdb.WitnessMemDB {
+	return n.witnessMemDB
+}
+
 // This gives context to the signed message and prevents signing of transactions.
 func (n *Node) signHash(data []byte) []byte {
 	msg := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(data), data)
@@ -660,124 +925,31 @@ func (n *Node) NewJoint(address string, password string, tx string, amount int)
 	}
 	newUnit.SetSignature(signedUnit)
 
-	entity := types.NewUnitEntity{FromPeerId: "local", HasPeerIds: []string{}, NewUnit: newUnit}
+	entity := types.NewUnitEntity{FromPeerId: "local", NewUnit: newUnit}
 	n.handleNewUnitEvent(entity)
 
 	return newUnit.Hash, nil
 }
 
-// 轻节点发起一笔交易
-func (n *Node) NewJointLight(address string, password string, tx string, amount int) error {
-	// TODO 再增加一些安全保证检查
-	if address == "" {
-		return ErrNodeSender
-	} else if password == "" {
-		return ErrNodePassWord
-	} else if len(tx) == 0 {
-		return ErrNodeAmount
-	}
-
-	const ConstHeaderCommission = 100
-	const ConstPayloadCommission = 100
-
-	// 计算要支出的总额
-	totalAmount := 0
-	totalAmount = totalAmount + amount
-
-	_, err := n.FindAccountWith(address)
-	if err != nil {
-		log.Println(err)
-		return ErrNodeNoAccount
+// 轻节点发起一笔交易, 单元在本地构造和签名, 通过hub广播
+func (n *Node) NewJointLight(address string, password string, tx string, amount int) (common.Hash, error) {
+	if n.light == nil {
+		return common.Hash{}, ErrLightDisabled
 	}
-
-	// 打包交易
-	addr := common.HexToAddress(address)
-	account := accounts.Account{Address: addr}
-
-	// Calculate all spending
-	totalSpend := totalAmount + ConstHeaderCommission + ConstPayloadCommission
-
-	// 拿到该地址所有的未花费(稳定池和Pending池)
-	unSpent := n.transaction.ChoiceInputs(account)
-
-	// 这里计算出多少笔unSpent来支撑这笔输出
-	// 将已经使用到unSpent记录在toOther中
-	var toOther []types.UTXO
-	toMyself, curAmount := 0, 0
-	for _, u := range unSpent {
-		curAmount = curAmount + u.Output.Amount
-		toOther = append(toOther, u)
-		// 当前这一笔就足够输出
-		if curAmount >= totalSpend {
-			//toOther = append(toOther, u)
-			toMyself = curAmount - totalAmount
-			// 扣除见证人手续费
-			toMyself = toMyself - ConstHeaderCommission
-			// 扣除挖矿手续费
-			toMyself = toMyself - ConstPayloadCommission
-			break
-		}
-	}
-
-	// 余额不足
-	if curAmount < totalAmount {
-		return transaction.ErrNotEnoughBalance
-	}
-
-	// 手续费不足
-	if curAmount < totalSpend {
-		return transaction.ErrNotEnoughCommission
-	}
-
-	entity := types.LightNewUnitEntity{FromAddress: address}
-	// TODO 临时先将单元发送到最优节点
-	n.GetProtocolMgr().SendMsgToPeer(n.GetProtocolMgr().GetBestPeer(), boy.MSG_NEWUNIT_LIGHT_Q, entity)
-
-	return nil
-}
-
-func (n *Node) CreateUnitForLight(address string, tx string, amount int) (types.Unit, error) {
-
-	// TODO 再增加一些安全保证检查
 	if address == "" {
-		return types.Unit{}, ErrNodeSender
+		return common.Hash{}, ErrNodeSender
+	} else if password == "" {
+		return common.Hash{}, ErrNodePassWord
 	} else if len(tx) == 0 {
-		return types.Unit{}, ErrNodeAmount
-	}
-
-	// 计算要支出的总额
-	outAmount := 0
-	outAmount = outAmount + amount
-
-	_, err := n.FindAccountWith(address)
-	if err != nil {
-		log.Println(err)
-		return types.Unit{}, ErrNodeNoAccount
+		return common.Hash{}, ErrNodeAmount
 	}
 
-	// 打包交易
-	addr := common.HexToAddress(address)
-	account := accounts.Account{Address: addr}
-
-	newUnit, err := n.transaction.CreateTx(account, outAmount, tx, amount)
+	account, err := n.FindAccountWith(address)
 	if err != nil {
 		log.Println(err)
-		return types.Unit{}, ErrNodeCreateTX
+		return common.Hash{}, ErrNodeNoAccount
 	}
-
-	// 签名这笔交易
-	//newUnit.Authors = types.Authors{}
-	//jsonByte, _ := json.Marshal(newUnit)
-	//signedUnit, err := n.SignMessage(jsonByte, account.Address, password)
-	//if err != nil {
-	//	log.Println(err)
-	//	return common.Hash{}, ErrNodeSinged
-	//}
-	//newUnit.Authors = types.Authors{types.NewAuthor(account.Address, []byte{})}
-	// 计算单元的hash
-	//newUnit.Hash = newUnit.HashKey()
-
-	return newUnit, nil
+	return n.light.send(account.Address, password, common.HexToAddress(tx), amount)
 }
 
 // 通过一个地址找到指定账号
@@ -870,13 +1042,12 @@ func (n *Node) PreClearCache() {
 
 // apis returns the collection of RPC descriptors this node offers.
 func (n *Node) apis() []rpc.API {
-	return []rpc.API{
+	apis := []rpc.API{
 		{
 			Namespace: "admin",
 			Version:   "1.0",
-			Service:   NewPrivateAdminAPI(n),
-			// todo remove flag `Public: true`
-			Public: true,
+			Service:   NewPrivatePeerListAPI(n),
+			Public:    false,
 		}, {
 			Namespace: "admin",
 			Version:   "1.0",
@@ -884,6 +1055,78 @@ func (n *Node) apis() []rpc.API {
 			Public:    true,
 		},
 	}
+	if n.light != nil {
+		return append(apis, rpc.API{
+			Namespace: "light",
+			Version:   "1.0",
+			Service:   NewPublicLightAPI(n),
+			Public:    true,
+		})
+	}
+	apis = append(apis, []rpc.API{
+		{
+			Namespace: "vote",
+			Version:   "1.0",
+			Service:   NewPublicVoteAPI(n),
+			Public:    true,
+		}, {
+			Namespace: "outbox",
+			Version:   "1.0",
+			Service:   NewPublicOutboxAPI(n),
+			Public:    true,
+		}, {
+			Namespace: "hub",
+			Version:   "1.0",
+			Service:   NewPublicHubAPI(n),
+			Public:    true,
+		},
+	}...)
+	if n.dev != nil {
+		apis = append(apis, rpc.API{
+			Namespace: "dev",
+			Version:   "1.0",
+			Service:   NewPrivateDevAPI(n),
+			Public:    false,
+		})
+	}
+	return apis
+}
+
+// apiMethods lists the exported methods of every API the node serves, grouped
+// by namespace and named the way the RPC layer exposes them (lower camel case).
+func (n *Node) apiMethods() map[string][]string {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	methods := make(map[string][]string)
+	for _, api := range n.rpcAPIs {
+		typ := reflect.TypeOf(api.Service)
+		for i := 0; i < typ.NumMethod(); i++ {
+			name := typ.Method(i).Name
+			methods[api.Namespace] = append(methods[api.Namespace], strings.ToLower(name[:1])+name[1:])
+		}
+	}
+	for _, list := range methods {
+		sort.Strings(list)
+	}
+	return methods
+}
+
+// Stop terminates the services and the background routines of the node and
+// closes its IPC endpoint.
+func (n *Node) Stop() error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for _, lifecycle := range n.lifecycles {
+		lifecycle.Stop()
+	}
+	n.lifecycles = nil
+	if n.dev != nil {
+		n.dev.stop()
+	}
+	n.stopIPC()
+	return nil
 }
 
 // Wait blocks the thread until the node is stopped. If the node is not running
@@ -0,0 +1,345 @@
+package node
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"babyboy-dag/boydb"
+	"babyboy-dag/common"
+	"babyboy-dag/core/types"
+)
+
+const (
+	outboxRetryMin  = 5 * time.Second // First retry delay of an unacknowledged unit
+	outboxRetryMax  = 5 * time.Minute // Upper bound of the exponential retry delay
+	outboxSentLimit = 256             // Number of acknowledged units kept for status queries
+)
+
+// Outbox states of a unit, as returned over RPC.
+const (
+	OutboxQueued  = "queued"  // Waiting for the local DAG or for a peer to send to
+	OutboxSent    = "sent"    // Broadcast, waiting for enough peers
+	OutboxDone    = "done"    // Received by enough peers, removed from the queue
+	OutboxUnknown = "unknown" // Not authored here or delivered long ago
+)
+
+// OutboxEntry describes a unit authored by this node and its delivery.
+type OutboxEntry struct {
+	Hash      common.Hash `json:"hash"`
+	State     string      `json:"state"`
+	Peers     []string    `json:"peers"`     // Peers the unit was delivered to
+	Attempts  int         `json:"attempts"`  // Broadcasts so far
+	Queued    int64       `json:"queued"`    // Unix time the unit was queued
+	NextRetry int64       `json:"nextRetry"` // Unix time of the next broadcast, 0 if done
+}
+
+type outboxItem struct {
+	unit      types.Unit
+	peers     map[string]bool
+	attempts  int
+	queued    time.Time
+	nextRetry time.Time
+	resubmit  bool // Loaded from disk but not in the DAG yet
+}
+
+// outbox keeps the units authored by this node in the database until they
+// were delivered to minPeers peers. Units are broadcast again with an
+// exponential backoff, and at once when a new peer connects.
+type outbox struct {
+	node     *Node
+	db       *boydb.DatabaseManager
+	minPeers int
+
+	lock  sync.Mutex
+	items map[common.Hash]*outboxItem
+	sent  []OutboxEntry // Recently acknowledged units, oldest first
+	wake  chan struct{}
+}
+
+func newOutbox(n *Node, minPeers int) *outbox {
+	if minPeers < 1 {
+		minPeers = 1
+	}
+	return &outbox{
+		node:     n,
+		db:       n.dbManager,
+		minPeers: minPeers,
+		items:    make(map[common.Hash]*outboxItem),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// start loads the units left over by the previous run and starts retrying.
+func (o *outbox) start() {
+	o.lock.Lock()
+	now := time.Now()
+	for _, unit := range o.db.GetCacheUnitFromDb() {
+		o.items[unit.Hash] = &outboxItem{
+			unit:      unit,
+			peers:     make(map[string]bool),
+			queued:    now,
+			nextRetry: now,
+			resubmit:  !o.db.IsExistUnit(unit.Hash),
+		}
+	}
+	if len(o.items) > 0 {
+		log.Println("Outbox: resending", len(o.items), "units")
+	}
+	o.lock.Unlock()
+
+	go o.loop()
+}
+
+// add persists a locally authored unit before it is handed to the DAG.
+func (o *outbox) add(unit types.Unit) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if _, ok := o.items[unit.Hash]; ok {
+		return
+	}
+	o.db.SaveCacheUnitToDb(unit)
+	now := time.Now()
+	o.items[unit.Hash] = &outboxItem{
+		unit:      unit,
+		peers:     make(map[string]bool),
+		queued:    now,
+		nextRetry: now.Add(outboxRetryMin),
+	}
+}
+
+// accepted records that the DAG accepted a unit, it is broadcast from now on.
+func (o *outbox) accepted(hash common.Hash) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if item, ok := o.items[hash]; ok {
+		item.resubmit = false
+	}
+}
+
+// sent counts a broadcast of a unit that reached at least one peer, and backs
+// off the next one.
+func (o *outbox) sent(hash common.Hash) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	item, ok := o.items[hash]
+	if !ok {
+		return
+	}
+	item.attempts++
+	item.nextRetry = time.Now().Add(backoff(item.attempts))
+}
+
+// delivered records the peers that have a unit: they acknowledged it, or they
+// relayed or announced it back to us. Sending a unit proves nothing.
+func (o *outbox) delivered(hash common.Hash, peers []string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	item, ok := o.items[hash]
+	if !ok {
+		return
+	}
+	for _, peer := range peers {
+		// Peers are counted by node ID, whichever protocol reported them
+		if id, ok := o.node.scores.resolve(peer); ok {
+			item.peers[id.String()] = true
+		}
+	}
+	if len(item.peers) >= o.minPeers {
+		o.done(hash, item)
+	}
+}
+
+// rejected drops a unit the DAG refused, broadcasting it again would not help.
+func (o *outbox) rejected(hash common.Hash, err error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	item, ok := o.items[hash]
+	if !ok {
+		return
+	}
+	log.Println("Outbox: dropping unit rejected by the DAG", hash.String(), err)
+	o.db.DelCacheUnitFromDb(item.unit)
+	delete(o.items, hash)
+}
+
+// done removes an acknowledged unit from the queue, the caller holds the lock.
+func (o *outbox) done(hash common.Hash, item *outboxItem) {
+	o.db.DelCacheUnitFromDb(item.unit)
+	delete(o.items, hash)
+
+	entry := item.entry(OutboxDone)
+	o.sent = append(o.sent, entry)
+	if len(o.sent) > outboxSentLimit {
+		o.sent = o.sent[len(o.sent)-outboxSentLimit:]
+	}
+}
+
+// flush broadcasts every queued unit now, e.g. because a peer connected.
+func (o *outbox) flush() {
+	o.lock.Lock()
+	now := time.Now()
+	for _, item := range o.items {
+		item.nextRetry = now
+	}
+	o.lock.Unlock()
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *outbox) loop() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-o.wake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+		timer.Reset(o.retry())
+	}
+}
+
+// retry broadcasts the units whose retry time has come and returns the delay
+// until the next one is due. Only broadcasts that reached a peer count as
+// attempts, without peers the units are retried at the first delay.
+func (o *outbox) retry() time.Duration {
+	o.lock.Lock()
+	now := time.Now()
+	var broadcast, resubmit []types.Unit
+	for hash, item := range o.items {
+		if item.nextRetry.After(now) {
+			continue
+		}
+		if item.resubmit {
+			// Left over by the previous run before the DAG accepted it
+			if item.attempts > 0 {
+				log.Println("Outbox: dropping unit rejected by the DAG", hash.String())
+				o.db.DelCacheUnitFromDb(item.unit)
+				delete(o.items, hash)
+				continue
+			}
+			resubmit = append(resubmit, item.unit)
+			item.attempts++
+			item.nextRetry = now.Add(backoff(item.attempts))
+			continue
+		}
+		broadcast = append(broadcast, item.unit)
+		item.nextRetry = now.Add(outboxRetryMin)
+	}
+	o.lock.Unlock()
+
+	// Hand the units over without the lock, the DAG reports back through
+	// accepted and rejected
+	for _, unit := range resubmit {
+		o.node.transaction.RecvUnit(types.NewUnitEntity{FromPeerId: "local", NewUnit: unit})
+	}
+	for _, unit := range broadcast {
+		if o.node.broadcastUnit(unit) > 0 {
+			o.sent(unit.Hash)
+		}
+	}
+	return o.next()
+}
+
+// next returns the delay until the next retry is due.
+func (o *outbox) next() time.Duration {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	now := time.Now()
+	next := outboxRetryMax
+	for _, item := range o.items {
+		if wait := item.nextRetry.Sub(now); wait < next {
+			next = wait
+		}
+	}
+	if next < 0 {
+		next = 0
+	}
+	return next
+}
+
+func backoff(attempts int) time.Duration {
+	delay := outboxRetryMin
+	for i := 1; i < attempts && delay < outboxRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > outboxRetryMax {
+		delay = outboxRetryMax
+	}
+	return delay
+}
+
+// status returns the queued units, oldest first, followed by the recently
+// acknowledged ones.
+func (o *outbox) status() []OutboxEntry {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	entries := make([]OutboxEntry, 0, len(o.items)+len(o.sent))
+	for _, item := range o.items {
+		entries = append(entries, item.entry(item.state()))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Queued < entries[j].Queued
+	})
+	return append(entries, o.sent...)
+}
+
+// lookup returns the outbox state of a unit.
+func (o *outbox) lookup(hash common.Hash) (OutboxEntry, bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if item, ok := o.items[hash]; ok {
+		return item.entry(item.state()), true
+	}
+	for _, entry := range o.sent {
+		if entry.Hash == hash {
+			return entry, true
+		}
+	}
+	return OutboxEntry{}, false
+}
+
+func (item *outboxItem) state() string {
+	if item.resubmit || item.attempts == 0 && len(item.peers) == 0 {
+		return OutboxQueued
+	}
+	return OutboxSent
+}
+
+func (item *outboxItem) entry(state string) OutboxEntry {
+	peers := make([]string, 0, len(item.peers))
+	for peer := range item.peers {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	entry := OutboxEntry{
+		Hash:     item.unit.Hash,
+		State:    state,
+		Peers:    peers,
+		Attempts: item.attempts,
+		Queued:   item.queued.Unix(),
+	}
+	if state != OutboxDone {
+		entry.NextRetry = item.nextRetry.Unix()
+	}
+	return entry
+}
@@ -0,0 +1,48 @@
+package node
+
+import (
+	"os"
+
+	"babyboy-dag/p2p/discover"
+)
+
+// updateNodeList adds a node to or removes it from one of the node lists of the
+// datadir, so that peers added over RPC are kept across restarts.
+func (n *Node) updateNodeList(name string, node *discover.Node, add bool) error {
+	path := n.config.nodeListFile(name)
+	if path == "" {
+		return nil
+	}
+	n.listLock.Lock()
+	defer n.listLock.Unlock()
+
+	var urls []string
+	if err := loadJSON(path, &urls); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	list := make([]string, 0, len(urls)+1)
+	for _, url := range urls {
+		// Entries are matched by ID, the address of a node may change
+		if old, err := discover.ParseNode(url); err == nil && old.ID == node.ID {
+			continue
+		}
+		list = append(list, url)
+	}
+	if add {
+		list = append(list, node.String())
+	}
+	return saveJSON(path, list)
+}
+
+// saveBans writes the bans in force to the datadir.
+func (n *Node) saveBans() error {
+	path := n.config.nodeListFile(datadirBannedNodes)
+	server := n.Server()
+	if path == "" || server == nil {
+		return nil
+	}
+	n.listLock.Lock()
+	defer n.listLock.Unlock()
+
+	return saveJSON(path, server.Bans())
+}
@@ -0,0 +1,215 @@
+package node
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"babyboy-dag/boy"
+	"babyboy-dag/p2p"
+	"babyboy-dag/p2p/discover"
+	"babyboy-dag/transaction"
+)
+
+// Penalties of the peer misbehaviours, a peer is disconnected and banned for
+// peerBanDuration once its score drops to peerBanScore. Scores recover by
+// peerScoreRecovery points per minute.
+const (
+	penaltyInvalidUnit  = -20 // Unit whose hash does not match its content
+	penaltyBadSignature = -50 // Unit with an invalid author signature
+	penaltyUnsolicited  = -10 // Sync data that was not requested from the peer
+	penaltyTimeout      = -5  // Sync request left unanswered
+
+	peerBanScore      = -100
+	peerScoreRecovery = 1
+	peerBanDuration   = time.Hour
+
+	syncResponseTimeout = 30 * time.Second
+)
+
+// PeerScore is the reputation of a peer along with the misbehaviours that
+// lowered it.
+type PeerScore struct {
+	Score         int `json:"score"`
+	InvalidUnits  int `json:"invalidUnits"`
+	BadSignatures int `json:"badSignatures"`
+	Unsolicited   int `json:"unsolicited"`
+	Timeouts      int `json:"timeouts"`
+
+	updated time.Time
+}
+
+// recover moves the score back towards zero for the time passed since the
+// last update.
+func (s *PeerScore) recover(now time.Time) {
+	if s.Score < 0 {
+		s.Score += int(now.Sub(s.updated)/time.Minute) * peerScoreRecovery
+		if s.Score > 0 {
+			s.Score = 0
+		}
+	}
+	if s.Score < 0 {
+		// Keep the remainder of the minute for the next update
+		s.updated = s.updated.Add(now.Sub(s.updated) / time.Minute * time.Minute)
+	} else {
+		s.updated = now
+	}
+}
+
+// peerScores tracks the reputation of the peers, fed by the DAG layer, and
+// punishes the peers whose score drops too low.
+type peerScores struct {
+	node *Node
+
+	lock    sync.Mutex
+	scores  map[discover.NodeID]*PeerScore
+	syncing *boy.Peer // Peer a sync response is expected from, nil if none
+	syncSeq int       // Incremented with each sync request, to match timeouts
+}
+
+func newPeerScores(n *Node) *peerScores {
+	return &peerScores{node: n, scores: make(map[discover.NodeID]*PeerScore)}
+}
+
+// resolve finds the connected peer with the given protocol peer id, which is
+// a prefix of its node ID.
+func (ps *peerScores) resolve(peerID string) (discover.NodeID, bool) {
+	server := ps.node.Server()
+	if server == nil || peerID == "" || peerID == "local" {
+		return discover.NodeID{}, false
+	}
+	for _, p := range server.Peers() {
+		if strings.HasPrefix(p.ID().String(), peerID) {
+			return p.ID(), true
+		}
+	}
+	return discover.NodeID{}, false
+}
+
+// penalize lowers the score of a peer and punishes it at the ban threshold.
+func (ps *peerScores) penalize(id discover.NodeID, penalty int, count func(*PeerScore)) {
+	ps.lock.Lock()
+	now := time.Now()
+	score, ok := ps.scores[id]
+	if !ok {
+		score = &PeerScore{updated: now}
+		ps.scores[id] = score
+	}
+	score.recover(now)
+	score.Score += penalty
+	count(score)
+	punish := score.Score <= peerBanScore
+	summary := *score
+	if punish {
+		// Start over once the ban expires
+		delete(ps.scores, id)
+	}
+	ps.lock.Unlock()
+
+	if punish {
+		reason := fmt.Sprintf("score %d: %d invalid units, %d bad signatures, %d unsolicited, %d timeouts",
+			summary.Score, summary.InvalidUnits, summary.BadSignatures, summary.Unsolicited, summary.Timeouts)
+		log.Println("Banning misbehaving peer", id.String()[:16], reason)
+		if server := ps.node.Server(); server != nil {
+			server.PunishPeer(id, now.Add(peerBanDuration), reason)
+		}
+	}
+}
+
+// unitRejected penalizes the peer that sent a provably invalid unit. Units
+// failing the witness list or unit review are not penalized: the review depends
+// on the DAG of the node, which may lag behind the one of the peer.
+func (ps *peerScores) unitRejected(peerID string, err error) {
+	id, ok := ps.resolve(peerID)
+	if !ok {
+		return
+	}
+	switch err {
+	case transaction.ErrUnitSignature:
+		ps.penalize(id, penaltyBadSignature, func(s *PeerScore) { s.BadSignatures++ })
+	case transaction.ErrCheckUnitHash:
+		ps.penalize(id, penaltyInvalidUnit, func(s *PeerScore) { s.InvalidUnits++ })
+	}
+}
+
+// syncRequested records that sync data was requested from p. The peer is
+// penalized if it does not answer in time.
+func (ps *peerScores) syncRequested(p *boy.Peer) {
+	if p == nil {
+		return
+	}
+	ps.lock.Lock()
+	ps.syncing = p
+	ps.syncSeq++
+	seq := ps.syncSeq
+	ps.lock.Unlock()
+
+	ps.watchSync(p, seq)
+}
+
+// syncAnswered checks that sync data from p was requested, penalizing the peer
+// otherwise. done ends the request.
+func (ps *peerScores) syncAnswered(p *boy.Peer, done bool) bool {
+	ps.lock.Lock()
+	expected := ps.syncing == p
+	if expected {
+		// Every batch restarts the timeout
+		ps.syncSeq++
+		if done {
+			ps.syncing = nil
+		}
+	}
+	seq := ps.syncSeq
+	ps.lock.Unlock()
+
+	if !expected {
+		ps.penalize(p.ID(), penaltyUnsolicited, func(s *PeerScore) { s.Unsolicited++ })
+		return false
+	}
+	if !done {
+		ps.watchSync(p, seq)
+	}
+	return true
+}
+
+// watchSync penalizes p if the sync request seq is still unanswered after
+// syncResponseTimeout, and lets the node sync again.
+func (ps *peerScores) watchSync(p *boy.Peer, seq int) {
+	if p == nil {
+		return
+	}
+	time.AfterFunc(syncResponseTimeout, func() {
+		ps.lock.Lock()
+		expired := ps.syncing == p && ps.syncSeq == seq
+		if expired {
+			ps.syncing = nil
+		}
+		ps.lock.Unlock()
+
+		if expired {
+			ps.penalize(p.ID(), penaltyTimeout, func(s *PeerScore) { s.Timeouts++ })
+			ps.node.protocolManager.SetIsRequireSync(true)
+		}
+	})
+}
+
+// score returns the current reputation of a peer.
+func (ps *peerScores) score(id discover.NodeID) PeerScore {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	score, ok := ps.scores[id]
+	if !ok {
+		return PeerScore{}
+	}
+	score.recover(time.Now())
+	return *score
+}
+
+// PeerInfo is the information about a connected peer along with its score.
+type PeerInfo struct {
+	*p2p.PeerInfo
+	Reputation PeerScore `json:"reputation"`
+}
@@ -0,0 +1,63 @@
+package node
+
+import (
+	"log"
+	"time"
+
+	"babyboy-dag/common"
+	"babyboy-dag/p2p/enr"
+)
+
+// Keys of the DAG entries of the node record.
+const (
+	enrNetworkKey   = "netid"
+	enrGenesisKey   = "genesis"
+	enrStableMCIKey = "mci"
+	enrRolesKey     = "roles"
+)
+
+// recordEntries returns the DAG entries of the record of this node.
+func (n *Node) recordEntries() []enr.Entry {
+	return []enr.Entry{
+		enr.WithEntry(enrNetworkKey, n.genesis.NetworkID),
+		enr.WithEntry(enrGenesisKey, n.genesisHash),
+		enr.WithEntry(enrStableMCIKey, n.lastStableMCI()),
+		enr.WithEntry(enrRolesKey, n.config.AdvertisedRoles()),
+	}
+}
+
+// acceptRecord is the dial filter of the node: it rejects nodes whose record
+// lacks the DAG entries or belongs to another network or genesis.
+func (n *Node) acceptRecord(record *enr.Record) bool {
+	var (
+		network uint64
+		genesis common.Hash
+	)
+	if err := record.Load(enr.WithEntry(enrNetworkKey, &network)); err != nil {
+		return false
+	}
+	if err := record.Load(enr.WithEntry(enrGenesisKey, &genesis)); err != nil {
+		return false
+	}
+	return network == n.genesis.NetworkID && genesis == n.genesisHash
+}
+
+// publishRecord updates the last stable MCI in the node record as the DAG
+// advances.
+func (n *Node) publishRecord() {
+	ticker := time.NewTicker(statusUpdateInterval)
+	defer ticker.Stop()
+
+	published := n.lastStableMCI()
+	for range ticker.C {
+		mci := n.lastStableMCI()
+		if mci == published {
+			continue
+		}
+		if err := n.server.SetENREntries(enr.WithEntry(enrStableMCIKey, mci)); err != nil {
+			log.Println("Can't update the node record:", err)
+			return
+		}
+		published = mci
+	}
+}
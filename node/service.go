@@ -5,6 +5,8 @@ import (
 	"babyboy-dag/rpc"
 	"babyboy-dag/event"
 	"babyboy-dag/accounts"
+	"babyboy-dag/boydb"
+	"babyboy-dag/dag/memdb"
 	"errors"
 )
 
@@ -12,12 +14,23 @@ type Service interface {
 	APIs() []rpc.API
 }
 
+// Lifecycle is implemented by services running background routines. They are
+// started by the node once its database, networking and genesis are ready, and
+// stopped when the node stops.
+type Lifecycle interface {
+	Start() error
+	Stop()
+}
+
 type ServiceConstructor func(ctx *ServiceContext) (Service, error)
 
 type ServiceContext struct {
 	Services       map[reflect.Type]Service // Index of the already constructed services
 	EventMux       *event.TypeMux           // Event multiplexer used for decoupled notifications
 	AccountManager *accounts.Manager        // Account manager created by the node.
+	Database       *boydb.DatabaseManager   // Database of the node, opened once the node started
+	ParentMemDB    *memdb.ParentMemDB       // Tips of the DAG of the node
+	WitnessMemDB   *memdb.WitnessMemDB      // Witness list and vote state of the node
 	Node		   *Node
 }
 
@@ -0,0 +1,160 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"babyboy-dag/common"
+	"babyboy-dag/p2p/discv5"
+)
+
+// Roles a node advertises as discovery v5 topics.
+const (
+	RoleFull    = "full"    // Keeps the whole DAG
+	RoleWitness = "witness" // Posts witness units
+	RoleLight   = "light"   // Serves light clients through the hub API
+)
+
+const (
+	lightSessionTimeout = 5 * time.Minute  // Idle time after which a light client loses its slot
+	lightHelloInterval  = time.Minute      // Interval at which light clients renew their slot
+	hubSearchFast       = time.Second      // Topic search period while no hub is known
+	hubSearchSlow       = 30 * time.Second // Topic search period once hubs are known
+)
+
+// roleTopic returns the discovery topic of a role on the network of the given
+// genesis, so that nodes of other networks do not show up in lookups.
+func roleTopic(role string, genesis common.Hash) discv5.Topic {
+	return discv5.Topic(fmt.Sprintf("babyboy-%s@%x", role, genesis[:8]))
+}
+
+// AdvertisedRoles returns the roles the node advertises: Roles if set, full
+// and light otherwise, light only if the node serves light clients.
+func (c *Config) AdvertisedRoles() []string {
+	if c.Roles != nil {
+		return c.Roles
+	}
+	if c.Light != nil {
+		return []string{}
+	}
+	roles := []string{RoleFull}
+	if c.MaxLightClients > 0 {
+		roles = append(roles, RoleLight)
+	}
+	return roles
+}
+
+// advertiseRoles registers the roles of the node as discovery v5 topics.
+func (n *Node) advertiseRoles() {
+	if n.server.DiscV5 == nil {
+		return
+	}
+	for _, role := range n.config.AdvertisedRoles() {
+		log.Println("Advertising role", role)
+		go n.server.DiscV5.RegisterTopic(roleTopic(role, n.genesisHash), nil)
+	}
+}
+
+// lightSessions caps the number of light clients a hub serves. Clients are told
+// apart by the host they connect from, and keep their slot as long as they call
+// the hub at least every lightSessionTimeout.
+type lightSessions struct {
+	lock    sync.Mutex
+	max     int
+	clients map[string]time.Time
+}
+
+func newLightSessions(max int) *lightSessions {
+	return &lightSessions{max: max, clients: make(map[string]time.Time)}
+}
+
+// lightClientKey returns the host an RPC call comes from. Calls without remote
+// address, over IPC, come from the host of the node and need no slot.
+func lightClientKey(ctx context.Context) string {
+	remote, _ := ctx.Value("remote").(string)
+	if remote == "" {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		return remote
+	}
+	return host
+}
+
+// hello gives a slot to the light client of an RPC call or renews it.
+func (ls *lightSessions) hello(ctx context.Context) error {
+	client := lightClientKey(ctx)
+	if client == "" {
+		return nil
+	}
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+
+	now := time.Now()
+	for id, seen := range ls.clients {
+		if now.Sub(seen) > lightSessionTimeout {
+			delete(ls.clients, id)
+		}
+	}
+	if _, ok := ls.clients[client]; !ok && len(ls.clients) >= ls.max {
+		return ErrHubFull
+	}
+	ls.clients[client] = now
+	return nil
+}
+
+// check fails unless the light client of an RPC call holds a slot, which the
+// call renews.
+func (ls *lightSessions) check(ctx context.Context) error {
+	client := lightClientKey(ctx)
+	if client == "" {
+		return nil
+	}
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+
+	now := time.Now()
+	seen, ok := ls.clients[client]
+	if !ok || now.Sub(seen) > lightSessionTimeout {
+		delete(ls.clients, client)
+		return ErrHubNoSession
+	}
+	ls.clients[client] = now
+	return nil
+}
+
+// discoverHubs looks up the hubs serving light clients on the network and
+// adds their RPC endpoints to the hub list. The search slows down once a hub
+// is known.
+func (lc *lightClient) discoverHubs(network *discv5.Network, port int) {
+	setPeriod := make(chan time.Duration, 1)
+	found := make(chan *discv5.Node, 10)
+	setPeriod <- hubSearchFast
+	go network.SearchTopic(roleTopic(RoleLight, lc.node.genesisHash), setPeriod, found, nil)
+
+	slow := false
+	for node := range found {
+		url := "http://" + net.JoinHostPort(node.IP.String(), strconv.Itoa(port))
+		lc.lock.Lock()
+		known := false
+		for _, hub := range lc.hubs {
+			known = known || hub == url
+		}
+		if !known {
+			log.Println("Light: found hub", url)
+			lc.hubs = append(lc.hubs, url)
+		}
+		lc.lock.Unlock()
+
+		if !slow {
+			setPeriod <- hubSearchSlow
+			slow = true
+		}
+	}
+}
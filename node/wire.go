@@ -0,0 +1,402 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"babyboy-dag/boy"
+	"babyboy-dag/common"
+	"babyboy-dag/core/types"
+	"babyboy-dag/dag"
+	"babyboy-dag/p2p"
+	"babyboy-dag/p2p/discover"
+	"babyboy-dag/p2p/protocols"
+)
+
+const (
+	dagVersion             = 1 // Version of the DAG messages, which run inside the boy protocol
+	dagMaxMsgSize          = 10 * 1024 * 1024
+	statusHandshakeTimeout = 10 * time.Second
+	statusUpdateInterval   = 30 * time.Second
+)
+
+// StatusMsg is the handshake of the DAG messages, the first message both peers
+// send on a boy protocol connection.
+type StatusMsg struct {
+	Version       uint
+	NetworkID     uint64
+	Genesis       common.Hash
+	LastStableMCI uint64
+}
+
+// StableMCIMsg announces that the last stable MCI of the sender advanced.
+type StableMCIMsg struct {
+	LastStableMCI uint64
+}
+
+// UnitMsg carries a unit. The unit is JSON encoded, RLP has no signed integers
+// for its levels and indexes.
+type UnitMsg struct {
+	Unit []byte
+}
+
+// UnitHashesMsg announces units by hash, the receiver fetches the ones it misses.
+type UnitHashesMsg struct {
+	Hashes []common.Hash
+}
+
+// GetUnitsMsg requests units by hash, they are sent back as UnitMsg.
+type GetUnitsMsg struct {
+	Hashes []common.Hash
+}
+
+// UnitAckMsg acknowledges units the DAG of the sender accepted, to the peer
+// that sent them.
+type UnitAckMsg struct {
+	Hashes []common.Hash
+}
+
+// dagSpec holds the codes of the DAG messages: a message is sent with its index
+// in the list, after the codes of boy.
+var dagSpec = &protocols.Spec{
+	Name:       "dag",
+	Version:    dagVersion,
+	MaxMsgSize: dagMaxMsgSize,
+	Messages:   []interface{}{StatusMsg{}, StableMCIMsg{}, UnitMsg{}, UnitHashesMsg{}, GetUnitsMsg{}, UnitAckMsg{}},
+}
+
+// PeerStatus is what a peer reported in the status handshake.
+type PeerStatus struct {
+	Version       uint        `json:"version"`
+	NetworkID     uint64      `json:"networkId"`
+	Genesis       common.Hash `json:"genesis"`
+	LastStableMCI uint64      `json:"lastStableMci"`
+}
+
+// WirePeerInfo is the protocol information of a peer: the one of boy along with
+// the status of the DAG messages.
+type WirePeerInfo struct {
+	Boy    interface{} `json:"boy,omitempty"`
+	Status *PeerStatus `json:"status"`
+}
+
+// wirePeer is a peer that passed the status handshake.
+type wirePeer struct {
+	*protocols.Peer
+	status PeerStatus
+}
+
+// wireProtocol adds the DAG messages to the boy protocol. It refuses peers of
+// another network or genesis, keeps track of the progress of the others and
+// exchanges typed messages with them.
+type wireProtocol struct {
+	node *Node
+
+	lock  sync.RWMutex
+	peers map[discover.NodeID]*wirePeer
+}
+
+func newWireProtocol(n *Node) *wireProtocol {
+	return &wireProtocol{node: n, peers: make(map[discover.NodeID]*wirePeer)}
+}
+
+// extend adds the DAG messages to the boy protocols: their codes follow the
+// ones of boy, and the status handshake runs before boy gets any message.
+func (w *wireProtocol) extend(protos []p2p.Protocol) []p2p.Protocol {
+	extended := make([]p2p.Protocol, len(protos))
+	for i, proto := range protos {
+		base, run, peerInfo := proto.Length, proto.Run, proto.PeerInfo
+		proto.Length = base + dagSpec.Length()
+		proto.Run = func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+			return w.run(p, rw, base, run)
+		}
+		proto.PeerInfo = func(id discover.NodeID) interface{} {
+			info := &WirePeerInfo{Status: w.peer(id)}
+			if peerInfo != nil {
+				info.Boy = peerInfo(id)
+			}
+			return info
+		}
+		extended[i] = proto
+	}
+	return extended
+}
+
+// local returns the status of this node.
+func (w *wireProtocol) local() *StatusMsg {
+	return &StatusMsg{
+		Version:       dagVersion,
+		NetworkID:     w.node.genesis.NetworkID,
+		Genesis:       w.node.genesisHash,
+		LastStableMCI: w.node.lastStableMCI(),
+	}
+}
+
+// verify checks the handshake of a peer against the local status.
+func (w *wireProtocol) verify(msg interface{}) error {
+	status, ok := msg.(*StatusMsg)
+	if !ok {
+		return ErrStatusExpected
+	}
+	if status.NetworkID != w.node.genesis.NetworkID {
+		return ErrStatusNetworkID
+	}
+	if status.Genesis != w.node.genesisHash {
+		return ErrStatusGenesis
+	}
+	return nil
+}
+
+// run performs the status handshake on a boy protocol connection, then runs boy
+// and the DAG messages side by side until either fails. A failed handshake
+// disconnects the peer before boy sees it.
+func (w *wireProtocol) run(p *p2p.Peer, rw p2p.MsgReadWriter, base uint64, run func(*p2p.Peer, p2p.MsgReadWriter) error) error {
+	mux := newWireMux(rw, base)
+	defer mux.close()
+	go mux.pump()
+
+	peer := protocols.NewPeer(p, mux.dag, dagSpec)
+	ctx, cancel := context.WithTimeout(context.Background(), statusHandshakeTimeout)
+	msg, err := peer.Handshake(ctx, w.local(), w.verify)
+	cancel()
+	if err != nil {
+		log.Println("Status handshake with", p.ID().String()[:16], "failed:", err)
+		return err
+	}
+	remote := msg.(*StatusMsg)
+	wp := &wirePeer{
+		Peer: peer,
+		status: PeerStatus{
+			Version:       remote.Version,
+			NetworkID:     remote.NetworkID,
+			Genesis:       remote.Genesis,
+			LastStableMCI: remote.LastStableMCI,
+		},
+	}
+	id := p.ID()
+
+	w.lock.Lock()
+	w.peers[id] = wp
+	w.lock.Unlock()
+
+	quit := make(chan struct{})
+	defer func() {
+		close(quit)
+		w.lock.Lock()
+		delete(w.peers, id)
+		w.lock.Unlock()
+	}()
+	go w.announce(wp, quit)
+
+	errc := make(chan error, 2)
+	go func() {
+		errc <- peer.Run(func(msg interface{}) error { return w.handle(wp, msg) })
+	}()
+	go func() {
+		errc <- run(p, mux.boy)
+	}()
+	return <-errc
+}
+
+// handle processes a DAG message of a peer and records how long it took.
+func (w *wireProtocol) handle(wp *wirePeer, msg interface{}) error {
+	defer func(start time.Time) {
+		w.node.metrics.handled(reflect.TypeOf(msg).Elem().Name(), time.Since(start))
+	}(time.Now())
+
+	switch msg := msg.(type) {
+	case *StableMCIMsg:
+		w.lock.Lock()
+		wp.status.LastStableMCI = msg.LastStableMCI
+		w.lock.Unlock()
+	case *UnitMsg:
+		var unit types.Unit
+		if err := json.Unmarshal(msg.Unit, &unit); err != nil {
+			return err
+		}
+		w.node.unitReceived(types.NewUnitEntity{FromPeerId: wp.ID().String(), NewUnit: unit})
+	case *UnitHashesMsg:
+		w.node.gossip.announced(wp.ID().String(), msg.Hashes)
+	case *GetUnitsMsg:
+		w.node.gossip.serve(wp.ID().String(), msg.Hashes)
+	case *UnitAckMsg:
+		for _, hash := range msg.Hashes {
+			w.node.outbox.delivered(hash, []string{wp.ID().String()})
+		}
+	default:
+		return ErrStatusUnexpected
+	}
+	return nil
+}
+
+// announce sends the last stable MCI to a peer whenever it advanced.
+func (w *wireProtocol) announce(wp *wirePeer, quit chan struct{}) {
+	ticker := time.NewTicker(statusUpdateInterval)
+	defer ticker.Stop()
+
+	sent := w.node.lastStableMCI()
+	for {
+		select {
+		case <-ticker.C:
+			mci := w.node.lastStableMCI()
+			if mci == sent {
+				continue
+			}
+			if err := wp.Send(&StableMCIMsg{LastStableMCI: mci}); err != nil {
+				return
+			}
+			sent = mci
+		case <-quit:
+			return
+		}
+	}
+}
+
+// send sends a DAG message to a peer. It fails with ErrStatusPending until the
+// peer passed the status handshake.
+func (w *wireProtocol) send(p *boy.Peer, msg interface{}) error {
+	w.lock.RLock()
+	wp := w.peers[p.ID()]
+	w.lock.RUnlock()
+
+	if wp == nil {
+		return ErrStatusPending
+	}
+	return wp.Send(msg)
+}
+
+// ack acknowledges a unit to the peer that sent it, given by its protocol peer
+// id.
+func (w *wireProtocol) ack(peerID string, hash common.Hash) {
+	w.lock.RLock()
+	var wp *wirePeer
+	for id, peer := range w.peers {
+		if peerID != "" && peerID != "local" && strings.HasPrefix(id.String(), peerID) {
+			wp = peer
+		}
+	}
+	w.lock.RUnlock()
+
+	if wp == nil {
+		return
+	}
+	if err := wp.Send(&UnitAckMsg{Hashes: []common.Hash{hash}}); err != nil {
+		log.Println(err)
+	}
+}
+
+// sendUnit sends a unit to a peer as UnitMsg.
+func (w *wireProtocol) sendUnit(p *boy.Peer, unit types.Unit) error {
+	data, err := json.Marshal(unit)
+	if err != nil {
+		return err
+	}
+	return w.send(p, &UnitMsg{Unit: data})
+}
+
+// peer returns the status reported by a peer, nil while the handshake runs.
+func (w *wireProtocol) peer(id discover.NodeID) *PeerStatus {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	wp, ok := w.peers[id]
+	if !ok {
+		return nil
+	}
+	status := wp.status
+	return &status
+}
+
+// wireMux splits a boy protocol connection: codes below base belong to boy, the
+// others are DAG messages, shifted down by base. The first message of the peer
+// must be a DAG message, the status.
+type wireMux struct {
+	rw   p2p.MsgReadWriter
+	base uint64
+	boy  *wireRW
+	dag  *wireRW
+
+	once   sync.Once
+	err    error         // Why the mux closed, set before closed is closed
+	closed chan struct{} // Closed when reading failed or the connection ends
+}
+
+// wireRW is the boy or the DAG side of a wireMux.
+type wireRW struct {
+	mux   *wireMux
+	in    chan p2p.Msg
+	shift uint64
+}
+
+func newWireMux(rw p2p.MsgReadWriter, base uint64) *wireMux {
+	m := &wireMux{rw: rw, base: base, closed: make(chan struct{})}
+	m.boy = &wireRW{mux: m, in: make(chan p2p.Msg)}
+	m.dag = &wireRW{mux: m, in: make(chan p2p.Msg), shift: base}
+	return m
+}
+
+// pump reads the messages of the connection and hands them to their side until
+// the connection fails.
+func (m *wireMux) pump() {
+	started := false
+	for {
+		msg, err := m.rw.ReadMsg()
+		if err != nil {
+			m.fail(err)
+			return
+		}
+		in := m.boy.in
+		if msg.Code >= m.base {
+			msg.Code -= m.base
+			in = m.dag.in
+			started = true
+		} else if !started {
+			msg.Discard()
+			m.fail(ErrStatusExpected)
+			return
+		}
+		select {
+		case in <- msg:
+		case <-m.closed:
+			msg.Discard()
+			return
+		}
+	}
+}
+
+func (m *wireMux) fail(err error) {
+	m.once.Do(func() {
+		m.err = err
+		close(m.closed)
+	})
+}
+
+func (m *wireMux) close() {
+	m.fail(io.EOF)
+}
+
+func (rw *wireRW) ReadMsg() (p2p.Msg, error) {
+	select {
+	case msg := <-rw.in:
+		return msg, nil
+	case <-rw.mux.closed:
+		return p2p.Msg{}, rw.mux.err
+	}
+}
+
+func (rw *wireRW) WriteMsg(msg p2p.Msg) error {
+	msg.Code += rw.shift
+	return rw.mux.rw.WriteMsg(msg)
+}
+
+// lastStableMCI returns the MCI of the last stable ball of the local DAG.
+func (n *Node) lastStableMCI() uint64 {
+	graphInfo := dag.NewGraphInfoGetter(n.dbManager, n.parentMemDB.GetDagAllTips(), n.witnessMemDB.GetWitnessesAsHash())
+	return uint64(graphInfo.GetLastStableBallMCI())
+}
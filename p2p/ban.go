@@ -0,0 +1,98 @@
+package p2p
+
+import (
+	"sort"
+	"time"
+
+	"babyboy/p2p/discover"
+)
+
+// Ban keeps a node from connecting to the server until it expires.
+type Ban struct {
+	ID      discover.NodeID `json:"id"`
+	Expires time.Time       `json:"expires"` // Zero for a permanent ban
+	Reason  string          `json:"reason,omitempty"`
+}
+
+// Expired reports whether the ban is no longer in force at the given time.
+func (b Ban) Expired(now time.Time) bool {
+	return !b.Expires.IsZero() && !now.Before(b.Expires)
+}
+
+// BanPeer bans a node until expires (forever if zero) and disconnects it if it
+// is connected.
+func (srv *Server) BanPeer(id discover.NodeID, expires time.Time, reason string) Ban {
+	return srv.ban(id, expires, reason, DiscUselessPeer)
+}
+
+// PunishPeer bans a misbehaving node until expires and disconnects it with
+// DiscMisbehaving.
+func (srv *Server) PunishPeer(id discover.NodeID, expires time.Time, reason string) Ban {
+	return srv.ban(id, expires, reason, DiscMisbehaving)
+}
+
+func (srv *Server) ban(id discover.NodeID, expires time.Time, reason string, disc DiscReason) Ban {
+	ban := Ban{ID: id, Expires: expires, Reason: reason}
+
+	srv.banLock.Lock()
+	if srv.bans == nil {
+		srv.bans = make(map[discover.NodeID]Ban)
+	}
+	srv.bans[id] = ban
+	srv.banLock.Unlock()
+
+	select {
+	case srv.peerOp <- func(peers map[discover.NodeID]*Peer) {
+		if p := peers[id]; p != nil {
+			p.Disconnect(disc)
+		}
+	}:
+		<-srv.peerOpDone
+	case <-srv.quit:
+	}
+	return ban
+}
+
+// UnbanPeer lifts the ban of a node, it returns false if the node was not
+// banned.
+func (srv *Server) UnbanPeer(id discover.NodeID) bool {
+	srv.banLock.Lock()
+	defer srv.banLock.Unlock()
+
+	_, ok := srv.bans[id]
+	delete(srv.bans, id)
+	return ok
+}
+
+// Bans returns the bans in force, ordered by node ID.
+func (srv *Server) Bans() []Ban {
+	srv.banLock.Lock()
+	defer srv.banLock.Unlock()
+
+	now := time.Now()
+	bans := make([]Ban, 0, len(srv.bans))
+	for id, ban := range srv.bans {
+		if ban.Expired(now) {
+			delete(srv.bans, id)
+			continue
+		}
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].ID.String() < bans[j].ID.String()
+	})
+	return bans
+}
+
+// isBanned reports whether a node is banned, dropping its ban if expired.
+func (srv *Server) isBanned(id discover.NodeID) bool {
+	srv.banLock.Lock()
+	defer srv.banLock.Unlock()
+
+	ban, ok := srv.bans[id]
+	if ok && ban.Expired(time.Now()) {
+		delete(srv.bans, id)
+		return false
+	}
+	return ok
+}
@@ -10,6 +10,7 @@ import (
 
 	"babyboy/log"
 	"babyboy/p2p/discover"
+	"babyboy/p2p/enr"
 	"babyboy/p2p/netutil"
 )
 
@@ -29,6 +30,10 @@ const (
 	// Endpoint resolution is throttled with bounded backoff.
 	initialResolveDelay = 60 * time.Second
 	maxResolveDelay     = time.Hour
+
+	// The record of a dial candidate is fetched again after this amount
+	// of time.
+	recordCheckExpiration = 10 * time.Minute
 )
 
 // NodeDialer is used to connect to nodes in the network, typically by using
@@ -56,6 +61,10 @@ type dialstate struct {
 	maxDynDials int
 	ntab        discoverTable
 	netrestrict *netutil.Netlist
+	filter      func(*enr.Record) bool // Checks the records of dynamic dial candidates
+
+	checking map[discover.NodeID]bool        // Candidates whose record is being fetched
+	checked  map[discover.NodeID]recordCheck // Filter results of fetched records
 
 	lookupRunning bool
 	dialing       map[discover.NodeID]connFlag
@@ -74,6 +83,8 @@ type discoverTable interface {
 	Resolve(target discover.NodeID) *discover.Node
 	Lookup(target discover.NodeID) []*discover.Node
 	ReadRandomNodes([]*discover.Node) int
+	RequestENR(*discover.Node) (*enr.Record, error)
+	SetRecord(*enr.Record)
 }
 
 // the dial history remembers recent dials.
@@ -98,6 +109,20 @@ type dialTask struct {
 	resolveDelay time.Duration
 }
 
+// recordCheck is the filter result of the record of a dial candidate.
+type recordCheck struct {
+	accepted bool
+	exp      time.Time
+}
+
+// A recordTask fetches the record of a dynamic dial candidate, which is
+// dialed once its record passed the filter.
+type recordTask struct {
+	dest   *discover.Node
+	record *enr.Record
+	err    error
+}
+
 // discoverTask runs discovery table operations.
 // Only one discoverTask is active at any time.
 // discoverTask.Do performs a random lookup.
@@ -111,11 +136,20 @@ type waitExpireTask struct {
 	time.Duration
 }
 
-func newDialState(static []*discover.Node, bootnodes []*discover.Node, ntab discoverTable, maxdyn int, netrestrict *netutil.Netlist) *dialstate {
+// newDialState creates the dial scheduler. Dynamic dial candidates are only
+// dialed if filter accepts their record, filter is ignored without discovery
+// to fetch the records.
+func newDialState(static []*discover.Node, bootnodes []*discover.Node, ntab discoverTable, maxdyn int, netrestrict *netutil.Netlist, filter func(*enr.Record) bool) *dialstate {
+	if ntab == nil {
+		filter = nil
+	}
 	s := &dialstate{
 		maxDynDials: maxdyn,
 		ntab:        ntab,
 		netrestrict: netrestrict,
+		filter:      filter,
+		checking:    make(map[discover.NodeID]bool),
+		checked:     make(map[discover.NodeID]recordCheck),
 		static:      make(map[discover.NodeID]*dialTask),
 		dialing:     make(map[discover.NodeID]connFlag),
 		bootnodes:   make([]*discover.Node, len(bootnodes)),
@@ -150,7 +184,16 @@ func (s *dialstate) newTasks(nRunning int, peers map[discover.NodeID]*Peer, now
 
 	var newtasks []task
 	addDial := func(flag connFlag, n *discover.Node) bool {
-		if err := s.checkDial(n, peers); err != nil {
+		err := s.checkDial(n, peers)
+		if err == nil {
+			err = s.checkRecord(n)
+		}
+		if err == errRecordUnknown {
+			// Fetch the record first, the candidate is dialed once it passed
+			s.checking[n.ID] = true
+			newtasks = append(newtasks, &recordTask{dest: n})
+		}
+		if err != nil {
 			log.Trace("Skipping dial candidate", "id", n.ID, "addr", &net.TCPAddr{IP: n.IP, Port: int(n.TCP)}, "err", err)
 			return false
 		}
@@ -174,6 +217,11 @@ func (s *dialstate) newTasks(nRunning int, peers map[discover.NodeID]*Peer, now
 
 	// Expire the dial history on every invocation.
 	s.hist.expire(now)
+	for id, check := range s.checked {
+		if check.exp.Before(now) {
+			delete(s.checked, id)
+		}
+	}
 
 	// Create dials for static nodes if they are not connected.
 	for id, t := range s.static {
@@ -242,6 +290,9 @@ var (
 	errAlreadyConnected = errors.New("already connected")
 	errRecentlyDialed   = errors.New("recently dialed")
 	errNotWhitelisted   = errors.New("not contained in netrestrict whitelist")
+	errRecordUnknown    = errors.New("record not fetched yet")
+	errRecordChecking   = errors.New("fetching record")
+	errRecordRejected   = errors.New("rejected by its record")
 )
 
 func (s *dialstate) checkDial(n *discover.Node, peers map[discover.NodeID]*Peer) error {
@@ -261,11 +312,40 @@ func (s *dialstate) checkDial(n *discover.Node, peers map[discover.NodeID]*Peer)
 	return nil
 }
 
+// checkRecord checks a dynamic dial candidate against the filter. Candidates
+// whose record can't be fetched are rejected.
+func (s *dialstate) checkRecord(n *discover.Node) error {
+	if s.filter == nil {
+		return nil
+	}
+	if s.checking[n.ID] {
+		return errRecordChecking
+	}
+	check, ok := s.checked[n.ID]
+	switch {
+	case !ok:
+		return errRecordUnknown
+	case !check.accepted:
+		return errRecordRejected
+	}
+	return nil
+}
+
 func (s *dialstate) taskDone(t task, now time.Time) {
 	switch t := t.(type) {
 	case *dialTask:
 		s.hist.add(t.dest.ID, now.Add(dialHistoryExpiration))
 		delete(s.dialing, t.dest.ID)
+	case *recordTask:
+		delete(s.checking, t.dest.ID)
+		accepted := t.err == nil && s.filter(t.record)
+		if t.err != nil {
+			log.Trace("Can't fetch node record", "id", t.dest.ID, "err", t.err)
+		}
+		s.checked[t.dest.ID] = recordCheck{accepted: accepted, exp: now.Add(recordCheckExpiration)}
+		if accepted {
+			s.lookupBuf = append(s.lookupBuf, t.dest)
+		}
 	case *discoverTask:
 		s.lookupRunning = false
 		s.lookupBuf = append(s.lookupBuf, t.results...)
@@ -278,6 +358,11 @@ func (t *dialTask) Do(srv *Server) {
 			return
 		}
 	}
+	// Banned nodes are not dialed, static nodes included
+	if srv.isBanned(t.dest.ID) {
+		log.Trace("Skipping banned node", "id", t.dest.ID)
+		return
+	}
 	err := t.dial(srv, t.dest)
 	if err != nil {
 		log.Trace("Dial error", "task", t, "err", err)
@@ -342,6 +427,14 @@ func (t *dialTask) String() string {
 	return fmt.Sprintf("%v %x %v:%d", t.flags, t.dest.ID[:8], t.dest.IP, t.dest.TCP)
 }
 
+func (t *recordTask) Do(srv *Server) {
+	t.record, t.err = srv.ntab.RequestENR(t.dest)
+}
+
+func (t *recordTask) String() string {
+	return fmt.Sprintf("record request %x", t.dest.ID[:8])
+}
+
 func (t *discoverTask) Do(srv *Server) {
 	// newTasks generates a lookup task whenever dynamic dials are
 	// necessary. Lookups need to take some time, otherwise the
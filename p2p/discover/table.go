@@ -13,6 +13,7 @@ import (
 	"babyboy/common"
 	"babyboy/crypto"
 	"babyboy/log"
+	"babyboy/p2p/enr"
 	"babyboy/p2p/netutil"
 )
 
@@ -65,6 +66,8 @@ type Table struct {
 type transport interface {
 	ping(NodeID, *net.UDPAddr) error
 	findnode(toid NodeID, addr *net.UDPAddr, target NodeID) ([]*Node, error)
+	requestENR(toid NodeID, addr *net.UDPAddr) (*enr.Record, error)
+	setRecord(record *enr.Record)
 	close()
 }
 
@@ -126,6 +129,17 @@ func (tab *Table) Self() *Node {
 	return tab.self
 }
 
+// RequestENR fetches the signed record of a node.
+func (tab *Table) RequestENR(n *Node) (*enr.Record, error) {
+	return tab.net.requestENR(n.ID, n.addr())
+}
+
+// SetRecord sets the signed record of the local node, served to the nodes
+// requesting it.
+func (tab *Table) SetRecord(record *enr.Record) {
+	tab.net.setRecord(record)
+}
+
 // ReadRandomNodes fills the given slice with random nodes from the
 // table. It will not write the same node more than once. The nodes in
 // the slice are copies and can be modified by the caller.
@@ -0,0 +1,180 @@
+package p2p
+
+import (
+	"sync"
+	"time"
+
+	"babyboy/p2p/discover"
+)
+
+// LatencyBuckets are the upper bounds, in seconds, of the buckets of the
+// message latency histograms.
+var LatencyBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// MsgKey identifies a message code of a protocol in one direction.
+type MsgKey struct {
+	Protocol string
+	Code     uint64 // Code within the protocol, without the offset of the connection
+	Ingress  bool
+}
+
+// MsgCounter counts messages and their payload bytes.
+type MsgCounter struct {
+	Packets uint64
+	Bytes   uint64
+}
+
+// MsgLatency is a latency histogram. Buckets are cumulative: Buckets[i] counts
+// the messages that took at most LatencyBuckets[i] seconds.
+//
+// Ingress latency is the time a received message waited for its protocol to
+// read it, egress latency the time writing it to the connection took.
+type MsgLatency struct {
+	Buckets []uint64
+	Count   uint64
+	Sum     float64 // Seconds
+}
+
+// MsgStats collects the message counters of every protocol, in total and per
+// connected peer, and the latency histograms of every message code.
+type MsgStats struct {
+	lock    sync.Mutex
+	totals  map[MsgKey]*MsgCounter
+	peers   map[discover.NodeID]map[MsgKey]*MsgCounter
+	latency map[MsgKey]*MsgLatency
+}
+
+// MsgStatsSnapshot is a copy of the message statistics.
+type MsgStatsSnapshot struct {
+	Totals  map[MsgKey]MsgCounter
+	Peers   map[discover.NodeID]map[MsgKey]MsgCounter
+	Latency map[MsgKey]MsgLatency
+}
+
+func newMsgStats() *MsgStats {
+	return &MsgStats{
+		totals:  make(map[MsgKey]*MsgCounter),
+		peers:   make(map[discover.NodeID]map[MsgKey]*MsgCounter),
+		latency: make(map[MsgKey]*MsgLatency),
+	}
+}
+
+func (s *MsgStats) record(peer discover.NodeID, key MsgKey, size uint32, latency time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	total, ok := s.totals[key]
+	if !ok {
+		total = new(MsgCounter)
+		s.totals[key] = total
+	}
+	total.Packets++
+	total.Bytes += uint64(size)
+
+	counters, ok := s.peers[peer]
+	if !ok {
+		counters = make(map[MsgKey]*MsgCounter)
+		s.peers[peer] = counters
+	}
+	counter, ok := counters[key]
+	if !ok {
+		counter = new(MsgCounter)
+		counters[key] = counter
+	}
+	counter.Packets++
+	counter.Bytes += uint64(size)
+
+	hist, ok := s.latency[key]
+	if !ok {
+		hist = &MsgLatency{Buckets: make([]uint64, len(LatencyBuckets))}
+		s.latency[key] = hist
+	}
+	seconds := latency.Seconds()
+	for i, bound := range LatencyBuckets {
+		if seconds <= bound {
+			hist.Buckets[i]++
+		}
+	}
+	hist.Count++
+	hist.Sum += seconds
+}
+
+// dropPeer forgets the counters of a disconnected peer, its messages remain
+// in the totals.
+func (s *MsgStats) dropPeer(peer discover.NodeID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.peers, peer)
+}
+
+// Snapshot returns a copy of the statistics.
+func (s *MsgStats) Snapshot() MsgStatsSnapshot {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	snap := MsgStatsSnapshot{
+		Totals:  make(map[MsgKey]MsgCounter, len(s.totals)),
+		Peers:   make(map[discover.NodeID]map[MsgKey]MsgCounter, len(s.peers)),
+		Latency: make(map[MsgKey]MsgLatency, len(s.latency)),
+	}
+	for key, counter := range s.totals {
+		snap.Totals[key] = *counter
+	}
+	for peer, counters := range s.peers {
+		copied := make(map[MsgKey]MsgCounter, len(counters))
+		for key, counter := range counters {
+			copied[key] = *counter
+		}
+		snap.Peers[peer] = copied
+	}
+	for key, hist := range s.latency {
+		snap.Latency[key] = MsgLatency{
+			Buckets: append([]uint64{}, hist.Buckets...),
+			Count:   hist.Count,
+			Sum:     hist.Sum,
+		}
+	}
+	return snap
+}
+
+// MsgStats returns the message statistics of the peers since the server
+// started.
+func (srv *Server) MsgStats() MsgStatsSnapshot {
+	if srv.msgStats == nil {
+		return newMsgStats().Snapshot()
+	}
+	return srv.msgStats.Snapshot()
+}
+
+// msgMeter wraps a MsgReadWriter and records the messages it reads and
+// writes in the message statistics.
+type msgMeter struct {
+	MsgReadWriter
+
+	stats    *MsgStats
+	peerID   discover.NodeID
+	protocol string
+}
+
+func newMsgMeter(rw MsgReadWriter, stats *MsgStats, peerID discover.NodeID, proto string) *msgMeter {
+	return &msgMeter{MsgReadWriter: rw, stats: stats, peerID: peerID, protocol: proto}
+}
+
+func (m *msgMeter) ReadMsg() (Msg, error) {
+	msg, err := m.MsgReadWriter.ReadMsg()
+	if err != nil {
+		return msg, err
+	}
+	m.stats.record(m.peerID, MsgKey{Protocol: m.protocol, Code: msg.Code, Ingress: true}, msg.Size, time.Since(msg.ReceivedAt))
+	return msg, nil
+}
+
+func (m *msgMeter) WriteMsg(msg Msg) error {
+	start := time.Now()
+	if err := m.MsgReadWriter.WriteMsg(msg); err != nil {
+		return err
+	}
+	m.stats.record(m.peerID, MsgKey{Protocol: m.protocol, Code: msg.Code}, msg.Size, time.Since(start))
+	return nil
+}
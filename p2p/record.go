@@ -0,0 +1,70 @@
+package p2p
+
+import (
+	"net"
+
+	"babyboy/p2p/enr"
+)
+
+// initRecord creates the record of the local node with its endpoint and the
+// configured entries, and serves it through discovery.
+func (srv *Server) initRecord(realaddr *net.UDPAddr) error {
+	record := new(enr.Record)
+	record.Set(enr.IP(realaddr.IP))
+	record.Set(enr.UDP(realaddr.Port))
+	record.Set(enr.TCP(realaddr.Port))
+	for _, entry := range srv.ENREntries {
+		record.Set(entry)
+	}
+	if err := enr.SignV4(record, srv.PrivateKey); err != nil {
+		return err
+	}
+
+	srv.recordLock.Lock()
+	srv.record = record
+	srv.recordLock.Unlock()
+
+	if srv.ntab != nil {
+		srv.ntab.SetRecord(record)
+	}
+	return nil
+}
+
+// SetENREntries adds or replaces entries of the local node record. The record
+// is signed again with a higher sequence number.
+func (srv *Server) SetENREntries(entries ...enr.Entry) error {
+	srv.recordLock.Lock()
+	if srv.record == nil {
+		srv.recordLock.Unlock()
+		return errServerStopped
+	}
+	record := *srv.record
+	record.SetSeq(record.Seq() + 1)
+	for _, entry := range entries {
+		record.Set(entry)
+	}
+	if err := enr.SignV4(&record, srv.PrivateKey); err != nil {
+		srv.recordLock.Unlock()
+		return err
+	}
+	srv.record = &record
+	srv.recordLock.Unlock()
+
+	if srv.ntab != nil {
+		srv.ntab.SetRecord(&record)
+	}
+	return nil
+}
+
+// Record returns the signed record of the local node, nil if discovery is
+// disabled or the server is not running.
+func (srv *Server) Record() *enr.Record {
+	srv.recordLock.Lock()
+	defer srv.recordLock.Unlock()
+
+	if srv.record == nil {
+		return nil
+	}
+	record := *srv.record
+	return &record
+}
@@ -7,6 +7,7 @@ import (
 	"babyboy/log"
 	"babyboy/p2p/discover"
 	"babyboy/p2p/discv5"
+	"babyboy/p2p/enr"
 	"babyboy/p2p/nat"
 	"babyboy/p2p/netutil"
 	"crypto/ecdsa"
@@ -14,6 +15,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -83,6 +85,19 @@ type Config struct {
 	// allowed to connect, even above the peer limit.
 	TrustedNodes []*discover.Node
 
+	// Banned nodes are refused at the encryption handshake until their ban
+	// expires.
+	BannedNodes []Ban `toml:"-"`
+
+	// ENREntries are published in the signed record of the local node, next
+	// to its endpoint.
+	ENREntries []enr.Entry `toml:"-"`
+
+	// DialFilter, if set, is called with the record of every node found by
+	// discovery before dialing it. Nodes it rejects, or whose record can't be
+	// fetched, are not dialed. Static nodes are always dialed.
+	DialFilter func(*enr.Record) bool `toml:"-"`
+
 	// Connectivity can be restricted to certain IP networks.
 	// If this option is set to a non-nil value, only hosts which match one of the
 	// IP networks contained in the list are considered.
@@ -151,12 +166,22 @@ type Server struct {
 	quit          chan struct{}
 	addstatic     chan *discover.Node
 	removestatic  chan *discover.Node
+	addtrusted    chan *discover.Node
+	removetrusted chan *discover.Node
 	posthandshake chan *conn
 	addpeer       chan *conn
 	delpeer       chan peerDrop
 	loopWG        sync.WaitGroup // loop, listenLoop
 	peerFeed      event.Feed
 	log           log.Logger
+
+	banLock sync.Mutex // protects bans
+	bans    map[discover.NodeID]Ban
+
+	recordLock sync.Mutex  // protects record
+	record     *enr.Record // signed record of the local node
+
+	msgStats *MsgStats // message counters of all peers
 }
 
 type peerOpFunc func(map[discover.NodeID]*Peer)
@@ -167,7 +192,7 @@ type peerDrop struct {
 	requested bool // true if signaled by the peer
 }
 
-type connFlag int
+type connFlag int32
 
 const (
 	dynDialedConn connFlag = 1 << iota
@@ -181,7 +206,7 @@ const (
 type conn struct {
 	fd net.Conn
 	transport
-	flags connFlag
+	flags connFlag        // Changed while the peer runs, accessed atomically
 	cont  chan error      // The run loop uses cont to signal errors to SetupConn.
 	id    discover.NodeID // valid after the encryption handshake
 	caps  []Cap           // valid after the protocol handshake
@@ -204,7 +229,7 @@ type transport interface {
 }
 
 func (c *conn) String() string {
-	s := c.flags.String()
+	s := c.loadFlags().String()
 	if (c.id != discover.NodeID{}) {
 		s += " " + c.id.String()
 	}
@@ -232,8 +257,29 @@ func (f connFlag) String() string {
 	return s
 }
 
+func (c *conn) loadFlags() connFlag {
+	return connFlag(atomic.LoadInt32((*int32)(&c.flags)))
+}
+
 func (c *conn) is(f connFlag) bool {
-	return c.flags&f != 0
+	return c.loadFlags()&f != 0
+}
+
+// set sets or clears the given flags, the run loop changes the trusted flag
+// while the peer reads it.
+func (c *conn) set(f connFlag, val bool) {
+	for {
+		oldFlags := c.loadFlags()
+		flags := oldFlags
+		if val {
+			flags |= f
+		} else {
+			flags &^= f
+		}
+		if atomic.CompareAndSwapInt32((*int32)(&c.flags), int32(oldFlags), int32(flags)) {
+			return
+		}
+	}
 }
 
 // Peers returns all connected peers.
@@ -283,6 +329,23 @@ func (srv *Server) RemovePeer(node *discover.Node) {
 	}
 }
 
+// AddTrustedPeer adds the given node to a reserved whitelist which allows the
+// node to always connect, even if the slot are full.
+func (srv *Server) AddTrustedPeer(node *discover.Node) {
+	select {
+	case srv.addtrusted <- node:
+	case <-srv.quit:
+	}
+}
+
+// RemoveTrustedPeer removes the given node from the trusted peer set.
+func (srv *Server) RemoveTrustedPeer(node *discover.Node) {
+	select {
+	case srv.removetrusted <- node:
+	case <-srv.quit:
+	}
+}
+
 // SubscribePeers subscribes the given channel to peer events
 func (srv *Server) SubscribeEvents(ch chan *PeerEvent) event.Subscription {
 	return srv.peerFeed.Subscribe(ch)
@@ -393,8 +456,20 @@ func (srv *Server) Start() (err error) {
 	srv.posthandshake = make(chan *conn)
 	srv.addstatic = make(chan *discover.Node)
 	srv.removestatic = make(chan *discover.Node)
+	srv.addtrusted = make(chan *discover.Node)
+	srv.removetrusted = make(chan *discover.Node)
 	srv.peerOp = make(chan peerOpFunc)
 	srv.peerOpDone = make(chan struct{})
+	srv.msgStats = newMsgStats()
+
+	srv.banLock.Lock()
+	if srv.bans == nil {
+		srv.bans = make(map[discover.NodeID]Ban)
+	}
+	for _, ban := range srv.BannedNodes {
+		srv.bans[ban.ID] = ban
+	}
+	srv.banLock.Unlock()
 
 	var (
 		conn      *net.UDPConn
@@ -444,6 +519,9 @@ func (srv *Server) Start() (err error) {
 			return err
 		}
 		srv.ntab = ntab
+		if err := srv.initRecord(realaddr); err != nil {
+			return err
+		}
 	}
 
 	if srv.DiscoveryV5 {
@@ -466,7 +544,7 @@ func (srv *Server) Start() (err error) {
 	}
 
 	dynPeers := srv.maxDialedConns()
-	dialer := newDialState(srv.StaticNodes, srv.BootstrapNodes, srv.ntab, dynPeers, srv.NetRestrict)
+	dialer := newDialState(srv.StaticNodes, srv.BootstrapNodes, srv.ntab, dynPeers, srv.NetRestrict, srv.DialFilter)
 
 	// handshake
 	srv.ourHandshake = &protoHandshake{Version: baseProtocolVersion, Name: srv.Name, ID: discover.PubkeyID(&srv.PrivateKey.PublicKey)}
@@ -529,8 +607,7 @@ func (srv *Server) run(dialstate dialer) {
 		queuedTasks  []task // tasks that can't run yet
 	)
 	// Put trusted nodes into a map to speed up checks.
-	// Trusted peers are loaded on startup and cannot be
-	// modified while the server is running.
+	// Trusted peers are loaded on startup or added via AddTrustedPeer RPC.
 	for _, n := range srv.TrustedNodes {
 		trusted[n.ID] = true
 	}
@@ -588,6 +665,24 @@ running:
 			if p, ok := peers[n.ID]; ok {
 				p.Disconnect(DiscRequested)
 			}
+		case n := <-srv.addtrusted:
+			// This channel is used by AddTrustedPeer to add a node
+			// to the trusted node set.
+			srv.log.Trace("Adding trusted node", "node", n)
+			trusted[n.ID] = true
+			// Mark any already-connected peer as trusted
+			if p, ok := peers[n.ID]; ok {
+				p.rw.set(trustedConn, true)
+			}
+		case n := <-srv.removetrusted:
+			// This channel is used by RemoveTrustedPeer to remove a
+			// node from the trusted node set.
+			srv.log.Trace("Removing trusted node", "node", n)
+			delete(trusted, n.ID)
+			// Unmark any already-connected peer as trusted
+			if p, ok := peers[n.ID]; ok {
+				p.rw.set(trustedConn, false)
+			}
 		case op := <-srv.peerOp:
 			// This channel is used by Peers and PeerCount.
 			op(peers)
@@ -604,7 +699,7 @@ running:
 			// the remote identity is known (but hasn't been verified yet).
 			if trusted[c.id] {
 				// Ensure that the trusted flag is set before checking against MaxPeers.
-				c.flags |= trustedConn
+				c.set(trustedConn, true)
 			}
 			// TODO: track in-progress inbound node IDs (pre-Peer) to avoid dialing them.
 			select {
@@ -624,6 +719,7 @@ running:
 				if srv.EnableMsgEvents {
 					p.events = &srv.peerFeed
 				}
+				p.stats = srv.msgStats
 				name := truncateName(c.name)
 				srv.log.Debug("Adding p2p peer", "name", name, "addr", c.fd.RemoteAddr(), "peers", len(peers)+1)
 				go srv.runPeer(p)
@@ -694,6 +790,8 @@ func (srv *Server) encHandshakeChecks(peers map[discover.NodeID]*Peer, inboundCo
 		return DiscAlreadyConnected
 	case c.id == srv.Self().ID:
 		return DiscSelf
+	case srv.isBanned(c.id):
+		return DiscUselessPeer
 	default:
 		return nil
 	}
@@ -875,6 +973,7 @@ func (srv *Server) runPeer(p *Peer) {
 
 	// run the protocol
 	remoteRequested, err := p.run()
+	srv.msgStats.dropPeer(p.ID())
 
 	// broadcast peer drop
 	srv.peerFeed.Send(&PeerEvent{
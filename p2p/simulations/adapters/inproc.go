@@ -20,6 +20,7 @@ import (
 // connects them using net.Pipe
 type SimAdapter struct {
 	pipe     func() (net.Conn, net.Conn, error)
+	links    *pipes.Links // faults of the connections, nil for perfect pipes
 	mtx      sync.RWMutex
 	nodes    map[discover.NodeID]*SimNode
 	services map[string]ServiceFunc
@@ -45,6 +46,37 @@ func NewTCPAdapter(services map[string]ServiceFunc) *SimAdapter {
 	}
 }
 
+// FaultySimAdapter is a SimAdapter whose connections suffer the latency,
+// jitter, bandwidth caps, loss and one-way partitions set with SetFaults
+type FaultySimAdapter struct {
+	*SimAdapter
+}
+
+// NewFaultySimAdapter creates a FaultySimAdapter using a net.Pipe for the
+// connections. The random faults derive from seed, so that a simulation can
+// be replayed with the same faults.
+func NewFaultySimAdapter(services map[string]ServiceFunc, seed int64) *FaultySimAdapter {
+	adapter := NewSimAdapter(services)
+	adapter.links = pipes.NewLinks(seed)
+	return &FaultySimAdapter{adapter}
+}
+
+// SetFaults sets the faults of the data one node sends to the other, on the
+// current and future connections between them
+func (s *FaultySimAdapter) SetFaults(one, other discover.NodeID, faults pipes.Faults) {
+	s.links.Link(one.String(), other.String()).SetFaults(faults)
+}
+
+// Faults returns the faults of the data one node sends to the other
+func (s *FaultySimAdapter) Faults(one, other discover.NodeID) pipes.Faults {
+	return s.links.Link(one.String(), other.String()).Faults()
+}
+
+// FaultSeed returns the seed the random faults derive from
+func (s *FaultySimAdapter) FaultSeed() int64 {
+	return s.links.Seed()
+}
+
 // Name returns the name of the adapter for logging purposes
 func (s *SimAdapter) Name() string {
 	return "sim-adapter"
@@ -76,7 +108,7 @@ func (s *SimAdapter) NewNode(config *NodeConfig) (Node, error) {
 			PrivateKey:      config.PrivateKey,
 			MaxPeers:        math.MaxInt32,
 			NoDiscovery:     true,
-			Dialer:          s,
+			Dialer:          &simDialer{adapter: s, id: id},
 			EnableMsgEvents: config.EnableMsgEvents,
 		},
 		NoUSB:  true,
@@ -100,6 +132,23 @@ func (s *SimAdapter) NewNode(config *NodeConfig) (Node, error) {
 // Dial implements the p2p.NodeDialer interface by connecting to the node using
 // an in-memory net.Pipe
 func (s *SimAdapter) Dial(dest *discover.Node) (conn net.Conn, err error) {
+	return s.dial(discover.NodeID{}, dest)
+}
+
+// simDialer is the p2p.NodeDialer of a node, it dials through the adapter
+// with the faults of the links from and to the node
+type simDialer struct {
+	adapter *SimAdapter
+	id      discover.NodeID
+}
+
+func (d *simDialer) Dial(dest *discover.Node) (net.Conn, error) {
+	return d.adapter.dial(d.id, dest)
+}
+
+// dial connects the node src to dest, src is the zero ID when unknown, in
+// which case the connection suffers no faults
+func (s *SimAdapter) dial(src discover.NodeID, dest *discover.Node) (conn net.Conn, err error) {
 	node, ok := s.GetNode(dest.ID)
 	if !ok {
 		return nil, fmt.Errorf("unknown node: %s", dest.ID)
@@ -109,7 +158,12 @@ func (s *SimAdapter) Dial(dest *discover.Node) (conn net.Conn, err error) {
 		return nil, fmt.Errorf("node not running: %s", dest.ID)
 	}
 	// SimAdapter.pipe is net.Pipe (NewSimAdapter)
-	pipe1, pipe2, err := s.pipe()
+	var pipe1, pipe2 net.Conn
+	if s.links != nil && src != (discover.NodeID{}) {
+		pipe1, pipe2, err = s.links.Pipe(s.pipe, src.String(), dest.ID.String())
+	} else {
+		pipe1, pipe2, err = s.pipe()
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -13,6 +13,7 @@ import (
 	"babyboy/node"
 	"babyboy/p2p"
 	"babyboy/p2p/discover"
+	"babyboy/p2p/simulations/pipes"
 	"babyboy/rpc"
 	"github.com/docker/docker/pkg/reexec"
 )
@@ -57,6 +58,19 @@ type NodeAdapter interface {
 	NewNode(config *NodeConfig) (Node, error)
 }
 
+// FaultInjector is implemented by NodeAdapters which can impair the
+// connections between their nodes, e.g. FaultySimAdapter
+type FaultInjector interface {
+	// SetFaults sets the faults of the data one node sends to the other
+	SetFaults(one, other discover.NodeID, faults pipes.Faults)
+
+	// Faults returns the faults of the data one node sends to the other
+	Faults(one, other discover.NodeID) pipes.Faults
+
+	// FaultSeed returns the seed the random faults derive from
+	FaultSeed() int64
+}
+
 // NodeConfig is the configuration used to start a node in a simulation
 // network
 type NodeConfig struct {
@@ -0,0 +1,291 @@
+package simulations
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"sync"
+	"time"
+
+	"babyboy/common"
+	"babyboy/core"
+	"babyboy/crypto"
+	"babyboy/node"
+	"babyboy/p2p"
+	"babyboy/p2p/discover"
+	"babyboy/p2p/simulations/adapters"
+	"babyboy/rpc"
+)
+
+// DagServiceName is the name of the service running a DAG node.
+const DagServiceName = "dag"
+
+const (
+	dagPassword         = "simulation" // Password of the pre-funded accounts in the keystores of the nodes
+	dagConvergenceCheck = 500 * time.Millisecond
+)
+
+// DagNetwork is a developer network of DAG nodes for the simulations. The
+// witness keys are spread over the first WitnessNodes nodes started, every
+// node gets one of the pre-funded accounts.
+//
+// The DAG node of a simulation node outlives the service: a node that is
+// stopped and started again goes on with the DAG it had, and its witnesses
+// post no units while it is down.
+type DagNetwork struct {
+	Genesis      *core.Genesis
+	Witnesses    []*ecdsa.PrivateKey
+	Accounts     []*ecdsa.PrivateKey
+	WitnessNodes int
+	Period       time.Duration // Interval between two witness rounds
+
+	lock    sync.Mutex
+	members map[discover.NodeID]*dagMember
+}
+
+type dagMember struct {
+	node      *node.Node
+	witnesses []common.Address
+	account   common.Address
+}
+
+// NewDagNetwork creates a developer network with fresh witness keys, spread
+// over witnessNodes nodes, and the given number of pre-funded accounts.
+func NewDagNetwork(witnessNodes, accounts int, period time.Duration) (*DagNetwork, error) {
+	dn := &DagNetwork{
+		WitnessNodes: witnessNodes,
+		Period:       period,
+		members:      make(map[discover.NodeID]*dagMember),
+	}
+	var witnessAddrs, accountAddrs []common.Address
+	for i := 0; i < len(core.DefaultGenesis().Witnesses); i++ {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		dn.Witnesses = append(dn.Witnesses, key)
+		witnessAddrs = append(witnessAddrs, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	for i := 0; i < accounts; i++ {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		dn.Accounts = append(dn.Accounts, key)
+		accountAddrs = append(accountAddrs, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	dn.Genesis = core.DeveloperGenesis(witnessAddrs, accountAddrs)
+	return dn, nil
+}
+
+// Services returns the services to create the node adapter with, the DAG
+// nodes run as DagServiceName.
+func (dn *DagNetwork) Services() adapters.Services {
+	return adapters.Services{DagServiceName: dn.newService}
+}
+
+func (dn *DagNetwork) newService(ctx *adapters.ServiceContext) (node.Service, error) {
+	dn.lock.Lock()
+	defer dn.lock.Unlock()
+
+	member, ok := dn.members[ctx.Config.ID]
+	if !ok {
+		var err error
+		if member, err = dn.newMember(len(dn.members)); err != nil {
+			return nil, err
+		}
+		dn.members[ctx.Config.ID] = member
+	}
+	return &dagService{member: member}, nil
+}
+
+// newMember creates the DAG node of the index-th node started.
+func (dn *DagNetwork) newMember(index int) (*dagMember, error) {
+	member := new(dagMember)
+	dev := &node.DevConfig{Password: dagPassword, Period: dn.Period}
+	if index < dn.WitnessNodes {
+		for i := index; i < len(dn.Witnesses); i += dn.WitnessNodes {
+			dev.WitnessKeys = append(dev.WitnessKeys, dn.Witnesses[i])
+			member.witnesses = append(member.witnesses, crypto.PubkeyToAddress(dn.Witnesses[i].PublicKey))
+		}
+	}
+	if len(dn.Accounts) > 0 {
+		key := dn.Accounts[index%len(dn.Accounts)]
+		dev.Accounts = []*ecdsa.PrivateKey{key}
+		member.account = crypto.PubkeyToAddress(key.PublicKey)
+	}
+	n, err := node.New(&node.Config{
+		Genesis:   dn.Genesis,
+		Dev:       dev,
+		Ephemeral: true,
+		Roles:     []string{},
+	})
+	if err != nil {
+		return nil, err
+	}
+	member.node = n
+	return member, nil
+}
+
+// dagService runs a DAG node on a simulation node.
+type dagService struct {
+	member *dagMember
+}
+
+func (s *dagService) Protocols() []p2p.Protocol {
+	return s.member.node.Protocols()
+}
+
+func (s *dagService) APIs() []rpc.API {
+	return append(s.member.node.APIs(), rpc.API{
+		Namespace: "dagsim",
+		Version:   "1.0",
+		Service:   &DagSimAPI{member: s.member},
+		Public:    true,
+	})
+}
+
+func (s *dagService) Start(server *p2p.Server) error {
+	return s.member.node.Attach(server)
+}
+
+func (s *dagService) Stop() error {
+	s.member.node.Detach()
+	return nil
+}
+
+// DagState is the view of a node on the DAG that the convergence checks
+// compare.
+type DagState struct {
+	LastStableBall common.Hash `json:"lastStableBall"`
+	LastStableMCI  uint64      `json:"lastStableMCI"`
+	Unspent        int         `json:"unspent"`
+	UnspentDigest  common.Hash `json:"unspentDigest"`
+}
+
+// DagSimAPI is the dagsim RPC API the mockers and checks drive the DAG nodes
+// with.
+type DagSimAPI struct {
+	member *dagMember
+}
+
+// State returns the last stable ball and the stable UTXO set of the node.
+func (api *DagSimAPI) State() (*DagState, error) {
+	n := api.member.node
+	count, digest, err := n.UnspentDigest()
+	if err != nil {
+		return nil, err
+	}
+	return &DagState{
+		LastStableBall: n.LastStableBall(),
+		LastStableMCI:  n.LastStableMCI(),
+		Unspent:        count,
+		UnspentDigest:  digest,
+	}, nil
+}
+
+// StableState returns the last stable ball and the stable UTXO set the node had
+// right after the given main chain index became stable.
+func (api *DagSimAPI) StableState(mci uint64) (*DagState, error) {
+	state, ok := api.member.node.StableState(mci)
+	if !ok {
+		return nil, fmt.Errorf("no stable state at MCI %d", mci)
+	}
+	return &DagState{
+		LastStableBall: state.Ball,
+		LastStableMCI:  state.MCI,
+		Unspent:        state.Unspent,
+		UnspentDigest:  state.UnspentDigest,
+	}, nil
+}
+
+// Witnesses returns the witnesses whose units the node posts.
+func (api *DagSimAPI) Witnesses() []common.Address {
+	return api.member.witnesses
+}
+
+// Account returns the pre-funded account of the node.
+func (api *DagSimAPI) Account() common.Address {
+	return api.member.account
+}
+
+// Pay sends amount from the account of the node to the given address.
+func (api *DagSimAPI) Pay(to common.Address, amount int) (common.Hash, error) {
+	return api.member.node.NewJoint(api.member.account.Hex(), dagPassword, to.Hex(), amount)
+}
+
+// dagState fetches the current DAG state of a node through the dagsim API.
+func dagState(net *Network, id discover.NodeID) (*DagState, error) {
+	state := new(DagState)
+	if err := dagCall(net, id, state, "dagsim_state"); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// dagStableState fetches the DAG state of a node right after the given main
+// chain index became stable.
+func dagStableState(net *Network, id discover.NodeID, mci uint64) (*DagState, error) {
+	state := new(DagState)
+	if err := dagCall(net, id, state, "dagsim_stableState", mci); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// CheckDagConvergence returns an error unless all the given nodes had the same
+// last stable ball and the same stable UTXO set at the highest main chain index
+// they all made stable. The witnesses keep posting units while the nodes are
+// queried, so they are compared at that fixed index and not at their last one.
+func CheckDagConvergence(net *Network, ids []discover.NodeID) error {
+	var mci uint64
+	for i, id := range ids {
+		state, err := dagState(net, id)
+		if err != nil {
+			return err
+		}
+		if i == 0 || state.LastStableMCI < mci {
+			mci = state.LastStableMCI
+		}
+	}
+	var (
+		first   *DagState
+		firstID discover.NodeID
+	)
+	for _, id := range ids {
+		state, err := dagStableState(net, id, mci)
+		if err != nil {
+			return err
+		}
+		if first == nil {
+			first, firstID = state, id
+			continue
+		}
+		if state.LastStableBall != first.LastStableBall {
+			return fmt.Errorf("stable ball of %s at MCI %d is %s, %s has %s", id.TerminalString(), mci, state.LastStableBall.String(), firstID.TerminalString(), first.LastStableBall.String())
+		}
+		if state.UnspentDigest != first.UnspentDigest {
+			return fmt.Errorf("UTXO set of %s at MCI %d (%d outputs) differs from the one of %s (%d outputs)", id.TerminalString(), mci, state.Unspent, firstID.TerminalString(), first.Unspent)
+		}
+	}
+	return nil
+}
+
+// WaitDagConvergence checks the convergence of the nodes until it holds or
+// the context is done, in which case the last divergence found is returned.
+func WaitDagConvergence(ctx context.Context, net *Network, ids []discover.NodeID) error {
+	ticker := time.NewTicker(dagConvergenceCheck)
+	defer ticker.Stop()
+
+	for {
+		err := CheckDagConvergence(net, ids)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("nodes did not converge: %v", err)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package simulations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"babyboy/common"
+	"babyboy/log"
+	"babyboy/p2p/discover"
+)
+
+// The DAG mockers expect the network to run DagServiceName as default service.
+const (
+	dagOutage          = 20 * time.Second      // How long partitions and witness outages last
+	dagConvergeTimeout = time.Minute           // Time the nodes get to converge once the network is healed
+	dagPaymentInterval = 50 * time.Millisecond // Interval between two payments of the payment mocker
+	dagPaymentCheck    = 30 * time.Second      // Interval between two convergence checks of the payment mocker
+	dagPaymentAmount   = 1000
+)
+
+// errMockerStopped is returned by the DAG mockers when they are stopped.
+var errMockerStopped = errors.New("mocker stopped")
+
+// The dagPartition mockerFn splits the ring of DAG nodes in two, heals the
+// partition after a while and checks that the nodes converge
+func dagPartition(net *Network, quit chan struct{}, nodeCount int) {
+	if nodeCount < 2 {
+		log.Error("partitions need at least two nodes")
+		return
+	}
+	nodes, err := connectNodesInRing(net, nodeCount)
+	if err != nil {
+		panic("Could not startup node network for mocker")
+	}
+	endDagMocker(runDagPartitions(net, quit, nodes))
+}
+
+// runDagPartitions partitions and heals the network until the nodes diverge or
+// the mocker is stopped.
+func runDagPartitions(net *Network, quit chan struct{}, nodes []discover.NodeID) error {
+	for {
+		half := 1 + rand.Intn(len(nodes)-1)
+		cut := disconnectGroups(net, nodes[:half], nodes[half:])
+		log.Info("partitioned DAG network", "sizes", []int{half, len(nodes) - half}, "conns", len(cut))
+		if !waitOrQuit(quit, dagOutage) {
+			return errMockerStopped
+		}
+		log.Info("healing DAG network partition")
+		reconnect(net, cut)
+		if err := checkConvergence(net, quit, nodes); err != nil {
+			return err
+		}
+	}
+}
+
+// The dagWitnessOffline mockerFn stops a node posting witness units for a while,
+// starts it again and checks that the nodes converge
+func dagWitnessOffline(net *Network, quit chan struct{}, nodeCount int) {
+	nodes, err := connectNodesInRing(net, nodeCount)
+	if err != nil {
+		panic("Could not startup node network for mocker")
+	}
+	endDagMocker(runDagWitnessOutages(net, quit, nodes))
+}
+
+// runDagWitnessOutages stops and starts witness nodes until the nodes diverge
+// or the mocker is stopped.
+func runDagWitnessOutages(net *Network, quit chan struct{}, nodes []discover.NodeID) error {
+	var witnesses []discover.NodeID
+	for _, id := range nodes {
+		var addrs []common.Address
+		if err := dagCall(net, id, &addrs, "dagsim_witnesses"); err != nil {
+			return fmt.Errorf("error getting the witnesses of %s: %v", id.TerminalString(), err)
+		}
+		if len(addrs) > 0 {
+			witnesses = append(witnesses, id)
+		}
+	}
+	if len(witnesses) == 0 {
+		return errors.New("no node posts witness units")
+	}
+	for {
+		if !waitOrQuit(quit, dagOutage) {
+			return errMockerStopped
+		}
+		id := witnesses[rand.Intn(len(witnesses))]
+		conns := nodeConns(net, id)
+		log.Info("stopping witness node", "id", id)
+		if err := net.Stop(id); err != nil {
+			return fmt.Errorf("error stopping %s: %v", id.TerminalString(), err)
+		}
+		if !waitOrQuit(quit, dagOutage) {
+			return errMockerStopped
+		}
+		log.Info("starting witness node", "id", id)
+		if err := net.Start(id); err != nil {
+			return fmt.Errorf("error starting %s: %v", id.TerminalString(), err)
+		}
+		reconnect(net, conns)
+		if err := checkConvergence(net, quit, nodes); err != nil {
+			return err
+		}
+	}
+}
+
+// The dagPayments mockerFn sends payments between the accounts of random nodes
+// at a high rate and checks from time to time that the nodes converge
+func dagPayments(net *Network, quit chan struct{}, nodeCount int) {
+	nodes, err := connectNodesInRing(net, nodeCount)
+	if err != nil {
+		panic("Could not startup node network for mocker")
+	}
+	endDagMocker(runDagPayments(net, quit, nodes))
+}
+
+// runDagPayments sends payments until the nodes diverge or the mocker is
+// stopped.
+func runDagPayments(net *Network, quit chan struct{}, nodes []discover.NodeID) error {
+	accounts := make([]common.Address, len(nodes))
+	for i, id := range nodes {
+		if err := dagCall(net, id, &accounts[i], "dagsim_account"); err != nil {
+			return fmt.Errorf("error getting the account of %s: %v", id.TerminalString(), err)
+		}
+	}
+	pay := time.NewTicker(dagPaymentInterval)
+	defer pay.Stop()
+	check := time.NewTicker(dagPaymentCheck)
+	defer check.Stop()
+	for {
+		select {
+		case <-quit:
+			return errMockerStopped
+		case <-pay.C:
+			from := nodes[rand.Intn(len(nodes))]
+			to := accounts[rand.Intn(len(accounts))]
+			// Payments fail while the outputs of the account are pending
+			var hash common.Hash
+			if err := dagCall(net, from, &hash, "dagsim_pay", to, dagPaymentAmount); err != nil {
+				log.Debug("payment failed", "from", from, "to", to, "err", err)
+			}
+		case <-check.C:
+			if err := checkConvergence(net, quit, nodes); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// endDagMocker logs why a DAG mocker ended.
+func endDagMocker(err error) {
+	if err == errMockerStopped {
+		log.Info("Terminating simulation loop")
+		return
+	}
+	log.Error("DAG mocker failed", "err", err)
+}
+
+// dagCall calls a method of the RPC API of a node.
+func dagCall(net *Network, id discover.NodeID, result interface{}, method string, args ...interface{}) error {
+	node := net.GetNode(id)
+	if node == nil {
+		return fmt.Errorf("unknown node: %s", id)
+	}
+	client, err := node.Client()
+	if err != nil {
+		return err
+	}
+	return client.Call(result, method, args...)
+}
+
+// checkConvergence waits for the nodes to converge. It returns errMockerStopped
+// if the mocker was stopped meanwhile.
+func checkConvergence(net *Network, quit chan struct{}, nodes []discover.NodeID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dagConvergeTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	err := WaitDagConvergence(ctx, net, nodes)
+	select {
+	case <-quit:
+		return errMockerStopped
+	default:
+	}
+	if err != nil {
+		return err
+	}
+	log.Info("DAG nodes converged")
+	return nil
+}
+
+// disconnectGroups drops the connections between two groups of nodes and
+// returns them.
+func disconnectGroups(net *Network, one, other []discover.NodeID) []*Conn {
+	var cut []*Conn
+	for _, a := range one {
+		for _, b := range other {
+			conn := net.GetConn(a, b)
+			if conn == nil || !conn.Up {
+				continue
+			}
+			if err := net.Disconnect(conn.One, conn.Other); err != nil {
+				log.Error("error disconnecting nodes", "one", conn.One, "other", conn.Other, "err", err)
+				continue
+			}
+			cut = append(cut, conn)
+		}
+	}
+	return cut
+}
+
+// nodeConns returns the connections of a node that are up.
+func nodeConns(net *Network, id discover.NodeID) []*Conn {
+	net.lock.RLock()
+	defer net.lock.RUnlock()
+
+	var conns []*Conn
+	for _, conn := range net.Conns {
+		if conn.Up && (conn.One == id || conn.Other == id) {
+			conns = append(conns, conn)
+		}
+	}
+	return conns
+}
+
+// reconnect connects the nodes of the given connections again.
+func reconnect(net *Network, conns []*Conn) {
+	for _, conn := range conns {
+		if err := net.Connect(conn.One, conn.Other); err != nil {
+			log.Error("error connecting nodes", "one", conn.One, "other", conn.Other, "err", err)
+		}
+	}
+}
+
+// waitOrQuit waits for the given duration, it returns false if the mocker was
+// stopped meanwhile.
+func waitOrQuit(quit chan struct{}, d time.Duration) bool {
+	select {
+	case <-quit:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
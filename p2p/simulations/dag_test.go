@@ -0,0 +1,83 @@
+package simulations
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"babyboy/common"
+	"babyboy/p2p/discover"
+	"babyboy/p2p/simulations/adapters"
+)
+
+func newTestDagNetwork(services adapters.Services) *Network {
+	adapter := adapters.NewSimAdapter(services)
+	return NewNetwork(adapter, &NetworkConfig{DefaultService: DagServiceName})
+}
+
+func startTestDagNode(t *testing.T, net *Network, service string) discover.NodeID {
+	conf := adapters.RandomNodeConfig()
+	conf.Services = []string{service}
+	node, err := net.NewNodeWithConfig(conf)
+	if err != nil {
+		t.Fatalf("error creating node: %v", err)
+	}
+	if err := net.Start(node.ID()); err != nil {
+		t.Fatalf("error starting node: %v", err)
+	}
+	return node.ID()
+}
+
+func TestDagConvergence(t *testing.T) {
+	dagNet, err := NewDagNetwork(2, 3, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("error creating DAG network: %v", err)
+	}
+	net := newTestDagNetwork(dagNet.Services())
+	defer net.Shutdown()
+
+	nodes, err := connectNodesInRing(net, 3)
+	if err != nil {
+		t.Fatalf("error connecting nodes: %v", err)
+	}
+	for i, id := range nodes {
+		var account common.Address
+		if err := dagCall(net, id, &account, "dagsim_account"); err != nil {
+			t.Fatalf("error getting the account of node %d: %v", i, err)
+		}
+		var hash common.Hash
+		if err := dagCall(net, nodes[(i+1)%len(nodes)], &hash, "dagsim_pay", account, dagPaymentAmount); err != nil {
+			t.Fatalf("error paying node %d: %v", i, err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dagConvergeTimeout)
+	defer cancel()
+	if err := WaitDagConvergence(ctx, net, nodes); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDagDivergence(t *testing.T) {
+	one, err := NewDagNetwork(1, 1, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("error creating DAG network: %v", err)
+	}
+	other, err := NewDagNetwork(1, 1, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("error creating DAG network: %v", err)
+	}
+	// The nodes run DAGs with different genesis units, they never agree
+	net := newTestDagNetwork(adapters.Services{
+		DagServiceName: one.newService,
+		"other":        other.newService,
+	})
+	defer net.Shutdown()
+
+	nodes := []discover.NodeID{
+		startTestDagNode(t, net, DagServiceName),
+		startTestDagNode(t, net, "other"),
+	}
+	if err := CheckDagConvergence(net, nodes); err == nil {
+		t.Fatal("nodes with different genesis units converged")
+	}
+}
@@ -0,0 +1,99 @@
+package simulations
+
+import (
+	"errors"
+
+	"babyboy/log"
+	"babyboy/p2p/discover"
+	"babyboy/p2p/simulations/adapters"
+	"babyboy/p2p/simulations/pipes"
+)
+
+// ErrNoFaultInjection is returned when the node adapter of the network can't
+// impair the connections between the nodes
+var ErrNoFaultInjection = errors.New("node adapter does not support fault injection")
+
+// ConnFaults are the faults of both directions of a connection
+type ConnFaults struct {
+	One      discover.NodeID `json:"one"`
+	Other    discover.NodeID `json:"other"`
+	Outbound pipes.Faults    `json:"outbound"` // Faults of the data One sends to Other
+	Inbound  pipes.Faults    `json:"inbound"`  // Faults of the data Other sends to One
+}
+
+// FaultsUpdate changes the faults of a connection, a direction left nil keeps
+// its faults
+type FaultsUpdate struct {
+	Outbound *pipes.Faults `json:"outbound,omitempty"`
+	Inbound  *pipes.Faults `json:"inbound,omitempty"`
+}
+
+// NetworkFaults are the faults of the connections of the network and the
+// seed their random faults derive from
+type NetworkFaults struct {
+	Seed  int64         `json:"seed"`
+	Conns []*ConnFaults `json:"conns"`
+}
+
+func (net *Network) faultInjector() (adapters.FaultInjector, error) {
+	injector, ok := net.nodeAdapter.(adapters.FaultInjector)
+	if !ok {
+		return nil, ErrNoFaultInjection
+	}
+	return injector, nil
+}
+
+// GetFaults returns the faults of all connections of the network
+func (net *Network) GetFaults() (*NetworkFaults, error) {
+	injector, err := net.faultInjector()
+	if err != nil {
+		return nil, err
+	}
+	net.lock.RLock()
+	conns := make([]*Conn, len(net.Conns))
+	copy(conns, net.Conns)
+	net.lock.RUnlock()
+
+	faults := &NetworkFaults{Seed: injector.FaultSeed(), Conns: make([]*ConnFaults, len(conns))}
+	for i, conn := range conns {
+		faults.Conns[i] = connFaults(injector, conn.One, conn.Other)
+	}
+	return faults, nil
+}
+
+// GetConnFaults returns the faults of the connection between two nodes, the
+// nodes need not be connected
+func (net *Network) GetConnFaults(oneID, otherID discover.NodeID) (*ConnFaults, error) {
+	injector, err := net.faultInjector()
+	if err != nil {
+		return nil, err
+	}
+	return connFaults(injector, oneID, otherID), nil
+}
+
+// SetConnFaults changes the faults of the connection between two nodes, they
+// apply to the current connection and the ones made later
+func (net *Network) SetConnFaults(oneID, otherID discover.NodeID, update *FaultsUpdate) (*ConnFaults, error) {
+	injector, err := net.faultInjector()
+	if err != nil {
+		return nil, err
+	}
+	if update.Outbound != nil {
+		log.Info("setting connection faults", "from", oneID.TerminalString(), "to", otherID.TerminalString(), "faults", *update.Outbound)
+		injector.SetFaults(oneID, otherID, *update.Outbound)
+	}
+	if update.Inbound != nil {
+		log.Info("setting connection faults", "from", otherID.TerminalString(), "to", oneID.TerminalString(), "faults", *update.Inbound)
+		injector.SetFaults(otherID, oneID, *update.Inbound)
+	}
+	return connFaults(injector, oneID, otherID), nil
+}
+
+func connFaults(injector adapters.FaultInjector, oneID, otherID discover.NodeID) *ConnFaults {
+	return &ConnFaults{
+		One:      oneID,
+		Other:    otherID,
+		Outbound: injector.Faults(oneID, otherID),
+		Inbound:  injector.Faults(otherID, oneID),
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"babyboy/p2p"
 	"babyboy/p2p/discover"
 	"babyboy/p2p/simulations/adapters"
+	"babyboy/p2p/simulations/pipes"
 	"babyboy/rpc"
 	"github.com/julienschmidt/httprouter"
 	"golang.org/x/net/websocket"
@@ -189,6 +190,29 @@ func (c *Client) DisconnectNode(nodeID, peerID string) error {
 	return c.Delete(fmt.Sprintf("/nodes/%s/conn/%s", nodeID, peerID))
 }
 
+// GetFaults returns the faults of all connections of the network
+func (c *Client) GetFaults() (*NetworkFaults, error) {
+	faults := &NetworkFaults{}
+	return faults, c.Get("/connections", faults)
+}
+
+// GetConnFaults returns the faults of the connection between two nodes
+func (c *Client) GetConnFaults(nodeID, peerID string) (*ConnFaults, error) {
+	faults := &ConnFaults{}
+	return faults, c.Get(fmt.Sprintf("/connections/%s/%s", nodeID, peerID), faults)
+}
+
+// SetConnFaults changes the faults of the connection between two nodes
+func (c *Client) SetConnFaults(nodeID, peerID string, update *FaultsUpdate) (*ConnFaults, error) {
+	faults := &ConnFaults{}
+	return faults, c.Post(fmt.Sprintf("/connections/%s/%s", nodeID, peerID), update, faults)
+}
+
+// ClearConnFaults removes the faults of the connection between two nodes
+func (c *Client) ClearConnFaults(nodeID, peerID string) error {
+	return c.Delete(fmt.Sprintf("/connections/%s/%s", nodeID, peerID))
+}
+
 // RPCClient returns an RPC client connected to a node
 func (c *Client) RPCClient(ctx context.Context, nodeID string) (*rpc.Client, error) {
 	baseURL := strings.Replace(c.URL, "http", "ws", 1)
@@ -280,6 +304,10 @@ func NewServer(network *Network) *Server {
 	s.POST("/nodes/:nodeid/conn/:peerid", s.ConnectNode)
 	s.DELETE("/nodes/:nodeid/conn/:peerid", s.DisconnectNode)
 	s.GET("/nodes/:nodeid/rpc", s.NodeRPC)
+	s.GET("/connections", s.GetFaults)
+	s.GET("/connections/:nodeid/:peerid", s.GetConnFaults)
+	s.POST("/connections/:nodeid/:peerid", s.SetConnFaults)
+	s.DELETE("/connections/:nodeid/:peerid", s.ClearConnFaults)
 
 	return s
 }
@@ -631,6 +659,76 @@ func (s *Server) DisconnectNode(w http.ResponseWriter, req *http.Request) {
 	s.JSON(w, http.StatusOK, node.NodeInfo())
 }
 
+// GetFaults returns the faults of all connections of the network
+func (s *Server) GetFaults(w http.ResponseWriter, req *http.Request) {
+	faults, err := s.network.GetFaults()
+	if err != nil {
+		http.Error(w, err.Error(), faultsStatus(err))
+		return
+	}
+
+	s.JSON(w, http.StatusOK, faults)
+}
+
+// GetConnFaults returns the faults of the connection between a node and a
+// peer node
+func (s *Server) GetConnFaults(w http.ResponseWriter, req *http.Request) {
+	node := req.Context().Value("node").(*Node)
+	peer := req.Context().Value("peer").(*Node)
+
+	faults, err := s.network.GetConnFaults(node.ID(), peer.ID())
+	if err != nil {
+		http.Error(w, err.Error(), faultsStatus(err))
+		return
+	}
+
+	s.JSON(w, http.StatusOK, faults)
+}
+
+// SetConnFaults changes the faults of the connection between a node and a
+// peer node
+func (s *Server) SetConnFaults(w http.ResponseWriter, req *http.Request) {
+	node := req.Context().Value("node").(*Node)
+	peer := req.Context().Value("peer").(*Node)
+
+	update := &FaultsUpdate{}
+	if err := json.NewDecoder(req.Body).Decode(update); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	faults, err := s.network.SetConnFaults(node.ID(), peer.ID(), update)
+	if err != nil {
+		http.Error(w, err.Error(), faultsStatus(err))
+		return
+	}
+
+	s.JSON(w, http.StatusOK, faults)
+}
+
+// ClearConnFaults removes the faults of the connection between a node and a
+// peer node
+func (s *Server) ClearConnFaults(w http.ResponseWriter, req *http.Request) {
+	node := req.Context().Value("node").(*Node)
+	peer := req.Context().Value("peer").(*Node)
+
+	none := &FaultsUpdate{Outbound: &pipes.Faults{}, Inbound: &pipes.Faults{}}
+	faults, err := s.network.SetConnFaults(node.ID(), peer.ID(), none)
+	if err != nil {
+		http.Error(w, err.Error(), faultsStatus(err))
+		return
+	}
+
+	s.JSON(w, http.StatusOK, faults)
+}
+
+// faultsStatus returns the HTTP status of an error of the fault injection
+func faultsStatus(err error) int {
+	if err == ErrNoFaultInjection {
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
+
 // Options responds to the OPTIONS HTTP method by returning a 200 OK response
 // with the "Access-Control-Allow-Headers" header set to "Content-Type"
 func (s *Server) Options(w http.ResponseWriter, req *http.Request) {
@@ -13,9 +13,12 @@ import (
 
 //a map of mocker names to its function
 var mockerList = map[string]func(net *Network, quit chan struct{}, nodeCount int){
-	"startStop":     startStop,
-	"probabilistic": probabilistic,
-	"boot":          boot,
+	"startStop":         startStop,
+	"probabilistic":     probabilistic,
+	"boot":              boot,
+	"dagPartition":      dagPartition,
+	"dagWitnessOffline": dagWitnessOffline,
+	"dagPayments":       dagPayments,
 }
 
 //Lookup a mocker by its name, returns the mockerFn
@@ -0,0 +1,348 @@
+package pipes
+
+import (
+	"hash/fnv"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// retransmitTimeout is the extra delay of a lost write: the connections are
+	// reliable streams, so lost data arrives once retransmitted, like over TCP
+	retransmitTimeout = 200 * time.Millisecond
+
+	// maxQueued is the number of bytes a connection holds before its writes
+	// block until the data is delivered
+	maxQueued = 1024 * 1024
+)
+
+// Clock is the time deliveries are scheduled in. A simulation running on
+// simulated time suffers the same faults whenever it writes the same data.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the Clock of the wall time
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Faults are the impairments of the data sent in one direction of a
+// connection
+type Faults struct {
+	Latency   time.Duration `json:"latency"`   // Delay of every write
+	Jitter    time.Duration `json:"jitter"`    // Maximum random deviation from Latency
+	Bandwidth int           `json:"bandwidth"` // Bytes per second, 0 for no cap
+	Loss      float64       `json:"loss"`      // Probability that a write is lost and retransmitted
+	Blocked   bool          `json:"blocked"`   // Holds back all data, for one-way partitions
+}
+
+// Link is one direction between two endpoints, its faults apply to every
+// connection between them, including the ones made after they were set
+type Link struct {
+	lock    sync.Mutex
+	faults  Faults
+	seed    uint64
+	seq     uint64 // number of writes scheduled, the random faults of a write derive from it
+	clock   Clock
+	changed chan struct{} // closed when the faults change
+}
+
+func newLink(seed int64, clock Clock) *Link {
+	return &Link{
+		seed:    uint64(seed),
+		clock:   clock,
+		changed: make(chan struct{}),
+	}
+}
+
+// Faults returns the faults of the link
+func (l *Link) Faults() Faults {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.faults
+}
+
+// SetFaults sets the faults of the link, they apply to the data written from
+// now on, and held back data is released if the link is no longer blocked
+func (l *Link) SetFaults(faults Faults) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.faults = faults
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// random returns the i-th random number of the write with the given sequence
+// number, the same for every run with the same seed
+func (l *Link) random(seq uint64, i uint64) uint64 {
+	// splitmix64
+	z := l.seed + (seq*2+i+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// schedule returns when size bytes written at now are delivered. free is when
+// the connection finishes transmitting the data written before.
+func (l *Link) schedule(size int, now time.Time, free *time.Time) time.Time {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	seq := l.seq
+	l.seq++
+	f := l.faults
+	sent := now
+	if free.After(sent) {
+		sent = *free
+	}
+	if f.Bandwidth > 0 {
+		sent = sent.Add(time.Duration(size) * time.Second / time.Duration(f.Bandwidth))
+	}
+	*free = sent
+
+	due := sent.Add(f.Latency)
+	if f.Jitter > 0 {
+		due = due.Add(time.Duration(l.random(seq, 0)%uint64(2*f.Jitter+1)) - f.Jitter)
+	}
+	if f.Loss > 0 && float64(l.random(seq, 1)>>11)/(1<<53) < f.Loss {
+		due = due.Add(retransmitTimeout + 2*f.Latency)
+	}
+	return due
+}
+
+// wait waits until due, and for as long as the link is blocked. It returns
+// false if done is closed meanwhile.
+func (l *Link) wait(due time.Time, done <-chan struct{}) bool {
+	for {
+		l.lock.Lock()
+		blocked, changed := l.faults.Blocked, l.changed
+		l.lock.Unlock()
+
+		if blocked {
+			select {
+			case <-changed:
+				continue
+			case <-done:
+				return false
+			}
+		}
+		delay := due.Sub(l.clock.Now())
+		if delay <= 0 {
+			return true
+		}
+		select {
+		case <-l.clock.After(delay):
+		case <-changed:
+		case <-done:
+			return false
+		}
+	}
+}
+
+// Links holds the links between the endpoints of a simulation. The random
+// faults of a write derive from the seed and the number of writes sent through
+// its link before, so a simulation writing the same data suffers the same
+// faults when run again with the same seed.
+type Links struct {
+	seed  int64
+	clock Clock
+	lock  sync.Mutex
+	links map[string]*Link
+}
+
+// NewLinks creates the links of a simulation on wall time, all without faults
+func NewLinks(seed int64) *Links {
+	return NewLinksWithClock(seed, SystemClock)
+}
+
+// NewLinksWithClock creates the links of a simulation on the given clock, all
+// without faults
+func NewLinksWithClock(seed int64, clock Clock) *Links {
+	return &Links{seed: seed, clock: clock, links: make(map[string]*Link)}
+}
+
+// Seed returns the seed the random faults derive from
+func (ls *Links) Seed() int64 {
+	return ls.seed
+}
+
+// Link returns the link from one endpoint to another
+func (ls *Links) Link(from, to string) *Link {
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+
+	key := from + ">" + to
+	link, ok := ls.links[key]
+	if !ok {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		link = newLink(ls.seed^int64(h.Sum64()), ls.clock)
+		ls.links[key] = link
+	}
+	return link
+}
+
+// Pipe creates a connection from the endpoint from to the endpoint to with
+// the given pipe function. The ends are returned in the order of the pipe
+// functions, the end of to first, and suffer the faults of the links between
+// the endpoints.
+func (ls *Links) Pipe(pipe func() (net.Conn, net.Conn, error), from, to string) (net.Conn, net.Conn, error) {
+	toEnd, fromEnd, err := pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	return newFaultyConn(toEnd, ls.Link(to, from)), newFaultyConn(fromEnd, ls.Link(from, to)), nil
+}
+
+// faultyConn is an end of a connection whose writes are delivered by a
+// goroutine, as the link they are sent through permits. Writes block while
+// maxQueued bytes wait for delivery.
+type faultyConn struct {
+	net.Conn
+
+	link     *Link
+	lock     sync.Mutex
+	cond     *sync.Cond
+	queue    []chunk
+	queued   int       // bytes in the queue
+	free     time.Time // when the data written so far is transmitted
+	last     time.Time // delivery time of the last write, data is delivered in order
+	deadline time.Time // write deadline, zero for none
+	timer    *time.Timer
+	err      error // error of the delivery, returned by later writes
+	done     chan struct{}
+}
+
+type chunk struct {
+	data []byte
+	due  time.Time
+}
+
+// timeoutError is returned by writes whose deadline passed
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func newFaultyConn(conn net.Conn, link *Link) *faultyConn {
+	c := &faultyConn{Conn: conn, link: link, done: make(chan struct{})}
+	c.cond = sync.NewCond(&c.lock)
+	go c.deliver()
+	return c
+}
+
+func (c *faultyConn) Write(b []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for {
+		select {
+		case <-c.done:
+			return 0, io.ErrClosedPipe
+		default:
+		}
+		if c.err != nil {
+			return 0, c.err
+		}
+		if !c.deadline.IsZero() && !time.Now().Before(c.deadline) {
+			return 0, timeoutError{}
+		}
+		// A write larger than the queue goes through once the queue is empty
+		if c.queued == 0 || c.queued+len(b) <= maxQueued {
+			break
+		}
+		c.cond.Wait()
+	}
+	due := c.link.schedule(len(b), c.link.clock.Now(), &c.free)
+	if due.Before(c.last) {
+		due = c.last
+	}
+	c.last = due
+	c.queue = append(c.queue, chunk{data: append([]byte{}, b...), due: due})
+	c.queued += len(b)
+	c.cond.Broadcast()
+	return len(b), nil
+}
+
+// deliver writes the queued data to the connection once it is due
+func (c *faultyConn) deliver() {
+	for {
+		c.lock.Lock()
+		for len(c.queue) == 0 && c.err == nil {
+			c.cond.Wait()
+		}
+		if c.err != nil {
+			c.lock.Unlock()
+			return
+		}
+		next := c.queue[0]
+		c.lock.Unlock()
+
+		if !c.link.wait(next.due, c.done) {
+			return
+		}
+		_, err := c.Conn.Write(next.data)
+
+		c.lock.Lock()
+		c.queue = c.queue[1:]
+		c.queued -= len(next.data)
+		if err != nil {
+			c.err = err
+		}
+		c.cond.Broadcast()
+		c.lock.Unlock()
+	}
+}
+
+func (c *faultyConn) Close() error {
+	c.lock.Lock()
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+		if c.err == nil {
+			c.err = io.ErrClosedPipe
+		}
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		c.cond.Broadcast()
+	}
+	c.lock.Unlock()
+	return c.Conn.Close()
+}
+
+func (c *faultyConn) SetDeadline(t time.Time) error {
+	c.SetWriteDeadline(t)
+	return c.Conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets when blocked writes fail, data already written is
+// delivered regardless
+func (c *faultyConn) SetWriteDeadline(t time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.deadline = t
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if !t.IsZero() {
+		// Wake up the blocked writes once the deadline passes
+		c.timer = time.AfterFunc(time.Until(t), func() {
+			c.lock.Lock()
+			c.cond.Broadcast()
+			c.lock.Unlock()
+		})
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package pipes
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// testClock is a simulated clock that only moves when told to
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func (c *testClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- c.now.Add(d)
+	return ch
+}
+
+var testFaults = Faults{
+	Latency:   50 * time.Millisecond,
+	Jitter:    20 * time.Millisecond,
+	Bandwidth: 100000,
+	Loss:      0.2,
+}
+
+// schedule schedules 100 writes from a to b and returns when they are
+// delivered. With interleave, writes from b to a are scheduled in between.
+func schedule(seed int64, interleave bool) []time.Time {
+	clock := &testClock{now: time.Unix(0, 0)}
+	links := NewLinksWithClock(seed, clock)
+	ab, ba := links.Link("a", "b"), links.Link("b", "a")
+	ab.SetFaults(testFaults)
+	ba.SetFaults(testFaults)
+
+	var (
+		dues           []time.Time
+		abFree, baFree time.Time
+	)
+	for i := 0; i < 100; i++ {
+		if interleave && i%3 == 0 {
+			ba.schedule(64, clock.now, &baFree)
+		}
+		dues = append(dues, ab.schedule(100+i, clock.now, &abFree))
+		clock.now = clock.now.Add(10 * time.Millisecond)
+	}
+	return dues
+}
+
+func TestFaultsReplay(t *testing.T) {
+	t.Parallel()
+
+	first, again := schedule(42, false), schedule(42, true)
+	for i := range first {
+		if !first[i].Equal(again[i]) {
+			t.Fatalf("write %d: delivered at %v, then at %v with the same seed", i, first[i], again[i])
+		}
+	}
+	other := schedule(43, false)
+	for i := range first {
+		if !first[i].Equal(other[i]) {
+			return
+		}
+	}
+	t.Fatal("different seeds gave the same faults")
+}
+
+func TestWriteDeadline(t *testing.T) {
+	t.Parallel()
+
+	links := NewLinks(42)
+	links.Link("a", "b").SetFaults(Faults{Blocked: true})
+	_, a, err := links.Pipe(NetPipe, "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	// The link holds the data back, so the queue fills up
+	if _, err := a.Write(make([]byte, maxQueued)); err != nil {
+		t.Fatalf("write to the empty queue: %v", err)
+	}
+	a.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err = a.Write([]byte{1})
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Fatalf("write to the full queue: got error %v, want timeout", err)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"github.com/babyboy/common/queue"
 	"github.com/babyboy/core/types"
 	"github.com/babyboy/dag"
-	"github.com/babyboy/dag/memdb"
 	"encoding/json"
 	"errors"
 	"log"
@@ -24,7 +23,7 @@ func (tr *Transaction) BackTrackingHasSpentUTXO(unspent types.UTXO) []types.UTXO
 
 	for !trackQueue.Empty() {
 		utxo := trackQueue.Front().(types.UTXO)
-		curUnit, err := boydb.GetDbInstance().GetUnitByHash(utxo.UnitHash)
+		curUnit, err := tr.db.GetUnitByHash(utxo.UnitHash)
 		if err != nil {
 			log.Println(err)
 			log.Println("UTXO对应的单元不存在", utxo.UnitHash.String())
@@ -69,31 +68,31 @@ func (tr *Transaction) isAddInputHasSpent(curUnit types.Unit, index int, ch chan
 	switch utype {
 	case "wc":
 		input := curUnit.Messages[0].Payload.Inputs[index]
-		inputUnit, err := boydb.GetDbInstance().GetUnitByHash(input.UnitHash)
+		inputUnit, err := tr.db.GetUnitByHash(input.UnitHash)
 		if err != nil {
 			log.Println(err)
 		}
 		//commission := inputUnit.PayloadCommission
 		preUTXO = types.NewUTXO(inputUnit.Hash, 0, 0, input.Output, input.Type)
 
-		existStableUTXO := boydb.GetDbInstance().IsExistUnspentOutput(curUnit.Authors[0].Address, preUTXO)
+		existStableUTXO := tr.db.IsExistUnspentOutput(curUnit.Authors[0].Address, preUTXO)
 		ch <- ResultBack{stable: inputUnit.IsStable, exist: existStableUTXO, utxo: preUTXO}
 		break
 	case "mc":
 		input := curUnit.Messages[0].Payload.Inputs[index]
-		inputUnit, err := boydb.GetDbInstance().GetUnitByHash(input.UnitHash)
+		inputUnit, err := tr.db.GetUnitByHash(input.UnitHash)
 		if err != nil {
 			log.Println(err)
 		}
 		//commission := inputUnit.HeadersCommission
 		preUTXO = types.NewUTXO(inputUnit.Hash, 0, 0, input.Output, input.Type)
 
-		existStableUTXO := boydb.GetDbInstance().IsExistUnspentOutput(curUnit.Authors[0].Address, preUTXO)
+		existStableUTXO := tr.db.IsExistUnspentOutput(curUnit.Authors[0].Address, preUTXO)
 		ch <- ResultBack{stable: inputUnit.IsStable, exist: existStableUTXO, utxo: preUTXO}
 		break
 	case "":
 		input := curUnit.Messages[0].Payload.Inputs[index]
-		inputUnit, err := boydb.GetDbInstance().GetUnitByHash(input.UnitHash)
+		inputUnit, err := tr.db.GetUnitByHash(input.UnitHash)
 		if err != nil {
 			log.Println(err)
 		}
@@ -102,18 +101,14 @@ func (tr *Transaction) isAddInputHasSpent(curUnit types.Unit, index int, ch chan
 		//amount := inputUnit.Messages[messageIdx.Int64()].Payload.Outputs[outputIdx.Int64()].Amount
 		preUTXO = types.NewUTXO(inputUnit.Hash, 0, outputIdx, input.Output, input.Type)
 
-		existStableUTXO := boydb.GetDbInstance().IsExistUnspentOutput(curUnit.Authors[0].Address, preUTXO)
+		existStableUTXO := tr.db.IsExistUnspentOutput(curUnit.Authors[0].Address, preUTXO)
 		ch <- ResultBack{stable: inputUnit.IsStable, exist: existStableUTXO, utxo: preUTXO}
 		break
 	}
 }
 
 func (tr *Transaction) GetMainChainMerkleRoot() []byte {
-	db := boydb.GetDbInstance()
-	pdb := memdb.GetParentMemDBInstance()
-	wdb := memdb.GetWitnessMemDBInstance()
-
-	graphInfo := dag.NewGraphInfoGetter(db, pdb.GetParentsAsHash(), wdb.GetWitnessesAsHash())
+	graphInfo := dag.NewGraphInfoGetter(tr.db, tr.pdb.GetParentsAsHash(), tr.wdb.GetWitnessesAsHash())
 	startMci := graphInfo.GetLastStableBallMCI()
 	sUnits, _ := graphInfo.GetMissingUnits(startMci, 0)
 
@@ -134,11 +129,7 @@ func (tr *Transaction) GetMainChainMerkleRoot() []byte {
 }
 
 func (tr *Transaction) IsUnitInMerkleTree(unit types.Unit) (bool, error) {
-	db := boydb.GetDbInstance()
-	pdb := memdb.GetParentMemDBInstance()
-	wdb := memdb.GetWitnessMemDBInstance()
-
-	graphInfo := dag.NewGraphInfoGetter(db, pdb.GetParentsAsHash(), wdb.GetWitnessesAsHash())
+	graphInfo := dag.NewGraphInfoGetter(tr.db, tr.pdb.GetParentsAsHash(), tr.wdb.GetWitnessesAsHash())
 	startMci := graphInfo.GetLastStableBallMCI()
 	sUnits, _ := graphInfo.GetMissingUnits(startMci, 0)
 
@@ -183,7 +174,7 @@ func (tr *Transaction) VerifyMessageInputs(unit types.Unit) error {
 			switch curMessage.Payload.Inputs[j].Type {
 			case "wc":
 				input := curMessage.Payload.Inputs[j]
-				inputUnit, err := boydb.GetDbInstance().GetUnitByHash(input.UnitHash)
+				inputUnit, err := tr.db.GetUnitByHash(input.UnitHash)
 				if err != nil {
 					log.Println("未找到输入来源的单元数据")
 					return err
@@ -195,7 +186,7 @@ func (tr *Transaction) VerifyMessageInputs(unit types.Unit) error {
 				break
 			case "mc":
 				input := curMessage.Payload.Inputs[j]
-				inputUnit, err := boydb.GetDbInstance().GetUnitByHash(input.UnitHash)
+				inputUnit, err := tr.db.GetUnitByHash(input.UnitHash)
 				if err != nil {
 					log.Println("未找到输入来源的单元数据")
 					return err
@@ -207,7 +198,7 @@ func (tr *Transaction) VerifyMessageInputs(unit types.Unit) error {
 				break
 			case "":
 				input := curMessage.Payload.Inputs[j]
-				inputUnit, err := boydb.GetDbInstance().GetUnitByHash(input.UnitHash)
+				inputUnit, err := tr.db.GetUnitByHash(input.UnitHash)
 				if err != nil {
 					log.Println("未找到输入来源的单元数据")
 					return err
@@ -219,7 +210,7 @@ func (tr *Transaction) VerifyMessageInputs(unit types.Unit) error {
 				break
 			}
 
-			isExist := boydb.GetDbInstance().IsExistUnspentOutput(unit.Authors[0].Address, futureSpent)
+			isExist := tr.db.IsExistUnspentOutput(unit.Authors[0].Address, futureSpent)
 			if !isExist {
 				strByte, _ := json.Marshal(futureSpent)
 				log.Println(string(strByte))
@@ -229,7 +220,7 @@ func (tr *Transaction) VerifyMessageInputs(unit types.Unit) error {
 			utxos = append(utxos, UtxoHelper{Address: unit.Authors[0].Address, UTXO: futureSpent, IsStable: inputUnit.IsStable})
 		} else {
 			input := curMessage.Payload.Inputs[j]
-			inputUnit, err := boydb.GetDbInstance().GetUnitByHash(input.UnitHash)
+			inputUnit, err := tr.db.GetUnitByHash(input.UnitHash)
 			if err != nil {
 				log.Println("未找到输入来源的单元数据")
 				return err
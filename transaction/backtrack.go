@@ -16,7 +16,7 @@ func (tr *Transaction) BackTrackingUTXO(newUnit types.Unit) {
 
 	fmt.Println()
 
-	putxo := boydb.GetDbInstance().GetPendingUTXOByAuthor(newUnit.Authors[0].Address)
+	putxo := tr.db.GetPendingUTXOByAuthor(newUnit.Authors[0].Address)
 	if len(putxo) == 0 {
 		log.Println("回溯结果: ", "正常")
 		return
@@ -30,7 +30,7 @@ func (tr *Transaction) BackTrackingUTXO(newUnit types.Unit) {
 
 	for !trackQueue.Empty() {
 		utxo := trackQueue.Front().(types.UTXO)
-		curUnit, err := boydb.GetDbInstance().GetUnitByHash(utxo.UnitHash)
+		curUnit, err := tr.db.GetUnitByHash(utxo.UnitHash)
 		if err != nil {
 			log.Println("UTXO对应的单元不存在")
 			break
@@ -87,19 +87,19 @@ func (tr *Transaction) BackTrackingUTXO(newUnit types.Unit) {
 
 func (tr *Transaction) reBuildPendingPool(newUnit types.Unit) {
 	log.Println("Rebuild Pending UTXO")
-	utxos := boydb.GetDbInstance().GetPendingUTXOByAuthor(newUnit.Authors[0].Address)
+	utxos := tr.db.GetPendingUTXOByAuthor(newUnit.Authors[0].Address)
 	pendingUnits := make(types.Units, len(utxos))
 	for _, u := range utxos {
-		unit, err := boydb.GetDbInstance().GetUnitByHash(u.UnitHash)
+		unit, err := tr.db.GetUnitByHash(u.UnitHash)
 		if err != nil {
 			log.Println(err)
 			continue
 		}
 		pendingUnits = append(pendingUnits, unit)
 	}
-	pUnSpent := boydb.GetDbInstance().GetAllPendingUnSpent(newUnit.Authors[0].Address)
+	pUnSpent := tr.db.GetAllPendingUnSpent(newUnit.Authors[0].Address)
 	for _, u := range pUnSpent {
-		boydb.GetDbInstance().DelPendingUTXO(newUnit.Authors[0].Address, u)
+		tr.db.DelPendingUTXO(newUnit.Authors[0].Address, u)
 		strByte, _ := json.Marshal(u)
 		log.Println(string(strByte))
 	}
@@ -116,7 +116,7 @@ func (tr *Transaction) isInputHasSpent(curUnit types.Unit, index int, ch chan Re
 	switch utype {
 	case "wc":
 		input := curUnit.Messages[0].Payload.Inputs[index]
-		inputUnit, err := boydb.GetDbInstance().GetUnitByHash(input.UnitHash)
+		inputUnit, err := tr.db.GetUnitByHash(input.UnitHash)
 		if err != nil {
 			log.Println(err)
 		}
@@ -124,13 +124,13 @@ func (tr *Transaction) isInputHasSpent(curUnit types.Unit, index int, ch chan Re
 		preUTXO = types.NewUTXO(inputUnit.Hash, 0, 0, output, input.Type)
 
 		log.Println("当前单元: ", curUnit.IsStable)
-		existStableUTXO := boydb.GetDbInstance().IsExistUnspentOutput(curUnit.Authors[0].Address, preUTXO)
+		existStableUTXO := tr.db.IsExistUnspentOutput(curUnit.Authors[0].Address, preUTXO)
 
 		ch <- ResultBack{stable: inputUnit.IsStable, exist: existStableUTXO, utxo: preUTXO}
 		break
 	case "mc":
 		input := curUnit.Messages[0].Payload.Inputs[index]
-		inputUnit, err := boydb.GetDbInstance().GetUnitByHash(input.UnitHash)
+		inputUnit, err := tr.db.GetUnitByHash(input.UnitHash)
 		if err != nil {
 			log.Println(err)
 		}
@@ -138,13 +138,13 @@ func (tr *Transaction) isInputHasSpent(curUnit types.Unit, index int, ch chan Re
 		preUTXO = types.NewUTXO(inputUnit.Hash, 0, 0, output, input.Type)
 
 		log.Println("当前单元: ", curUnit.IsStable)
-		existStableUTXO := boydb.GetDbInstance().IsExistUnspentOutput(curUnit.Authors[0].Address, preUTXO)
+		existStableUTXO := tr.db.IsExistUnspentOutput(curUnit.Authors[0].Address, preUTXO)
 
 		ch <- ResultBack{stable: inputUnit.IsStable, exist: existStableUTXO, utxo: preUTXO}
 		break
 	case "":
 		input := curUnit.Messages[0].Payload.Inputs[index]
-		inputUnit, err := boydb.GetDbInstance().GetUnitByHash(input.UnitHash)
+		inputUnit, err := tr.db.GetUnitByHash(input.UnitHash)
 		if err != nil {
 			log.Println(err)
 		}
@@ -154,7 +154,7 @@ func (tr *Transaction) isInputHasSpent(curUnit types.Unit, index int, ch chan Re
 		preUTXO = types.NewUTXO(inputUnit.Hash, messageIdx, outputIdx, output, "")
 
 		log.Println("当前单元: ", curUnit.IsStable)
-		existStableUTXO := boydb.GetDbInstance().IsExistUnspentOutput(curUnit.Authors[0].Address, preUTXO)
+		existStableUTXO := tr.db.IsExistUnspentOutput(curUnit.Authors[0].Address, preUTXO)
 
 		ch <- ResultBack{stable: inputUnit.IsStable, exist: existStableUTXO, utxo: preUTXO}
 		break
@@ -28,7 +28,7 @@ func (mc *MainChain) UpdateMainChain(tran *Transaction, unit types.Unit) error {
 
 	unit.ResetStableState()
 	tran.db.SaveUnitToDb(unit)
-	pdb := memdb.GetParentMemDBInstance()
+	pdb := tran.pdb
 	pdb.SaveNewTip(unit.Hash)
 
 	log.Println("接收共识准备处理的单元: ", unit.Hash.String())
@@ -59,6 +59,7 @@ func (mc *MainChain) handleStableUnits(tran *Transaction, units types.Units, mai
 	Len := len(units)
 
 	validUnits := types.Units{}
+	stableUnits := make(types.Units, 0, Len)
 	for i := 0; i < Len; i++ {
 		tUnit := units[i]
 		log.Println("最后处理UTXO: ", tUnit.Hash.String())
@@ -71,12 +72,18 @@ func (mc *MainChain) handleStableUnits(tran *Transaction, units types.Units, mai
 			} else {
 				log.Println("该单元为无效单元: ", tUnit.Hash.String())
 				tUnit.Invalid = true
-				tran.db.SaveUnitToDb(tUnit)
 			}
+			stableUnits = append(stableUnits, tUnit)
 			allCommissions = append(allCommissions, stableCommissions...)
 		}
 	}
 
+	// 见证人替换的投票只由稳定单元驱动, 稳定单元和活跃度一起写入
+	if err := dag.NewWitnessVoter(tran.db, tran.wdb).ApplyStableUnits(stableUnits); err != nil {
+		// 稳定单元没有写入, 继续分配手续费会让各节点的状态不一致
+		log.Fatalln("写入稳定单元和见证人投票失败:", err)
+	}
+
 	if len(validUnits) > 0 {
 		witnessCommission := tran.HandleCommission(validUnits)
 		allCommissions = append(allCommissions, witnessCommission...)
@@ -89,6 +96,10 @@ func (mc *MainChain) handleStableUnits(tran *Transaction, units types.Units, mai
 
 	mc.distributeCommission(tran.db, authorsCom)
 	//mainChain.ExtendStableUnit(units)
+
+	if tran.stableHook != nil {
+		tran.stableHook()
+	}
 }
 
 func (mc *MainChain) distributeCommission(db *boydb.DatabaseManager, comMap map[common.Address][]types.Commission) {
@@ -1,6 +1,9 @@
 package transaction
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrNotUnSpentInput     = errors.New("未找到该笔交易的输入来源,请同步数据")
@@ -21,4 +24,44 @@ var (
 	ErrParentsList         = errors.New("单元的父节点不存在")
 	ErrCheckUnitHash       = errors.New("单元的Hash校验错误")
 	ErrTimeStamp           = errors.New("单元的时间戳小于父单元时间戳")
+	ErrUnitSignature       = errors.New("单元的签名验证失败")
 )
+
+var (
+	ErrWitnessListEmpty        = errors.New("单元的见证人列表为空")
+	ErrWitnessListDuplicate    = errors.New("单元的见证人列表有重复的见证人")
+	ErrWitnessListLength       = errors.New("单元的见证人列表长度与最优父单元不同")
+	ErrWitnessListIncompatible = errors.New("单元的见证人列表与最优父单元不兼容")
+	ErrWitnessListUnknown      = errors.New("单元的见证人列表与最后稳定单元时生效的见证人列表不兼容")
+	ErrBestParentUnknown       = errors.New("单元的最优父单元不存在")
+	ErrBestParentMismatch      = errors.New("单元的最优父单元与计算结果不一致")
+	ErrUnitNoParents           = errors.New("非创世单元没有父单元")
+	ErrLastBallUnknown         = errors.New("单元的最后稳定单元不存在")
+)
+
+// 单元审核拒绝的错误码, 对外(日志和RPC)保持不变
+const (
+	ReviewCodeWitnessListEmpty        = 1001
+	ReviewCodeWitnessListDuplicate    = 1002
+	ReviewCodeWitnessListLength       = 1003
+	ReviewCodeWitnessListIncompatible = 1004
+	ReviewCodeWitnessListUnknown      = 1005
+	ReviewCodeBestParentUnknown       = 1006
+	ReviewCodeBestParentMismatch      = 1007
+	ReviewCodeNoParents               = 1008
+	ReviewCodeLastBallUnknown         = 1009
+)
+
+// 带错误码的单元审核错误
+type ReviewError struct {
+	Code int
+	Err  error
+}
+
+func (e *ReviewError) Error() string {
+	return fmt.Sprintf("review rejected (code %d): %v", e.Code, e.Err)
+}
+
+func newReviewError(code int, err error) *ReviewError {
+	return &ReviewError{Code: code, Err: err}
+}
@@ -0,0 +1,52 @@
+package transaction
+
+import (
+	"github.com/babyboy/common"
+	"github.com/babyboy/config"
+	"github.com/babyboy/core/types"
+)
+
+// 用给定的未花费输出组装一笔支付, 找零退回 from.
+// 不访问数据库, 轻节点用它在本地构造单元, unit 需已设置父单元和最后稳定球.
+func ComposePayment(unit types.Unit, from common.Address, unspent []types.UTXO, to common.Address, amount int) (types.Unit, error) {
+	totalSpend := amount + ConstHeaderCommission + ConstPayloadCommission
+
+	var inputs types.Inputs
+	curAmount := 0
+	for _, u := range unspent {
+		if u.Output.Address != from {
+			continue
+		}
+		curAmount += u.Output.Amount
+		inputs = append(inputs, types.NewInput(u.UnitHash, u.MessageIndex, u.OutputIndex, u.Type, u.Output))
+		if curAmount >= totalSpend {
+			break
+		}
+	}
+
+	if curAmount < amount {
+		return types.Unit{}, ErrNotEnoughBalance
+	}
+	if curAmount < totalSpend {
+		return types.Unit{}, ErrNotEnoughCommission
+	}
+
+	outputs := types.Outputs{types.NewOutput(to, amount)}
+	if change := curAmount - totalSpend; change > 0 {
+		outputs = append(outputs, types.NewOutput(from, change))
+	}
+
+	payload := types.NewPayLoad().
+		AddInputs(inputs).
+		AddOutputs(outputs)
+
+	builder := types.NewMessageBuilder().
+		SetAppName(config.Const_Message_AppType_Payment).
+		SetPayloadHash(payload.GetPayloadHash()).
+		SetPayload(payload)
+
+	unit.Messages = types.Messages{builder.GetMessage()}
+	unit.HeadersCommission = ConstHeaderCommission
+	unit.PayloadCommission = ConstPayloadCommission
+	return unit, nil
+}
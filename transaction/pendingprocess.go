@@ -10,16 +10,17 @@ import (
 
 type PendingPool struct {
 	PendingTx map[string]types.UTXO
+	db        *boydb.DatabaseManager
 }
 
-func NewPendingPool() *PendingPool {
-	return &PendingPool{}
+func NewPendingPool(db *boydb.DatabaseManager) *PendingPool {
+	return &PendingPool{db: db}
 }
 
 func (pool *PendingPool) HandleUnit(unit types.Unit) error {
 
 	var utxos []UtxoHelper
-	db := leveldb.GetDbInstance()
+	db := pool.db
 	for i := 0; i < len(unit.Messages); i++ {
 		curMessage := unit.Messages[i]
 
@@ -38,7 +39,7 @@ func (pool *PendingPool) HandleUnit(unit types.Unit) error {
 
 			if inputUnit.IsStable {
 
-				isExist := boydb.GetDbInstance().IsExistUnspentOutput(futureSpent)
+				isExist := pool.db.IsExistUnspentOutput(futureSpent)
 				if !isExist {
 					log.Println("该单元的未花费在Pending池中未找到")
 					pool.print(futureSpent)
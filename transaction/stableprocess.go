@@ -12,8 +12,8 @@ type StableProcess struct {
 	db *boydb.DatabaseManager
 }
 
-func NewStableProcess() *StableProcess {
-	return &StableProcess{}
+func NewStableProcess(db *boydb.DatabaseManager) *StableProcess {
+	return &StableProcess{db: db}
 }
 
 func (sp *StableProcess) HandleUnit(newUnit types.Unit) ([]types.Commission, bool, error) {
@@ -31,7 +31,7 @@ func (sp *StableProcess) HandleUnit(newUnit types.Unit) ([]types.Commission, boo
 			switch uType {
 			case "wc":
 				input := curMessage.Payload.Inputs[j]
-				inputUnit, err := boydb.GetDbInstance().GetUnitByHash(input.UnitHash)
+				inputUnit, err := sp.db.GetUnitByHash(input.UnitHash)
 				if err != nil {
 					log.Println("未找到输入来源的单元数据")
 					return commissions, false, ErrNotFindFrom
@@ -41,7 +41,7 @@ func (sp *StableProcess) HandleUnit(newUnit types.Unit) ([]types.Commission, boo
 				break
 			case "mc":
 				input := curMessage.Payload.Inputs[j]
-				inputUnit, err := boydb.GetDbInstance().GetUnitByHash(input.UnitHash)
+				inputUnit, err := sp.db.GetUnitByHash(input.UnitHash)
 				if err != nil {
 					log.Println("未找到输入来源的单元数据")
 					return commissions, false, ErrNotFindFrom
@@ -51,7 +51,7 @@ func (sp *StableProcess) HandleUnit(newUnit types.Unit) ([]types.Commission, boo
 				break
 			case "":
 				input := curMessage.Payload.Inputs[j]
-				inputUnit, err := boydb.GetDbInstance().GetUnitByHash(input.UnitHash)
+				inputUnit, err := sp.db.GetUnitByHash(input.UnitHash)
 				if err != nil {
 					log.Println("未找到输入来源的单元数据")
 					return commissions, false, ErrNotFindFrom
@@ -63,8 +63,8 @@ func (sp *StableProcess) HandleUnit(newUnit types.Unit) ([]types.Commission, boo
 				break
 			}
 
-			if boydb.GetDbInstance().IsExistUnspentOutput(pendingSpent) {
-				boydb.GetDbInstance().DelUnspentOutput(newUnit.Authors[0].Address, pendingSpent)
+			if sp.db.IsExistUnspentOutput(pendingSpent) {
+				sp.db.DelUnspentOutput(newUnit.Authors[0].Address, pendingSpent)
 			} else {
 				log.Println("稳定的UTXO不存在,可能被其他交易使用")
 				sp.print(pendingSpent)
@@ -78,7 +78,7 @@ func (sp *StableProcess) HandleUnit(newUnit types.Unit) ([]types.Commission, boo
 			amount := curMessage.Payload.Outputs[z].Amount
 
 			unSpent := types.NewUTXO(newUnit.Hash, i, z, types.Output{Amount: amount, Address: address}, "")
-			boydb.GetDbInstance().DelPendingUnspentOutput(unSpent)
+			sp.db.DelPendingUnspentOutput(unSpent)
 			commission := types.NewCommission(address, unSpent)
 			commissions = append(commissions, commission)
 		}
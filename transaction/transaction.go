@@ -24,11 +24,13 @@ type TXEventType int
 
 const (
 	NewUnitHandleDone TXEventType = iota
+	UnitRejected                  // 单元未通过签名或审核, Err 为原因
 )
 
 type TXEvent struct {
 	NewUnitEntity types.NewUnitEntity // Wallet instance arrived or departed
 	Kind          TXEventType         // Event type that happened in the system
+	Err           error               // Reason of UnitRejected
 }
 
 func (tr *Transaction) Subscribe(sink chan<- TXEvent) event.Subscription {
@@ -41,19 +43,28 @@ type Transaction struct {
 	PendingProc *PendingPool
 	StableProc  *StableProcess
 	db          *boydb.DatabaseManager
+	pdb         *memdb.ParentMemDB
+	wdb         *memdb.WitnessMemDB
 	wg          sync.WaitGroup
 	mux         sync.Mutex
 	muxUnit     sync.Mutex
 	chSubmitTx  chan types.NewUnitEntity
 	feed        event.Feed
+	tipPolicy   memdb.TipPolicy
+	genesisHash common.Hash
+	stableHook  func()
 }
 
-func NewTransaction() *Transaction {
+// 新建交易处理实例, 数据库和内存数据库由节点传入, 每个节点各自一份
+func NewTransaction(db *boydb.DatabaseManager, pdb *memdb.ParentMemDB, wdb *memdb.WitnessMemDB) *Transaction {
 	transaction := Transaction{}
-	transaction.PendingProc = NewPendingPool()
-	transaction.StableProc = NewStableProcess()
+	transaction.PendingProc = NewPendingPool(db)
+	transaction.StableProc = NewStableProcess(db)
 
-	transaction.db = boydb.GetDbInstance()
+	transaction.db = db
+	transaction.pdb = pdb
+	transaction.wdb = wdb
+	transaction.tipPolicy = memdb.DefaultTipPolicy
 
 	transaction.chSubmitTx = make(chan types.NewUnitEntity, 16)
 	go transaction.SubmitTXLoop(transaction.chSubmitTx)
@@ -87,18 +98,39 @@ func (tr *Transaction) isContantUTXO(target types.UTXO, all []types.UTXO) bool {
 	return result
 }
 
-func (tr *Transaction) buildTransactionUnit() types.Unit {
+// 设置新单元选择父单元的策略, 需在节点启动前调用
+func (tr *Transaction) SetTipPolicy(policy memdb.TipPolicy) {
+	tr.tipPolicy = policy
+}
 
-	db := boydb.GetDbInstance()
-	pdb := memdb.GetParentMemDBInstance()
-	wdb := memdb.GetWitnessMemDBInstance()
+// 设置创世单元的哈希, 只有创世单元可以没有父单元
+func (tr *Transaction) SetGenesisHash(hash common.Hash) {
+	tr.genesisHash = hash
+}
 
-	gig := dag.NewGraphInfoGetter(db, pdb.GetParentsAsHash(), wdb.GetWitnessesAsHash())
+// 设置主链索引变为稳定后的回调, 在共识锁内调用, 此时稳定单元和UTXO已全部写入
+func (tr *Transaction) SetStableHook(hook func()) {
+	tr.stableHook = hook
+}
+
+// 在当前的末端单元上构建新单元, 没有兼容的父单元时不能创建
+func (tr *Transaction) buildTransactionUnit() (types.Unit, error) {
+
+	witnessList := tr.wdb.GetWitnessesAsHash()
+	parentList, err := tr.pdb.SelectTips(witnessList, tr.tipPolicy)
+	if err != nil {
+		return types.Unit{}, err
+	}
+	gig := dag.NewGraphInfoGetter(tr.db, parentList, witnessList)
+	bestParent, err := gig.GetBestParentUnit()
+	if err != nil {
+		return types.Unit{}, err
+	}
 
 	unit := types.NewEmptyUnit()
-	unit.ParentList = pdb.GetParentsAsHash()
-	unit.WitnessList = wdb.GetWitnessesAsHash()
-	unit.BestParentUnit = gig.GetBestParentUnit()
+	unit.ParentList = parentList
+	unit.WitnessList = witnessList
+	unit.BestParentUnit = bestParent
 	unit.Level = gig.GetLevel()
 	unit.WitnessedLevel = gig.GetWitnessLevel()
 	unit.LastBallUnit = gig.GetLastStableBall()
@@ -108,12 +140,21 @@ func (tr *Transaction) buildTransactionUnit() types.Unit {
 	unit.IsOnMainChain = false
 	unit.SubStableMinHash = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
 
-	return unit
+	return unit, nil
+}
+
+// CreateWitnessUnit builds an unsigned unit without messages on top of the
+// current tips, witnesses post such units to move stability forward.
+func (tr *Transaction) CreateWitnessUnit() (types.Unit, error) {
+	return tr.buildTransactionUnit()
 }
 
 func (tr *Transaction) CreateTx(from accounts.Account, totalAmount *big.Int, tx string, amount int64) (types.Unit, error) {
 
-	newUnit := tr.buildTransactionUnit()
+	newUnit, err := tr.buildTransactionUnit()
+	if err != nil {
+		return newUnit, err
+	}
 
 	// Calculate all spending
 	totalSpend := totalAmount.Int64() + ConstHeaderCommission + ConstPayloadCommission
@@ -227,13 +268,13 @@ func (tr *Transaction) GiveMinerEarnings(units types.Units) []types.Commission {
 }
 
 func (tr *Transaction) FindUnspentTransactionFromStable(address common.Address) []types.UTXO {
-	txs := boydb.GetDbInstance().GetUnspentOutput(address)
+	txs := tr.db.GetUnspentOutput(address)
 
 	return txs
 }
 
 func (tr *Transaction) FindUnspentTransactionFromPendingPool(address common.Address) map[string]types.UTXO {
-	txs := boydb.GetDbInstance().GetUnspentOutputFromPendingPool(address)
+	txs := tr.db.GetUnspentOutputFromPendingPool(address)
 
 	return txs
 }
@@ -246,13 +287,27 @@ func (tr *Transaction) SubmitTXLoop(chSubmitTx <-chan types.NewUnitEntity) {
 	for newUnitEntity := range chSubmitTx {
 		newUnit := newUnitEntity.NewUnit
 
+		if newUnit.Hash != newUnit.HashKey() {
+			log.Println("单元的Hash校验失败,不进行存储和广播")
+			tr.reject(newUnitEntity, ErrCheckUnitHash)
+			continue
+		}
+
 		if signer := core.NewSigner(); !signer.VerifyUnit(newUnit) {
 			log.Println("签名验证失败,不进行存储和广播")
+			tr.reject(newUnitEntity, ErrUnitSignature)
+			continue
+		}
+
+		if err := tr.ReviewWitnessList(newUnit); err != nil {
+			log.Println(err)
+			tr.reject(newUnitEntity, err)
 			continue
 		}
 
 		if err := tr.ReviewUnit(newUnit); err != nil {
 			log.Println(err)
+			tr.reject(newUnitEntity, err)
 			continue
 		}
 
@@ -264,3 +319,7 @@ func (tr *Transaction) SubmitTXLoop(chSubmitTx <-chan types.NewUnitEntity) {
 	}
 }
 
+// 通知订阅者单元被拒绝, 节点据此给发送单元的对端扣分
+func (tr *Transaction) reject(entity types.NewUnitEntity, err error) {
+	tr.feed.Send(TXEvent{Kind: UnitRejected, NewUnitEntity: entity, Err: err})
+}
@@ -0,0 +1,158 @@
+package transaction
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"babyboy-dag/boydb"
+	"github.com/babyboy/common"
+	"github.com/babyboy/core"
+	"github.com/babyboy/core/types"
+	"github.com/babyboy/crypto"
+	"github.com/babyboy/dag"
+	"github.com/babyboy/dag/memdb"
+)
+
+// testNode is the DAG of one node: a database, memdbs and transaction
+// processing of its own
+type testNode struct {
+	db     *boydb.DatabaseManager
+	pdb    *memdb.ParentMemDB
+	wdb    *memdb.WitnessMemDB
+	tr     *Transaction
+	events chan TXEvent
+}
+
+func newTestNode(genesis *core.Genesis) *testNode {
+	db := boydb.NewDatabaseManager()
+	db.InitWithDatabase(boydb.NewMemDatabase())
+	n := &testNode{
+		db:     db,
+		pdb:    memdb.NewParentMemDB(db),
+		wdb:    memdb.NewWitnessMemDB(db),
+		events: make(chan TXEvent, 16),
+	}
+	n.pdb.InitParentMemDB()
+	n.wdb.InitWitnessMemDB()
+
+	unit := genesis.ToUnit()
+	db.SaveGenisisUnit(unit)
+	n.pdb.SaveNewTip(unit.Hash)
+	n.wdb.SaveWitnessList(unit.WitnessList)
+	for _, utxo := range genesis.UnspentOutputs(unit) {
+		db.SaveUnspentOutput(utxo.Output.Address, utxo)
+	}
+	n.tr = NewTransaction(db, n.pdb, n.wdb)
+	n.tr.SetGenesisHash(unit.Hash)
+	n.tr.Subscribe(n.events)
+	return n
+}
+
+// submit hands a unit to the node and waits until it is handled
+func (n *testNode) submit(unit types.Unit) error {
+	n.tr.RecvUnit(types.NewUnitEntity{FromPeerId: "local", NewUnit: unit})
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-n.events:
+			if ev.NewUnitEntity.NewUnit.Hash != unit.Hash {
+				continue
+			}
+			if ev.Kind == UnitRejected {
+				return ev.Err
+			}
+			return nil
+		case <-timeout:
+			return fmt.Errorf("unit %s not handled", unit.Hash.String())
+		}
+	}
+}
+
+// postWitnessUnit builds a witness unit on the tips of the node, signs it
+// with key and submits it
+func (n *testNode) postWitnessUnit(key *ecdsa.PrivateKey) (types.Unit, error) {
+	unit, err := n.tr.CreateWitnessUnit()
+	if err != nil {
+		return unit, err
+	}
+	unit.TimeStamp = time.Now().Unix()
+	data, err := json.Marshal(unit)
+	if err != nil {
+		return unit, err
+	}
+	msg := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(data), data)
+	signature, err := crypto.Sign(crypto.Keccak256([]byte(msg)), key)
+	if err != nil {
+		return unit, err
+	}
+	signature[64] += 27
+	unit.Authors = types.Authors{types.NewAuthor(crypto.PubkeyToAddress(key.PublicKey), signature)}
+	unit.Hash = unit.HashKey()
+	return unit, n.submit(unit)
+}
+
+func (n *testNode) lastStableBall() common.Hash {
+	return dag.NewGraphInfoGetter(n.db, n.pdb.GetDagAllTips(), n.wdb.GetWitnessesAsHash()).GetLastStableBall()
+}
+
+func newTestWitnesses(t *testing.T) ([]*ecdsa.PrivateKey, *core.Genesis) {
+	var (
+		keys  []*ecdsa.PrivateKey
+		addrs []common.Address
+	)
+	for range core.DefaultGenesis().Witnesses {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+		addrs = append(addrs, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	return keys, core.DeveloperGenesis(addrs, nil)
+}
+
+// Two nodes in one process run the transaction and DAG code on their own
+// state: units handled by one don't show up on the other until it receives
+// them, and both then agree on the DAG.
+func TestTwoNodesOneProcess(t *testing.T) {
+	t.Parallel()
+
+	keys, genesis := newTestWitnesses(t)
+	a, b := newTestNode(genesis), newTestNode(genesis)
+	genesisHash := genesis.ToUnit().Hash
+
+	var units types.Units
+	for round := 0; round < 3; round++ {
+		for _, key := range keys {
+			unit, err := a.postWitnessUnit(key)
+			if err != nil {
+				t.Fatalf("round %d: %v", round, err)
+			}
+			units = append(units, unit)
+		}
+	}
+	if tips := b.pdb.GetParentsAsHash(); len(tips) != 1 || tips[0] != genesisHash {
+		t.Fatalf("tips of node b: got %v, want the genesis unit", tips)
+	}
+	for _, unit := range units {
+		if _, err := b.db.GetUnitByHash(unit.Hash); err == nil {
+			t.Fatalf("unit %s of node a stored by node b", unit.Hash.String())
+		}
+	}
+
+	for _, unit := range units {
+		if err := b.submit(unit); err != nil {
+			t.Fatalf("node b rejected unit %s: %v", unit.Hash.String(), err)
+		}
+	}
+	tipsA, tipsB := a.pdb.GetParentsAsHash(), b.pdb.GetParentsAsHash()
+	if len(tipsA) != 1 || len(tipsB) != 1 || tipsA[0] != tipsB[0] {
+		t.Fatalf("tips differ: node a has %v, node b has %v", tipsA, tipsB)
+	}
+	if ballA, ballB := a.lastStableBall(), b.lastStableBall(); ballA != ballB {
+		t.Fatalf("last stable balls differ: node a has %s, node b has %s", ballA.String(), ballB.String())
+	}
+}
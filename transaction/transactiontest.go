@@ -1,32 +1,33 @@
 package transaction
 
 import (
-	"babyboy-dag/boydb"
 	"github.com/babyboy/leveldb"
 	"github.com/babyboy/common"
-	"github.com/babyboy/config"
 	"github.com/babyboy/core/types"
 	"github.com/babyboy/dag"
-	"github.com/babyboy/dag/memdb"
 )
 
-func NewTransactionTest(witness int) types.Unit {
+func (tr *Transaction) NewTransactionTest(witness int) (types.Unit, error) {
 
-	db := boydb.GetDbInstance()
-	pdb := memdb.GetParentMemDBInstance()
-	wdb := memdb.GetWitnessMemDBInstance()
+	db := tr.db
+	pdb := tr.pdb
+	wdb := tr.wdb
 
 	gig := dag.NewGraphInfoGetter(db, pdb.GetParentsAsHash(), wdb.GetWitnessesAsHash())
 
 	u := types.Unit{}
 	u.ParentList = pdb.GetParentsAsHash()
 	u.WitnessList = wdb.GetWitnessesAsHash()
-	u.BestParentUnit = gig.GetBestParentUnit()
+	bestParent, err := gig.GetBestParentUnit()
+	if err != nil {
+		return u, err
+	}
+	u.BestParentUnit = bestParent
 	u.Level = gig.GetLevel()
 	u.WitnessedLevel = gig.GetWitnessLevel()
 	u.LastBallUnit = gig.GetLastStableBall()
 	u.Authors = make(types.Authors, 1)
-	u.Authors[0].Address = common.HexToAddress(config.WitnessList[witness])
+	u.Authors[0].Address = u.WitnessList[witness]
 	u.IsStable = false
 	u.MainChainIndex = 0
 	u.IsOnMainChain = false
@@ -46,5 +47,5 @@ func NewTransactionTest(witness int) types.Unit {
 		mcu.ExtendStableUnit(uints)
 	}
 
-	return u
+	return u, nil
 }
@@ -0,0 +1,55 @@
+package transaction
+
+import (
+	"github.com/babyboy/core/types"
+	"github.com/babyboy/dag"
+)
+
+// 审核单元的见证人列表
+//
+// 单元的见证人列表最多只能与最优父单元的列表, 以及最后稳定单元时生效的
+// 见证人列表相差一个见证人, 并且最优父单元必须是按单元自己的见证人列表在
+// 兼容的父单元中选出的那个.
+func (tr *Transaction) ReviewWitnessList(unit types.Unit) error {
+	// 只有配置的创世单元没有父单元
+	if unit.Hash == tr.genesisHash {
+		return nil
+	}
+	if len(unit.ParentList) == 0 {
+		return newReviewError(ReviewCodeNoParents, ErrUnitNoParents)
+	}
+	if len(unit.WitnessList) == 0 {
+		return newReviewError(ReviewCodeWitnessListEmpty, ErrWitnessListEmpty)
+	}
+	if dag.HasDuplicateWitness(unit.WitnessList) {
+		return newReviewError(ReviewCodeWitnessListDuplicate, ErrWitnessListDuplicate)
+	}
+	// 按单元的最后稳定单元时生效的见证人列表验证, 历史单元不受之后替换的影响
+	lastBall, err := tr.db.GetUnitByHash(unit.LastBallUnit)
+	if err != nil {
+		return newReviewError(ReviewCodeLastBallUnknown, ErrLastBallUnknown)
+	}
+	witnessList := dag.NewVoteHistory(tr.db, tr.wdb).WitnessListAt(lastBall.MainChainIndex)
+	if !dag.WitnessListsCompatible(unit.WitnessList, witnessList) {
+		return newReviewError(ReviewCodeWitnessListUnknown, ErrWitnessListUnknown)
+	}
+
+	bestParent, err := tr.db.GetUnitByHash(unit.BestParentUnit)
+	if err != nil {
+		return newReviewError(ReviewCodeBestParentUnknown, ErrBestParentUnknown)
+	}
+	if len(bestParent.ParentList) > 0 {
+		if len(unit.WitnessList) != len(bestParent.WitnessList) {
+			return newReviewError(ReviewCodeWitnessListLength, ErrWitnessListLength)
+		}
+		if !dag.WitnessListsCompatible(unit.WitnessList, bestParent.WitnessList) {
+			return newReviewError(ReviewCodeWitnessListIncompatible, ErrWitnessListIncompatible)
+		}
+	}
+
+	bestParentHash, err := dag.NewGraphInfoGetterForUnit(tr.db, unit).GetBestParentUnit()
+	if err != nil || bestParentHash != unit.BestParentUnit {
+		return newReviewError(ReviewCodeBestParentMismatch, ErrBestParentMismatch)
+	}
+	return nil
+}
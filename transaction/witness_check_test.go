@@ -0,0 +1,85 @@
+package transaction
+
+import (
+	"testing"
+
+	"github.com/babyboy/common"
+	"github.com/babyboy/core/types"
+)
+
+// replaceWitness returns a copy of list with the witness at index replaced
+func replaceWitness(list []common.Address, index int, witness common.Address) []common.Address {
+	replaced := append([]common.Address{}, list...)
+	replaced[index] = witness
+	return replaced
+}
+
+func TestReviewWitnessList(t *testing.T) {
+	t.Parallel()
+
+	_, genesis := newTestWitnesses(t)
+	n := newTestNode(genesis)
+	genesisUnit := genesis.ToUnit()
+	witnesses := genesisUnit.WitnessList
+	x, y := common.HexToAddress("0x10"), common.HexToAddress("0x11")
+
+	// a replaced the first witness, b keeps the list and has the higher
+	// witnessed level, so it is the best parent of units compatible with both
+	store := func(hash byte, witnessList []common.Address, witnessedLevel int64) common.Hash {
+		unit := types.NewEmptyUnit()
+		unit.Hash = common.BytesToHash([]byte{hash})
+		unit.ParentList = []common.Hash{genesisUnit.Hash}
+		unit.WitnessList = witnessList
+		unit.BestParentUnit = genesisUnit.Hash
+		unit.Level = 1
+		unit.WitnessedLevel = witnessedLevel
+		n.db.SaveUnitToDb(unit)
+		return unit.Hash
+	}
+	a := store(1, replaceWitness(witnesses, 0, x), 0)
+	b := store(2, witnesses, 1)
+
+	tests := []struct {
+		name       string
+		parents    []common.Hash
+		witnesses  []common.Address
+		lastBall   common.Hash
+		bestParent common.Hash
+		code       int // 0 if the unit passes
+	}{
+		{name: "valid", parents: []common.Hash{genesisUnit.Hash}, witnesses: witnesses, lastBall: genesisUnit.Hash, bestParent: genesisUnit.Hash},
+		{name: "one mutation", parents: []common.Hash{a}, witnesses: replaceWitness(witnesses, 0, x), lastBall: genesisUnit.Hash, bestParent: a},
+		{name: "no parents", witnesses: witnesses, lastBall: genesisUnit.Hash, bestParent: genesisUnit.Hash, code: ReviewCodeNoParents},
+		{name: "empty list", parents: []common.Hash{genesisUnit.Hash}, lastBall: genesisUnit.Hash, bestParent: genesisUnit.Hash, code: ReviewCodeWitnessListEmpty},
+		{name: "duplicates", parents: []common.Hash{genesisUnit.Hash}, witnesses: replaceWitness(witnesses, 1, witnesses[0]), lastBall: genesisUnit.Hash, bestParent: genesisUnit.Hash, code: ReviewCodeWitnessListDuplicate},
+		{name: "unknown last ball", parents: []common.Hash{genesisUnit.Hash}, witnesses: witnesses, lastBall: common.HexToHash("0xff"), bestParent: genesisUnit.Hash, code: ReviewCodeLastBallUnknown},
+		{name: "two mutations vs the stable list", parents: []common.Hash{genesisUnit.Hash}, witnesses: replaceWitness(replaceWitness(witnesses, 0, x), 1, y), lastBall: genesisUnit.Hash, bestParent: genesisUnit.Hash, code: ReviewCodeWitnessListUnknown},
+		{name: "two mutations vs the best parent", parents: []common.Hash{a}, witnesses: replaceWitness(witnesses, 1, y), lastBall: genesisUnit.Hash, bestParent: a, code: ReviewCodeWitnessListIncompatible},
+		{name: "unknown best parent", parents: []common.Hash{genesisUnit.Hash}, witnesses: witnesses, lastBall: genesisUnit.Hash, bestParent: common.HexToHash("0xff"), code: ReviewCodeBestParentUnknown},
+		{name: "best parent mismatch", parents: []common.Hash{a, b}, witnesses: witnesses, lastBall: genesisUnit.Hash, bestParent: a, code: ReviewCodeBestParentMismatch},
+	}
+	for _, test := range tests {
+		unit := types.NewEmptyUnit()
+		unit.ParentList = test.parents
+		unit.WitnessList = test.witnesses
+		unit.LastBallUnit = test.lastBall
+		unit.BestParentUnit = test.bestParent
+		unit.Hash = unit.HashKey()
+
+		err := n.tr.ReviewWitnessList(unit)
+		if test.code == 0 {
+			if err != nil {
+				t.Errorf("%s: got error %v, want none", test.name, err)
+			}
+			continue
+		}
+		reviewErr, ok := err.(*ReviewError)
+		if !ok {
+			t.Errorf("%s: got error %v, want review code %d", test.name, err, test.code)
+			continue
+		}
+		if reviewErr.Code != test.code {
+			t.Errorf("%s: got review code %d, want %d", test.name, reviewErr.Code, test.code)
+		}
+	}
+}
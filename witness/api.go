@@ -0,0 +1,26 @@
+package witness
+
+import (
+	"github.com/babyboy/common"
+)
+
+// PublicWitnessAPI provides an API to inspect the witness service.
+type PublicWitnessAPI struct {
+	w *Witness
+}
+
+// NewPublicWitnessAPI creates a new API definition for the witness service.
+func NewPublicWitnessAPI(w *Witness) *PublicWitnessAPI {
+	return &PublicWitnessAPI{w: w}
+}
+
+// Status returns the state of the witness: its address, whether it is in the
+// current witness list and the last unit it posted.
+func (api *PublicWitnessAPI) Status() Status {
+	return api.w.Status()
+}
+
+// Witnesses returns the witness list currently in force.
+func (api *PublicWitnessAPI) Witnesses() []common.Address {
+	return api.w.node.Witnesses()
+}
@@ -0,0 +1,211 @@
+// Package witness implements the node service authoring the units of a witness.
+//
+// Main chain stability only moves forward when a majority of the witnesses keep
+// posting units on top of the DAG. A witness posts a heartbeat unit every
+// interval, and sooner when it sees units of non-witnesses that still need to
+// be witnessed.
+package witness
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/babyboy/babyboy/accounts"
+	"github.com/babyboy/babyboy/accounts/keystore"
+	"github.com/babyboy/babyboy/node"
+	"github.com/babyboy/babyboy/rpc"
+	"github.com/babyboy/common"
+	"github.com/babyboy/transaction"
+)
+
+const (
+	// DefaultInterval is the heartbeat interval when none is configured.
+	DefaultInterval = 10 * time.Second
+
+	// promptDelay is how long the witness waits after a non-witness unit before
+	// posting, so that a burst of payments is covered by a single unit.
+	promptDelay = time.Second
+)
+
+var (
+	ErrNoKeystore = errors.New("witness: no keystore backend")
+)
+
+// Config holds the settings of the witness service.
+type Config struct {
+	Account  accounts.Account // Keystore account of the witness
+	Password string           // Passphrase unlocking the account
+	Interval time.Duration    // Heartbeat interval, DefaultInterval if zero
+}
+
+// Status describes the state of the witness service, as returned over RPC.
+type Status struct {
+	Address    common.Address `json:"address"`
+	Running    bool           `json:"running"`
+	IsWitness  bool           `json:"isWitness"` // Whether the address is in the current witness list
+	Interval   string         `json:"interval"`
+	Posted     uint64         `json:"posted"` // Units posted since start
+	LastUnit   common.Hash    `json:"lastUnit"`
+	LastPosted int64          `json:"lastPosted"` // Unix time of the last unit, 0 if none
+	LastError  string         `json:"lastError,omitempty"`
+}
+
+// Witness is the node service authoring witness units.
+type Witness struct {
+	node   *node.Node
+	am     *accounts.Manager
+	config Config
+
+	lock       sync.RWMutex
+	running    bool
+	posted     uint64
+	lastUnit   common.Hash
+	lastPosted time.Time
+	lastError  error
+
+	quit chan struct{}
+}
+
+// New creates the witness service, it starts authoring once the node started.
+func New(ctx *node.ServiceContext, config Config) (*Witness, error) {
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	return &Witness{
+		node:   ctx.Node,
+		am:     ctx.AccountManager,
+		config: config,
+		quit:   make(chan struct{}),
+	}, nil
+}
+
+// APIs returns the RPC descriptors of the witness service.
+func (w *Witness) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "witness",
+			Version:   "1.0",
+			Service:   NewPublicWitnessAPI(w),
+			Public:    true,
+		},
+	}
+}
+
+// Start unlocks the witness account and starts posting units.
+func (w *Witness) Start() error {
+	backends := w.am.Backends(keystore.KeyStoreType)
+	if len(backends) == 0 {
+		return ErrNoKeystore
+	}
+	if err := backends[0].(*keystore.KeyStore).Unlock(w.config.Account, w.config.Password); err != nil {
+		return err
+	}
+	w.lock.Lock()
+	w.running = true
+	w.lock.Unlock()
+
+	go w.loop()
+
+	log.Println("Witness started", w.config.Account.Address.String(), "interval", w.config.Interval)
+	return nil
+}
+
+// Stop terminates the authoring loop.
+func (w *Witness) Stop() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.running {
+		close(w.quit)
+		w.running = false
+	}
+}
+
+// loop posts a unit every interval, and shortly after a non-witness unit was
+// handled unless a unit has been posted in the meantime.
+func (w *Witness) loop() {
+	units := make(chan transaction.TXEvent, 64)
+	sub := w.node.Transaction().Subscribe(units)
+	defer sub.Unsubscribe()
+
+	heartbeat := time.NewTicker(w.config.Interval)
+	defer heartbeat.Stop()
+
+	var prompt <-chan time.Time
+	for {
+		select {
+		case ev := <-units:
+			if ev.Kind != transaction.NewUnitHandleDone || prompt != nil {
+				continue
+			}
+			if unit := ev.NewUnitEntity.NewUnit; len(unit.Authors) > 0 && !w.isWitness(unit.Authors[0].Address) {
+				prompt = time.After(promptDelay)
+			}
+		case <-prompt:
+			prompt = nil
+			w.post()
+		case <-heartbeat.C:
+			w.post()
+		case <-w.quit:
+			return
+		}
+	}
+}
+
+// post authors a unit on top of the current tips, if the account is a witness.
+func (w *Witness) post() {
+	if !w.isWitness(w.config.Account.Address) {
+		return
+	}
+	unit, err := w.node.Transaction().CreateWitnessUnit()
+	if err == nil {
+		unit, err = w.node.SignUnit(unit, w.config.Account)
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.lastError = err
+	if err != nil {
+		log.Println("Failed to author witness unit:", err)
+		return
+	}
+	w.node.SubmitUnit(unit)
+
+	w.posted++
+	w.lastUnit = unit.Hash
+	w.lastPosted = time.Now()
+}
+
+func (w *Witness) isWitness(address common.Address) bool {
+	for _, witness := range w.node.Witnesses() {
+		if witness == address {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns the current state of the witness.
+func (w *Witness) Status() Status {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	status := Status{
+		Address:   w.config.Account.Address,
+		Running:   w.running,
+		IsWitness: w.isWitness(w.config.Account.Address),
+		Interval:  w.config.Interval.String(),
+		Posted:    w.posted,
+		LastUnit:  w.lastUnit,
+	}
+	if !w.lastPosted.IsZero() {
+		status.LastPosted = w.lastPosted.Unix()
+	}
+	if w.lastError != nil {
+		status.LastError = w.lastError.Error()
+	}
+	return status
+}